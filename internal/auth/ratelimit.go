@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter enforces the per-minute request limits of tokens with a token
+// bucket per token. The bucket holds a minute's worth of requests, so a
+// client may use its whole allowance in a burst.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow reports whether the token may make another request. If not, it
+// returns how long the client should wait.
+func (l *RateLimiter) Allow(t Token) (bool, time.Duration) {
+	if t.RateLimit <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	limit := float64(t.RateLimit)
+	perRequest := time.Minute / time.Duration(t.RateLimit)
+	b, ok := l.buckets[t.ID]
+	if !ok {
+		b = &bucket{tokens: limit, last: now}
+		l.buckets[t.ID] = b
+	}
+	b.tokens = min(limit, b.tokens+float64(now.Sub(b.last))/float64(perRequest))
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(perRequest))
+	}
+	b.tokens--
+	return true, 0
+}
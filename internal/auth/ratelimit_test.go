@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+
+	token := Token{ID: "a", RateLimit: 2}
+	for i := range 2 {
+		if ok, _ := l.Allow(token); !ok {
+			t.Fatalf("request %d within the limit was rejected", i+1)
+		}
+	}
+	ok, wait := l.Allow(token)
+	if ok || wait != 30*time.Second {
+		t.Errorf("Allow() over the limit = %v, %v, want false, 30s", ok, wait)
+	}
+
+	// Other tokens have their own allowance, unlimited tokens have none.
+	if ok, _ := l.Allow(Token{ID: "b", RateLimit: 2}); !ok {
+		t.Error("another token was rejected")
+	}
+	for range 100 {
+		if ok, _ := l.Allow(Token{ID: "c"}); !ok {
+			t.Fatal("an unlimited token was rejected")
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.Allow(token); !ok {
+		t.Error("request after the allowance refilled was rejected")
+	}
+	if ok, _ := l.Allow(token); ok {
+		t.Error("only one request should have been refilled")
+	}
+}
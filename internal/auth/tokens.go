@@ -0,0 +1,273 @@
+// Package auth manages the API tokens of the HTTP server. Only a hash of
+// each token is stored, in drop-tube's data directory; the token itself is
+// shown once when it is created.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+const FILE_NAME = "tokens.json"
+
+// TOKEN_PREFIX starts every token so that leaked tokens are easy to spot.
+const TOKEN_PREFIX = "dt_"
+
+// Scope is a permission granted to a token.
+type Scope string
+
+const (
+	// SCOPE_SUBMIT allows queueing jobs and cancelling the token's own jobs.
+	SCOPE_SUBMIT Scope = "submit"
+	// SCOPE_READ allows listing jobs and streaming their events.
+	SCOPE_READ Scope = "read"
+	// SCOPE_ADMIN allows everything, including cancelling any job.
+	SCOPE_ADMIN Scope = "admin"
+)
+
+// ErrNotFound is returned when no token matches a name or ID.
+var ErrNotFound = errors.New("token not found")
+
+// Token is a stored API token.
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Hash is the hex-encoded SHA-256 of the token.
+	Hash   string  `json:"hash"`
+	Scopes []Scope `json:"scopes"`
+	// MaxJobs limits the token's queued and running jobs; 0 is unlimited.
+	MaxJobs int `json:"max_jobs,omitempty"`
+	// RateLimit is the number of requests allowed per minute; 0 is unlimited.
+	RateLimit int       `json:"rate_limit,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Allows reports whether the token has the scope. Admin tokens have every
+// scope.
+func (t *Token) Allows(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, SCOPE_ADMIN)
+}
+
+// ParseScopes parses a comma-separated list of scopes.
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for field := range strings.SplitSeq(s, ",") {
+		scope := Scope(strings.TrimSpace(field))
+		switch scope {
+		case SCOPE_SUBMIT, SCOPE_READ, SCOPE_ADMIN:
+		default:
+			return nil, fmt.Errorf("invalid scope %q (supported: submit, read, admin)", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Tokens is the stored token list.
+type Tokens struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// DefaultPath returns the location of the token list in the data directory.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FILE_NAME), nil
+}
+
+// Load reads the token list at path. A missing file is an empty list.
+func Load(path string) (*Tokens, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Tokens{Tokens: []Token{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens %s: %w", path, err)
+	}
+
+	var tokens Tokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens %s: %w", path, err)
+	}
+	if tokens.Tokens == nil {
+		tokens.Tokens = []Token{}
+	}
+	return &tokens, nil
+}
+
+// Save writes the token list to path, readable only by its owner. The file
+// is replaced atomically.
+func (l *Tokens) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write tokens %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write tokens %s: %w", path, err)
+	}
+	return nil
+}
+
+// Create adds a token with the given settings and returns it together with
+// the secret token value, which is not stored.
+func (l *Tokens) Create(t Token) (Token, string, error) {
+	if t.Name == "" {
+		return Token{}, "", errors.New("token name is required")
+	}
+	if len(t.Scopes) == 0 {
+		return Token{}, "", errors.New("at least one scope is required")
+	}
+	if t.MaxJobs < 0 || t.RateLimit < 0 {
+		return Token{}, "", errors.New("job quota and rate limit must not be negative")
+	}
+	for _, existing := range l.Tokens {
+		if strings.EqualFold(existing.Name, t.Name) {
+			return Token{}, "", fmt.Errorf("a token named %q already exists", t.Name)
+		}
+	}
+
+	id, err := randomHex(4)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret = TOKEN_PREFIX + secret
+
+	t.ID = id
+	t.Hash = hash(secret)
+	t.CreatedAt = time.Now()
+	l.Tokens = append(l.Tokens, t)
+	return t, secret, nil
+}
+
+// Revoke removes the token with the given name or ID.
+func (l *Tokens) Revoke(nameOrID string) (Token, error) {
+	for i, t := range l.Tokens {
+		if t.ID == nameOrID || strings.EqualFold(t.Name, nameOrID) {
+			l.Tokens = slices.Delete(l.Tokens, i, i+1)
+			return t, nil
+		}
+	}
+	return Token{}, fmt.Errorf("%s: %w", nameOrID, ErrNotFound)
+}
+
+// Lookup returns the token matching the secret token value.
+func (l *Tokens) Lookup(secret string) (Token, bool) {
+	h := []byte(hash(secret))
+	for _, t := range l.Tokens {
+		if subtle.ConstantTimeCompare(h, []byte(t.Hash)) == 1 {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// Store gives the server the current token list, reloading the file when
+// tokens are created or revoked by another process.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	tokens  *Tokens
+	modTime time.Time
+	size    int64
+}
+
+// NewStore loads the token list at path.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if _, err := s.current(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Empty reports whether no tokens exist, in which case the server rejects
+// every request.
+func (s *Store) Empty() (bool, error) {
+	tokens, err := s.current()
+	if err != nil {
+		return false, err
+	}
+	return len(tokens.Tokens) == 0, nil
+}
+
+// Authenticate returns the token matching the secret token value.
+func (s *Store) Authenticate(secret string) (Token, bool, error) {
+	tokens, err := s.current()
+	if err != nil {
+		return Token{}, false, err
+	}
+	t, ok := tokens.Lookup(secret)
+	return t, ok, nil
+}
+
+// current returns the token list, reloading it if the file changed.
+func (s *Store) current() (*Tokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var modTime time.Time
+	var size int64
+	info, err := os.Stat(s.path)
+	switch {
+	case err == nil:
+		modTime, size = info.ModTime(), info.Size()
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read tokens %s: %w", s.path, err)
+	}
+	if s.tokens != nil && modTime.Equal(s.modTime) && size == s.size {
+		return s.tokens, nil
+	}
+
+	tokens, err := Load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.tokens, s.modTime, s.size = tokens, modTime, size
+	return tokens, nil
+}
+
+// hash returns the hex-encoded SHA-256 of the secret.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Scope
+		wantErr bool
+	}{
+		{"read", []Scope{SCOPE_READ}, false},
+		{"submit, read,submit", []Scope{SCOPE_SUBMIT, SCOPE_READ}, false},
+		{"admin", []Scope{SCOPE_ADMIN}, false},
+		{"write", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(scopeStrings(got), ",") != strings.Join(scopeStrings(tt.want), ",") {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func scopeStrings(scopes []Scope) []string {
+	var s []string
+	for _, scope := range scopes {
+		s = append(s, string(scope))
+	}
+	return s
+}
+
+func TestToken_Allows(t *testing.T) {
+	reader := Token{Scopes: []Scope{SCOPE_READ}}
+	admin := Token{Scopes: []Scope{SCOPE_ADMIN}}
+
+	if !reader.Allows(SCOPE_READ) || reader.Allows(SCOPE_SUBMIT) || reader.Allows(SCOPE_ADMIN) {
+		t.Errorf("read token allows the wrong scopes")
+	}
+	for _, scope := range []Scope{SCOPE_SUBMIT, SCOPE_READ, SCOPE_ADMIN} {
+		if !admin.Allows(scope) {
+			t.Errorf("admin token does not allow %s", scope)
+		}
+	}
+}
+
+func TestTokens_CreateRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FILE_NAME)
+	tokens, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+
+	created, secret, err := tokens.Create(Token{Name: "ci", Scopes: []Scope{SCOPE_SUBMIT}, MaxJobs: 3})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, TOKEN_PREFIX) || created.ID == "" || strings.Contains(created.Hash, secret) {
+		t.Errorf("Create() = %+v, %q, want a new token storing only the hash", created, secret)
+	}
+	if _, _, err := tokens.Create(Token{Name: "CI", Scopes: []Scope{SCOPE_READ}}); err == nil {
+		t.Error("Create() with a duplicate name should fail")
+	}
+	if _, _, err := tokens.Create(Token{Name: "none"}); err == nil {
+		t.Error("Create() without scopes should fail")
+	}
+	if err := tokens.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, ok := reloaded.Lookup(secret); !ok || got.ID != created.ID || got.MaxJobs != 3 {
+		t.Errorf("Lookup() = %+v, %v, want the created token", got, ok)
+	}
+	if _, ok := reloaded.Lookup(TOKEN_PREFIX + "wrong"); ok {
+		t.Error("Lookup() of a wrong token succeeded")
+	}
+
+	if _, err := reloaded.Revoke(created.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := reloaded.Revoke("ci"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Revoke() of a revoked token error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FILE_NAME)
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if empty, err := store.Empty(); err != nil || !empty {
+		t.Errorf("Empty() = %v, %v, want true without a token file", empty, err)
+	}
+
+	// Tokens created and revoked by another process take effect.
+	tokens, _ := Load(path)
+	_, secret, err := tokens.Create(Token{Name: "ci", Scopes: []Scope{SCOPE_READ}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Authenticate(secret); err != nil || !ok {
+		t.Errorf("Authenticate() = %v, %v after the token was created", ok, err)
+	}
+
+	if _, err := tokens.Revoke("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Authenticate(secret); err != nil || ok {
+		t.Errorf("Authenticate() = %v, %v after the token was revoked", ok, err)
+	}
+}
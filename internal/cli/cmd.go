@@ -18,20 +18,51 @@ var rootCmd = &cobra.Command{
 	Use:   "drop-tube [OPTIONS] <YouTube URL>",
 	Short: "Download YouTube videos to local storage",
 	Long: `DropTube is a command-line tool for downloading YouTube videos.
-It supports various formats and quality options while respecting YouTube's terms of service.`,
-	Args: cobra.ExactArgs(1),
+It supports various formats and quality options while respecting YouTube's terms of service.
+Additional yt-dlp arguments can be given with --ytdlp-arg or after "--".`,
+	Args: urlArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg.URL = args[0]
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			cfg.ExtraArgs = append(cfg.ExtraArgs, args[dash:]...)
+		}
 
 		if err := cfg.Validate(); err != nil {
 			return fmt.Errorf("configuration validation failed: %w", err)
 		}
 
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
 		dl := downloader.New(cfg)
-		return dl.Download()
+		dl.AfterDownload(hook)
+		report, err := dl.Download()
+		if !cfg.DryRun {
+			notifyRun(notifier, cfg.URL, []*downloader.Report{report}, err)
+		}
+		return err
 	},
 }
 
+// urlArgs accepts exactly one URL, optionally followed by yt-dlp arguments after "--".
+func urlArgs(cmd *cobra.Command, args []string) error {
+	urls := len(args)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		urls = dash
+	}
+	if urls != 1 {
+		return fmt.Errorf("accepts 1 URL, received %d", urls)
+	}
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -50,4 +81,26 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg.AudioFormat, "audio-format", cfg.AudioFormat, "audio format (mp3, m4a)")
 	rootCmd.PersistentFlags().BoolVar(&cfg.Playlist, "playlist", cfg.Playlist, "download entire playlist")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", cfg.Verbose, "verbose output")
+	rootCmd.PersistentFlags().StringVar(&cfg.Items, "items", cfg.Items, "playlist items to download (e.g. 1-10,15,-3)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Reverse, "reverse", cfg.Reverse, "download playlist items in reverse order")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Random, "random", cfg.Random, "download playlist items in random order")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxItems, "max-items", cfg.MaxItems, "maximum number of playlist items to download")
+	rootCmd.PersistentFlags().StringVar(&cfg.StartAfter, "start-after", cfg.StartAfter, "skip playlist items up to and including this video ID")
+	rootCmd.PersistentFlags().StringVar(&cfg.Tab, "tab", cfg.Tab, "channel tab to download (videos, shorts, streams, podcasts, all)")
+	rootCmd.PersistentFlags().IntVar(&cfg.Latest, "latest", cfg.Latest, "only list the N most recent uploads of a channel or playlist")
+	rootCmd.PersistentFlags().DurationVar(&cfg.MinDuration, "min-duration", cfg.MinDuration, "skip videos shorter than this (e.g. 60s)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.MaxDuration, "max-duration", cfg.MaxDuration, "skip videos longer than this (e.g. 3h)")
+	rootCmd.PersistentFlags().StringVar(&cfg.DateAfter, "date-after", cfg.DateAfter, "skip videos uploaded before this date (YYYYMMDD)")
+	rootCmd.PersistentFlags().StringVar(&cfg.DateBefore, "date-before", cfg.DateBefore, "skip videos uploaded after this date (YYYYMMDD)")
+	rootCmd.PersistentFlags().StringVar(&cfg.MatchTitle, "match-title", cfg.MatchTitle, "only download videos whose title matches this regex")
+	rootCmd.PersistentFlags().StringVar(&cfg.RejectTitle, "reject-title", cfg.RejectTitle, "skip videos whose title matches this regex")
+	rootCmd.PersistentFlags().Int64Var(&cfg.MinViews, "min-views", cfg.MinViews, "skip videos with fewer views")
+	rootCmd.PersistentFlags().BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "print the download plan without downloading")
+	rootCmd.PersistentFlags().BoolVar(&cfg.JSON, "json", cfg.JSON, "print the dry-run plan and lists as JSON")
+	rootCmd.PersistentFlags().BoolVar(&cfg.AbortOnError, "abort-on-error", cfg.AbortOnError, "stop a playlist run at the first failing item")
+	rootCmd.PersistentFlags().StringVar(&cfg.ReportFile, "report", cfg.ReportFile, "write the end-of-run report to this file (.json or .csv)")
+	rootCmd.PersistentFlags().StringVar(&cfg.LimitRate, "limit-rate", cfg.LimitRate, "maximum download rate in bytes per second (e.g. 500K, 2M)")
+	rootCmd.PersistentFlags().StringVar(&hooksFile, "hooks-file", "", "post-download hook file (default: in the data directory)")
+	rootCmd.PersistentFlags().StringVar(&notifyFile, "notify-file", "", "notification file (default: in the data directory)")
+	rootCmd.PersistentFlags().StringArrayVar(&cfg.ExtraArgs, "ytdlp-arg", cfg.ExtraArgs, "extra argument passed to yt-dlp (repeatable)")
 }
@@ -2,7 +2,15 @@ package cli
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
 )
 
 func TestRootCmd(t *testing.T) {
@@ -50,6 +58,28 @@ func TestRootCmdFlags(t *testing.T) {
 		"audio-format",
 		"playlist",
 		"verbose",
+		"ytdlp-arg",
+		"items",
+		"reverse",
+		"random",
+		"max-items",
+		"start-after",
+		"min-duration",
+		"max-duration",
+		"date-after",
+		"date-before",
+		"match-title",
+		"reject-title",
+		"min-views",
+		"dry-run",
+		"json",
+		"abort-on-error",
+		"report",
+		"tab",
+		"latest",
+		"limit-rate",
+		"hooks-file",
+		"notify-file",
 	}
 
 	for _, flagName := range expectedFlags {
@@ -114,3 +144,169 @@ func TestRootCmdArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestURLArgs_AfterDash(t *testing.T) {
+	cmd := &cobra.Command{Args: urlArgs}
+	if err := cmd.ParseFlags([]string{"https://www.youtube.com/watch?v=test", "--", "--embed-subs"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	if err := urlArgs(cmd, cmd.Flags().Args()); err != nil {
+		t.Errorf("urlArgs() error = %v", err)
+	}
+	if dash := cmd.ArgsLenAtDash(); dash != 1 {
+		t.Errorf("ArgsLenAtDash() = %d, want 1", dash)
+	}
+}
+
+func TestRetryCmd(t *testing.T) {
+	cmd, _, err := rootCmd.Find([]string{"retry", "report.json"})
+	if err != nil {
+		t.Fatalf("Find(retry) error = %v", err)
+	}
+	if cmd != retryCmd {
+		t.Errorf("Find(retry) = %v, want retryCmd", cmd.Name())
+	}
+
+	if err := retryCmd.Args(retryCmd, []string{}); err == nil {
+		t.Error("retry without a report should fail")
+	}
+}
+
+func TestSyncCmdFlags(t *testing.T) {
+	for _, name := range []string{"dir", "prune"} {
+		if syncCmd.Flags().Lookup(name) == nil {
+			t.Errorf("Expected sync flag %s not found", name)
+		}
+	}
+}
+
+func TestSubscriptionsCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "subscriptions.json")
+
+	rootCmd.SetArgs([]string{"subscriptions", "add", "--file", file, "--latest", "3", "--name", "Example", "https://www.youtube.com/@example"})
+	defer rootCmd.SetArgs(nil)
+	defer func() { cfg.Latest = 0 }()
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("subscriptions add error = %v", err)
+	}
+
+	list, err := subscriptions.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []subscriptions.Subscription{{Name: "Example", URL: "https://www.youtube.com/@example", Latest: 3}}
+	if !reflect.DeepEqual(list.Subscriptions, want) {
+		t.Errorf("subscriptions add stored %+v, want %+v", list.Subscriptions, want)
+	}
+}
+
+func TestDaemonCmd(t *testing.T) {
+	for _, args := range [][]string{{"daemon"}, {"daemon", "submit"}, {"daemon", "jobs"}} {
+		if _, _, err := rootCmd.Find(args); err != nil {
+			t.Errorf("Find(%v) error = %v", args, err)
+		}
+	}
+	if daemonCmd.PersistentFlags().Lookup("queue-dir") == nil {
+		t.Error("Expected daemon flag queue-dir not found")
+	}
+	for _, name := range []string{"workers", "max-per-host", "host-limit", "schedule-file", "bandwidth", "allow-ytdlp-arg"} {
+		if daemonCmd.Flags().Lookup(name) == nil {
+			t.Errorf("Expected daemon flag %s not found", name)
+		}
+	}
+	if daemonSubmitCmd.Flags().Lookup("priority") == nil {
+		t.Error("Expected daemon submit flag priority not found")
+	}
+}
+
+func TestServeCmdFlags(t *testing.T) {
+	for _, name := range []string{"listen", "queue-dir", "token-file", "no-auth", "allow-origin", "workers", "max-per-host", "host-limit", "schedule-file", "bandwidth", "allow-ytdlp-arg"} {
+		if serveCmd.Flags().Lookup(name) == nil {
+			t.Errorf("Expected serve flag %s not found", name)
+		}
+	}
+}
+
+func TestWatchCmdFlags(t *testing.T) {
+	for _, name := range []string{"queue-dir", "priority", "poll-interval"} {
+		if watchCmd.Flags().Lookup(name) == nil {
+			t.Errorf("Expected watch flag %s not found", name)
+		}
+	}
+}
+
+func TestTokenCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.json")
+
+	rootCmd.SetArgs([]string{"token", "create", "--file", file, "--scope", "submit,read", "--max-jobs", "2", "ci"})
+	defer rootCmd.SetArgs(nil)
+	defer func() { tokenFile, tokenScopes, tokenCreate = "", string(auth.SCOPE_READ), auth.Token{} }()
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("token create error = %v", err)
+	}
+	tokens, err := auth.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens.Tokens) != 1 || tokens.Tokens[0].Name != "ci" || tokens.Tokens[0].MaxJobs != 2 ||
+		!reflect.DeepEqual(tokens.Tokens[0].Scopes, []auth.Scope{auth.SCOPE_SUBMIT, auth.SCOPE_READ}) {
+		t.Errorf("token create stored %+v", tokens.Tokens)
+	}
+
+	rootCmd.SetArgs([]string{"token", "revoke", "--file", file, "ci"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("token revoke error = %v", err)
+	}
+	if tokens, _ := auth.Load(file); len(tokens.Tokens) != 0 {
+		t.Errorf("token revoke left %+v", tokens.Tokens)
+	}
+}
+
+func TestRemoteCmd(t *testing.T) {
+	for _, name := range []string{"add", "list", "status", "cancel", "pause", "resume"} {
+		if _, _, err := rootCmd.Find([]string{"remote", name}); err != nil {
+			t.Errorf("Find(remote %s) error = %v", name, err)
+		}
+	}
+	if remoteCmd.PersistentFlags().Lookup("socket") == nil {
+		t.Error("Expected remote flag socket not found")
+	}
+	if daemonCmd.Flags().Lookup("socket") == nil {
+		t.Error("Expected daemon flag socket not found")
+	}
+	if remoteAddCmd.Flags().Lookup("priority") == nil {
+		t.Error("Expected remote add flag priority not found")
+	}
+}
+
+func TestScheduleCmd(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "schedules.json")
+	schedules := `{"schedules": [{"name": "nightly", "cron": "0 3 * * *", "priority": 1,
+		"job": {"url": "https://www.youtube.com/watch?v=a", "output_dir": "` + filepath.ToSlash(dir) + `"}}]}`
+	if err := os.WriteFile(file, []byte(schedules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	queueDirectory := filepath.Join(dir, "queue")
+
+	defer rootCmd.SetArgs(nil)
+	defer func() { scheduleFile, queueDir = "", "" }()
+	rootCmd.SetArgs([]string{"schedule", "list", "--file", file})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("schedule list error = %v", err)
+	}
+
+	rootCmd.SetArgs([]string{"schedule", "run-now", "--file", file, "--queue-dir", queueDirectory, "nightly"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("schedule run-now error = %v", err)
+	}
+	q, err := queue.Open(queueDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].Owner != "schedule:nightly" || jobs[0].Priority != queue.PRIORITY_HIGH {
+		t.Errorf("schedule run-now queued %+v, want the nightly job", jobs)
+	}
+}
@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/daemon"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/remote"
+	"github.com/hidekingerz/drop-tube/internal/server"
+)
+
+var (
+	queueDir       string
+	socketPath     string
+	jobPriority    string
+	bandwidthRules []string
+	daemonOptions  daemon.Options
+)
+
+// daemonCmd runs the download queue in the background.
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run queued downloads in the background",
+	Long: `Daemon runs the jobs of the download queue until it is interrupted. The queue is
+stored in drop-tube's data directory unless --queue-dir is given, so jobs survive
+restarts: jobs that were running when the daemon stopped are resumed the next time
+it starts. Jobs are submitted with "daemon submit" and listed with "daemon jobs".
+
+Queued jobs start by priority, and in submission order within a priority.
+--workers limits the jobs running at the same time, and --max-per-host the jobs
+downloading from the same site, so that e.g. a playlist backfill does not trip
+YouTube's throttling; --host-limit sets the limit of individual sites.
+
+--bandwidth limits the combined download rate by time of day, e.g.
+"mon-fri 09:00-18:00=1M" keeps downloads at 1 MiB/s during working hours and
+unlimited otherwise. The limit is shared evenly by the running jobs and scheduled
+subscription syncs, which are restarted at their new rate when jobs or syncs start
+or finish, continuing their partial downloads. --limit-rate limits the rate of
+each job and sync.
+
+The daemon also runs the schedules of the schedule file (see "drop-tube schedule").
+Jobs starting, finishing and failing are reported to the webhooks and the email
+recipients of the notification file (--notify-file).
+
+The daemon also listens on a Unix socket in the data directory (or --socket),
+which the "remote" commands use to control it. The socket is only accessible to
+the user running the daemon. Output directories of jobs submitted over the socket
+are resolved against --output and must stay inside it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := parseBandwidth(); err != nil {
+			return err
+		}
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		daemonOptions.AfterDownload = hook
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+		q, err := openQueue()
+		if err != nil {
+			return err
+		}
+		if notifier != nil {
+			q.Observe(notifier.Job)
+		}
+		baseDir, err := filepath.Abs(cfg.OutputDir)
+		if err != nil {
+			return fmt.Errorf("invalid output directory path: %w", err)
+		}
+		path, err := resolveSocketPath()
+		if err != nil {
+			return err
+		}
+		listener, err := remote.Listen(path)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var srv *server.Server
+		daemonOptions.OnProgress = func(jobID string, p downloader.Progress) { srv.Progress(jobID, p) }
+		d := daemon.New(q, daemonOptions)
+		schedulesDone, err := startSchedules(ctx, q, d.RunShared, notifier)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		srv = server.New(q, server.Options{BaseDir: baseDir, Jobs: d, AllowedExtraArgs: daemonOptions.AllowedExtraArgs})
+		socketServer := &http.Server{
+			Handler:     srv.Handler(),
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		go func() {
+			log.Printf("listening on %s", path)
+			if err := socketServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("control socket failed: %v", err)
+			}
+		}()
+
+		runErr := d.Run(ctx)
+		<-schedulesDone
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := socketServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("control socket shutdown: %v", err)
+		}
+		return runErr
+	},
+}
+
+var daemonSubmitCmd = &cobra.Command{
+	Use:   "submit [OPTIONS] <YouTube URL>",
+	Short: "Add a download to the daemon's queue",
+	Long: `Submit adds a download to the queue with the same options as a direct download.
+The running daemon picks it up within a few seconds. --priority (low, normal, high,
+urgent or a number) lets urgent downloads start before earlier ones.`,
+	Args: urlArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		priority, err := queue.ParsePriority(jobPriority)
+		if err != nil {
+			return err
+		}
+		jobCfg := *cfg
+		jobCfg.URL = args[0]
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			jobCfg.ExtraArgs = append(jobCfg.ExtraArgs, args[dash:]...)
+		}
+
+		dir, err := resolveQueueDir()
+		if err != nil {
+			return err
+		}
+		job, err := queue.Submit(dir, jobCfg, queue.AddOptions{Priority: priority})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("queued job %s\n", job.ID)
+		return nil
+	},
+}
+
+var daemonJobsCmd = &cobra.Command{
+	Use:   "jobs [job ID]",
+	Short: "List the jobs of the daemon's queue",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q, err := openQueue()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			job, err := q.Get(args[0])
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(job)
+		}
+
+		jobs := q.List()
+		if cfg.JSON {
+			return json.NewEncoder(os.Stdout).Encode(jobs)
+		}
+		printJobs(os.Stdout, jobs)
+		return nil
+	},
+}
+
+// addSchedulingFlags adds the flags controlling when and how many jobs run
+// and which yt-dlp options they may pass.
+func addSchedulingFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&daemonOptions.Workers, "workers", daemon.DEFAULT_WORKERS, "number of jobs to run at the same time")
+	cmd.Flags().IntVar(&daemonOptions.MaxPerSite, "max-per-host", 0, "number of jobs downloading from the same site at the same time (0 = no limit)")
+	cmd.Flags().StringToIntVar(&daemonOptions.SiteLimits, "host-limit", nil, "limit of a single site overriding --max-per-host, e.g. youtube.com=2 (repeatable)")
+	cmd.Flags().StringVar(&scheduleFile, "schedule-file", "", "schedule file (default: in the data directory)")
+	cmd.Flags().StringArrayVar(&daemonOptions.AllowedExtraArgs, "allow-ytdlp-arg", nil, "yt-dlp option jobs may pass, e.g. --embed-subs; other options are rejected (repeatable)")
+	cmd.Flags().StringArrayVar(&bandwidthRules, "bandwidth", nil, `combined download rate by time of day, e.g. "mon-fri 09:00-18:00=1M" (repeatable, first match wins)`)
+}
+
+// parseBandwidth sets the daemon's bandwidth schedule from --bandwidth.
+func parseBandwidth() error {
+	schedule, err := daemon.ParseBandwidthSchedule(bandwidthRules)
+	if err != nil {
+		return err
+	}
+	daemonOptions.Bandwidth = schedule
+	return nil
+}
+
+// resolveQueueDir returns the queue directory from --queue-dir or the data directory.
+func resolveQueueDir() (string, error) {
+	if queueDir != "" {
+		return queueDir, nil
+	}
+	return queue.DefaultDir()
+}
+
+// resolveSocketPath returns the daemon's socket from --socket or the data directory.
+func resolveSocketPath() (string, error) {
+	if socketPath != "" {
+		return socketPath, nil
+	}
+	return remote.DefaultSocketPath()
+}
+
+// openQueue opens the queue directory.
+func openQueue() (*queue.Queue, error) {
+	dir, err := resolveQueueDir()
+	if err != nil {
+		return nil, err
+	}
+	return queue.Open(dir)
+}
+
+// printJobs writes the jobs as a table.
+func printJobs(w io.Writer, jobs []queue.Job) {
+	if len(jobs) == 0 {
+		fmt.Fprintln(w, "no jobs")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tPRIORITY\tCREATED\tURL\tERROR")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.State, job.Priority,
+			job.CreatedAt.Local().Format(time.DateTime), job.Config.URL, job.Error)
+	}
+	tw.Flush()
+}
+
+func init() {
+	daemonCmd.PersistentFlags().StringVar(&queueDir, "queue-dir", "", "queue directory (default: in the data directory)")
+	daemonCmd.Flags().StringVar(&socketPath, "socket", "", "control socket path (default: in the data directory)")
+	addSchedulingFlags(daemonCmd)
+	daemonSubmitCmd.Flags().StringVar(&jobPriority, "priority", queue.PRIORITY_NORMAL.String(), "job priority: low, normal, high, urgent or a number")
+
+	daemonCmd.AddCommand(daemonSubmitCmd, daemonJobsCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/hooks"
+)
+
+var hooksFile string
+
+// resolveHooksFile returns the hook file from --hooks-file or the data directory.
+func resolveHooksFile() (string, error) {
+	if hooksFile != "" {
+		return hooksFile, nil
+	}
+	return hooks.DefaultPath()
+}
+
+// loadHooks returns the post-download hooks of the hook file, or nil if
+// there are none.
+func loadHooks() (downloader.Hook, error) {
+	path, err := resolveHooksFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := hooks.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.AfterDownload(), nil
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+	"github.com/hidekingerz/drop-tube/internal/notify"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
+)
+
+var notifyFile string
+
+// resolveNotifyFile returns the notification file from --notify-file or the data directory.
+func resolveNotifyFile() (string, error) {
+	if notifyFile != "" {
+		return notifyFile, nil
+	}
+	return notify.DefaultPath()
+}
+
+// openNotifier starts delivering to the targets of the notification file.
+// It returns nil if there are none; a nil notifier sends nothing.
+func openNotifier() (*notify.Notifier, error) {
+	path, err := resolveNotifyFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := notify.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return notify.New(f), nil
+}
+
+// notifyRun sends the summary of a finished run.
+func notifyRun(n *notify.Notifier, name string, reports []*downloader.Report, err error) {
+	if n != nil {
+		n.RunFinished(notify.NewSummary(name, reports, err))
+	}
+}
+
+// collectReports returns subscription options that run hook after every
+// download and collect the reports of the synced subscriptions in reports.
+func collectReports(hook downloader.Hook, reports *[]*downloader.Report) subscriptions.Options {
+	return subscriptions.Options{
+		AfterDownload: hook,
+		OnSynced: func(_ subscriptions.Subscription, summary *mirror.Summary, _ error) {
+			if summary != nil {
+				*reports = append(*reports, summary.Report)
+			}
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/remote"
+)
+
+// remoteCmd controls a running daemon through its socket.
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Control a running daemon",
+	Long: `Remote talks to a running "drop-tube daemon" through its Unix socket instead of
+downloading directly. The socket is in the data directory unless --socket is given.`,
+}
+
+var remoteAddCmd = &cobra.Command{
+	Use:   "add [OPTIONS] <YouTube URL>",
+	Short: "Queue a download on the daemon",
+	Long: `Add queues a download on the running daemon with the same download options as a
+direct download. Output directories are resolved against the daemon's --output
+and must stay inside it; the output template, archive and report options are
+not sent. --priority (low, normal, high, urgent or a number) lets urgent downloads start
+before earlier ones.`,
+	Args: urlArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		priority, err := queue.ParsePriority(jobPriority)
+		if err != nil {
+			return err
+		}
+		jobCfg := *cfg
+		jobCfg.URL = args[0]
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			jobCfg.ExtraArgs = append(jobCfg.ExtraArgs, args[dash:]...)
+		}
+		client, err := remoteClient()
+		if err != nil {
+			return err
+		}
+		job, err := client.Add(jobCfg, priority)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("queued job %s\n", job.ID)
+		return nil
+	},
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the daemon's jobs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := remoteClient()
+		if err != nil {
+			return err
+		}
+		jobs, err := client.List()
+		if err != nil {
+			return err
+		}
+		if cfg.JSON {
+			return json.NewEncoder(os.Stdout).Encode(jobs)
+		}
+		printJobs(os.Stdout, jobs)
+		return nil
+	},
+}
+
+var remoteStatusCmd = &cobra.Command{
+	Use:   "status [job ID]",
+	Short: "Show the daemon's state or a job",
+	Long: `Status prints the number of jobs per state and the running jobs, or the details
+of a single job.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := remoteClient()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if len(args) == 1 {
+			job, err := client.Get(args[0])
+			if err != nil {
+				return err
+			}
+			return enc.Encode(job)
+		}
+
+		jobs, err := client.List()
+		if err != nil {
+			return err
+		}
+		counts := make(map[queue.State]int)
+		running := []queue.Job{}
+		for _, job := range jobs {
+			counts[job.State]++
+			if job.State == queue.STATE_RUNNING {
+				running = append(running, job)
+			}
+		}
+		if cfg.JSON {
+			return enc.Encode(counts)
+		}
+
+		var parts []string
+		for _, state := range []queue.State{queue.STATE_QUEUED, queue.STATE_RUNNING, queue.STATE_PAUSED,
+			queue.STATE_DONE, queue.STATE_FAILED, queue.STATE_CANCELLED} {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+		}
+		fmt.Printf("daemon is running: %s\n", strings.Join(parts, ", "))
+		if len(running) > 0 {
+			fmt.Println()
+			printJobs(os.Stdout, running)
+		}
+		return nil
+	},
+}
+
+// newRemoteActionCmd creates a command applying a state change to jobs.
+func newRemoteActionCmd(use, short, done string, action func(c *remote.Client, id string) (queue.Job, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <job ID>...",
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := remoteClient()
+			if err != nil {
+				return err
+			}
+			var errs []error
+			for _, id := range args {
+				if _, err := action(client, id); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				fmt.Printf("%s job %s\n", done, id)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// remoteClient returns a client for the daemon's socket.
+func remoteClient() (*remote.Client, error) {
+	path, err := resolveSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewClient(path), nil
+}
+
+func init() {
+	remoteCmd.PersistentFlags().StringVar(&socketPath, "socket", "", "control socket path (default: in the data directory)")
+	remoteAddCmd.Flags().StringVar(&jobPriority, "priority", queue.PRIORITY_NORMAL.String(), "job priority: low, normal, high, urgent or a number")
+
+	remoteCmd.AddCommand(remoteAddCmd, remoteListCmd, remoteStatusCmd,
+		newRemoteActionCmd("cancel", "Cancel jobs and remove their partial downloads", "cancelled", (*remote.Client).Cancel),
+		newRemoteActionCmd("pause", "Pause jobs, keeping their partial downloads", "paused", (*remote.Client).Pause),
+		newRemoteActionCmd("resume", "Resume paused jobs where they stopped", "resumed", (*remote.Client).Resume),
+	)
+	rootCmd.AddCommand(remoteCmd)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+// retryCmd re-attempts the failed videos recorded in a previous run report.
+var retryCmd = &cobra.Command{
+	Use:   "retry <report.json>",
+	Short: "Retry the failed videos of a previous run",
+	Long: `Retry reads a JSON report written with --report and downloads again the videos
+that failed with a transient error or were never attempted, using the configuration
+recorded in the report. The report is updated in place unless --report is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		previous, err := downloader.ReadReport(args[0])
+		if err != nil {
+			return err
+		}
+		if previous.Config == nil {
+			return fmt.Errorf("report %s does not contain a configuration", args[0])
+		}
+
+		retryCfg := *previous.Config
+		retryCfg.DryRun = false
+		retryCfg.ReportFile = args[0]
+		if cfg.ReportFile != "" {
+			retryCfg.ReportFile = cfg.ReportFile
+		}
+		retryCfg.Verbose = retryCfg.Verbose || cfg.Verbose
+
+		if err := retryCfg.Validate(); err != nil {
+			return fmt.Errorf("configuration validation failed: %w", err)
+		}
+
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
+		dl := downloader.New(&retryCfg)
+		dl.AfterDownload(hook)
+		report, err := dl.Retry(previous)
+		notifyRun(notifier, retryCfg.URL, []*downloader.Report{report}, err)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(retryCmd)
+}
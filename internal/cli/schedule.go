@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/notify"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/schedule"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
+)
+
+var scheduleFile string
+
+// scheduleCmd shows and runs the daemon's schedules.
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Show and run scheduled downloads",
+	Long: `Schedule shows the schedules the daemon runs. Schedules are defined in
+schedules.json in drop-tube's data directory unless --file is given. Every schedule
+has a name, a cron expression in local time ("0 3 * * *", "0 1 * * sat,sun",
+"@daily") and either a job, a download configuration with the fields of a run
+report's config that is queued at every run, or subscriptions, which syncs the
+named subscriptions (or all of them) into a directory.
+
+Runs missed while the daemon was stopped are caught up with a single run when
+it starts again, unless the schedule's catch_up is "skip".`,
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the schedules with their last and next runs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := resolveScheduleFile()
+		if err != nil {
+			return err
+		}
+		f, err := schedule.Load(path)
+		if err != nil {
+			return err
+		}
+		state, err := schedule.LoadState(schedule.StatePath(path))
+		if err != nil {
+			return err
+		}
+
+		if cfg.JSON {
+			return json.NewEncoder(os.Stdout).Encode(scheduleEntries(f, state, time.Now()))
+		}
+		printSchedules(os.Stdout, scheduleEntries(f, state, time.Now()))
+		return nil
+	},
+}
+
+var scheduleRunNowCmd = &cobra.Command{
+	Use:   "run-now <name>",
+	Short: "Run a schedule immediately",
+	Long: `Run-now runs a schedule once without waiting for its next scheduled time, which
+is not changed. A job is added to the daemon's queue; subscriptions are synced
+in the foreground. Relative output directories are resolved against --output.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
+		runner, err := newScheduleRunner(func(jobCfg config.Config, opts queue.AddOptions) (queue.Job, error) {
+			dir, err := resolveQueueDir()
+			if err != nil {
+				return queue.Job{}, err
+			}
+			return queue.Submit(dir, jobCfg, opts)
+		}, nil, os.Stdout, notifier)
+		if err != nil {
+			return err
+		}
+		return runner.RunNow(args[0])
+	},
+}
+
+// scheduleEntry is a schedule with its last and next run.
+type scheduleEntry struct {
+	schedule.Schedule
+	LastRun time.Time `json:"last_run,omitzero"`
+	NextRun time.Time `json:"next_run,omitzero"`
+}
+
+// scheduleEntries returns the schedules with their runs as of now.
+func scheduleEntries(f *schedule.File, state *schedule.State, now time.Time) []scheduleEntry {
+	entries := []scheduleEntry{}
+	for _, s := range f.Schedules {
+		entries = append(entries, scheduleEntry{Schedule: s, LastRun: state.LastRun[s.Name], NextRun: s.Next(now)})
+	}
+	return entries
+}
+
+// resolveScheduleFile returns the schedule file from --file or the data directory.
+func resolveScheduleFile() (string, error) {
+	if scheduleFile != "" {
+		return scheduleFile, nil
+	}
+	return schedule.DefaultPath()
+}
+
+// newScheduleRunner creates a runner for the schedule file that queues jobs
+// with add, runs subscription syncs at a share of the bandwidth with share
+// if set, writes them to w and sends their summaries to notifier.
+func newScheduleRunner(add schedule.AddFunc, share subscriptions.ShareFunc, w io.Writer, notifier *notify.Notifier) (*schedule.Runner, error) {
+	path, err := resolveScheduleFile()
+	if err != nil {
+		return nil, err
+	}
+	subsPath, err := resolveSubscriptionsFile()
+	if err != nil {
+		return nil, err
+	}
+	baseDir, err := filepath.Abs(cfg.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output directory path: %w", err)
+	}
+	hook, err := loadHooks()
+	if err != nil {
+		return nil, err
+	}
+	return schedule.NewRunner(path, add, schedule.Options{
+		BaseDir:           baseDir,
+		SubscriptionsFile: subsPath,
+		Config:            cfg,
+		Share:             share,
+		Output:            w,
+		AfterDownload:     hook,
+		OnSynced: func(name string, reports []*downloader.Report, err error) {
+			notifyRun(notifier, "schedule "+name, reports, err)
+		},
+	}), nil
+}
+
+// startSchedules runs the schedules in the background until ctx is
+// cancelled, queueing their jobs in q and syncing subscriptions at the share
+// of the bandwidth share gives them. An invalid schedule file is an error.
+// The returned channel is closed once the schedules and their subscription
+// syncs stopped.
+func startSchedules(ctx context.Context, q *queue.Queue, share subscriptions.ShareFunc, notifier *notify.Notifier) (<-chan struct{}, error) {
+	path, err := resolveScheduleFile()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := schedule.Load(path); err != nil {
+		return nil, err
+	}
+	runner, err := newScheduleRunner(q.AddWith, share, nil, notifier)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := runner.Run(ctx); err != nil {
+			log.Printf("schedules stopped: %v", err)
+		}
+	}()
+	return done, nil
+}
+
+// printSchedules writes the schedules as a table.
+func printSchedules(w io.Writer, entries []scheduleEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "no schedules")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCRON\tCATCH-UP\tLAST RUN\tNEXT RUN\tACTION")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Cron, e.Policy(),
+			schedule.FormatTime(e.LastRun, "-"), schedule.FormatTime(e.NextRun, "never"), e.Describe())
+	}
+	tw.Flush()
+}
+
+func init() {
+	scheduleCmd.PersistentFlags().StringVar(&scheduleFile, "file", "", "schedule file (default: in the data directory)")
+	scheduleRunNowCmd.Flags().StringVar(&queueDir, "queue-dir", "", "queue directory (default: in the data directory)")
+
+	scheduleCmd.AddCommand(scheduleListCmd, scheduleRunNowCmd)
+	rootCmd.AddCommand(scheduleCmd)
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+	"github.com/hidekingerz/drop-tube/internal/daemon"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/server"
+)
+
+// shutdownTimeout bounds how long open HTTP requests may take on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+var (
+	serveAddr      string
+	noAuth         bool
+	allowedOrigins []string
+)
+
+// serveCmd runs the daemon together with the HTTP API.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the daemon with an HTTP API for submitting downloads",
+	Long: `Serve runs the download queue like the daemon command and exposes it over HTTP:
+POST /jobs queues a download with the download options of a run report's config
+(without output_template, archive_file and report_file) as JSON, GET /jobs
+and GET /jobs/{id} report job states, DELETE /jobs/{id} cancels a job and
+POST /jobs/{id}/pause and /resume pause and resume it; browsers may only send
+these from pages of the server itself.
+Job states and download progress are streamed as Server-Sent Events from /events
+and /jobs/{id}/events, and over WebSocket from /ws and /jobs/{id}/ws to pages of
+the server itself or of an --allow-origin. The OpenAPI
+document is served at /openapi.json and a web dashboard for submitting and
+following downloads at /. Output directories of submitted jobs are resolved
+against --output and must stay inside it. The "priority" query parameter of
+POST /jobs and the --workers, --max-per-host, --host-limit and --bandwidth flags
+schedule jobs like the daemon, which also runs the schedules of --schedule-file.
+
+Requests must authenticate with an API token (see "drop-tube token") that has the
+required scope and stay within its job quota and rate limit. Without tokens every
+request is rejected; --no-auth opens the API to anyone who can connect instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := parseBandwidth(); err != nil {
+			return err
+		}
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		daemonOptions.AfterDownload = hook
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+		q, err := openQueue()
+		if err != nil {
+			return err
+		}
+		if notifier != nil {
+			q.Observe(notifier.Job)
+		}
+		baseDir, err := filepath.Abs(cfg.OutputDir)
+		if err != nil {
+			return fmt.Errorf("invalid output directory path: %w", err)
+		}
+
+		tokens, err := openTokenStore()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var srv *server.Server
+		daemonOptions.OnProgress = func(jobID string, p downloader.Progress) { srv.Progress(jobID, p) }
+		d := daemon.New(q, daemonOptions)
+		schedulesDone, err := startSchedules(ctx, q, d.RunShared, notifier)
+		if err != nil {
+			return err
+		}
+		srv = server.New(q, server.Options{BaseDir: baseDir, Tokens: tokens, Jobs: d, AllowedExtraArgs: daemonOptions.AllowedExtraArgs, AllowedOrigins: allowedOrigins})
+		httpServer := &http.Server{
+			Addr:              serveAddr,
+			Handler:           srv.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			// Event streams end with the context instead of holding up the
+			// shutdown.
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		serveErr := make(chan error, 1)
+		go func() {
+			log.Printf("listening on http://%s", serveAddr)
+			serveErr <- httpServer.ListenAndServe()
+		}()
+
+		daemonDone := make(chan error, 1)
+		go func() { daemonDone <- d.Run(ctx) }()
+
+		select {
+		case err := <-serveErr:
+			stop()
+			<-daemonDone
+			<-schedulesDone
+			return fmt.Errorf("http server failed: %w", err)
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http server shutdown: %v", err)
+		}
+		runErr := <-daemonDone
+		<-schedulesDone
+		return runErr
+	},
+}
+
+// openTokenStore returns the API tokens requests must present, or nil with
+// --no-auth. Whether the API is open is decided here, once: revoking the
+// last token later locks the API instead of opening it.
+func openTokenStore() (*auth.Store, error) {
+	if noAuth {
+		log.Printf("warning: authentication is disabled, the API is open to anyone who can connect")
+		return nil, nil
+	}
+	tokenPath, err := resolveTokenFile()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := auth.NewStore(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	if empty, err := tokens.Empty(); err != nil {
+		return nil, err
+	} else if empty {
+		log.Printf("warning: no API tokens in %s, every request is rejected until one is created with \"drop-tube token create\" (or use --no-auth)", tokenPath)
+	}
+	return tokens, nil
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "listen", server.DEFAULT_LISTEN_ADDR, "address to listen on")
+	serveCmd.Flags().StringVar(&queueDir, "queue-dir", "", "queue directory (default: in the data directory)")
+	serveCmd.Flags().StringVar(&tokenFile, "token-file", "", "API token file (default: in the data directory)")
+	serveCmd.Flags().BoolVar(&noAuth, "no-auth", false, "serve the API without authentication")
+	serveCmd.Flags().StringArrayVar(&allowedOrigins, "allow-origin", nil, "origin of other web pages that may open WebSockets, e.g. https://dashboard.example.com (repeatable)")
+	addSchedulingFlags(serveCmd)
+
+	rootCmd.AddCommand(serveCmd)
+}
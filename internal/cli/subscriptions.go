@@ -0,0 +1,351 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/feed"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
+)
+
+var (
+	subscriptionsFile string
+	subscriptionAdd   subscriptions.Subscription
+	importFormat      string
+	subscriptionsDir  string
+)
+
+// subscriptionsCmd manages the list of channels to keep in sync.
+var subscriptionsCmd = &cobra.Command{
+	Use:   "subscriptions",
+	Short: "Manage the list of subscribed channels",
+	Long: `Subscriptions manages the channels drop-tube keeps in sync. The list is stored in
+drop-tube's data directory ($DROP_TUBE_DATA_DIR, $XDG_DATA_HOME/drop-tube or
+~/.local/share/drop-tube) unless --file is given.`,
+}
+
+var subscriptionsAddCmd = &cobra.Command{
+	Use:   "add <channel URL>",
+	Short: "Subscribe to a channel",
+	Long: `Add subscribes to a channel. The download options given with add, such as --tab,
+--latest, --audio-only, --format, --quality, the duration limits and the title
+filters, are stored as the channel's settings and used by "subscriptions sync".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sub := subscriptionAdd
+		sub.URL = args[0]
+		applyChangedSettings(cmd, &sub)
+
+		return updateSubscriptions(func(list *subscriptions.List) error {
+			if err := list.Add(sub); err != nil {
+				return err
+			}
+			added := list.Subscriptions[len(list.Subscriptions)-1]
+			fmt.Printf("subscribed to %s as %q\n", added.URL, added.Name)
+			return nil
+		})
+	},
+}
+
+var subscriptionsRemoveCmd = &cobra.Command{
+	Use:   "remove <name|URL|channel ID>",
+	Short: "Unsubscribe from a channel",
+	Long:  `Remove unsubscribes from a channel. Files already downloaded are kept.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSubscriptions(func(list *subscriptions.List) error {
+			removed, err := list.Remove(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("unsubscribed from %q\n", removed.Name)
+			return nil
+		})
+	},
+}
+
+var subscriptionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the subscribed channels",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, _, err := loadSubscriptions()
+		if err != nil {
+			return err
+		}
+		if cfg.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(list)
+		}
+		printSubscriptions(os.Stdout, list.Subscriptions)
+		return nil
+	},
+}
+
+var subscriptionsImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import subscriptions from OPML, NewPipe or FreeTube",
+	Long: `Import adds the channels of a subscription export to the list. OPML files,
+NewPipe's subscriptions JSON and FreeTube's subscriptions export are supported;
+the format is detected from the content unless --from is given. Channels that
+are already subscribed are skipped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", args[0], err)
+		}
+		imported, err := subscriptions.Import(data, importFormat)
+		if err != nil {
+			return err
+		}
+
+		return updateSubscriptions(func(list *subscriptions.List) error {
+			added, err := list.Merge(imported)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("imported %d of %d channels, %d already subscribed\n", added, len(imported), len(imported)-added)
+			return nil
+		})
+	},
+}
+
+var subscriptionsSyncCmd = &cobra.Command{
+	Use:   "sync [name...]",
+	Short: "Mirror every subscribed channel",
+	Long: `Sync mirrors every subscribed channel, or only the named ones, into its own
+directory below --dir, like the sync command. Each channel's stored settings
+override the options given on the command line. A failing channel does not stop
+the others.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, _, err := loadSubscriptions()
+		if err != nil {
+			return err
+		}
+
+		subs, err := selectSubscriptions(list, args)
+		if err != nil || len(subs) == 0 {
+			return err
+		}
+
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
+		var reports []*downloader.Report
+		err = subscriptions.Sync(subs, cfg, subscriptionsDir, collectReports(hook, &reports), os.Stdout)
+		notifyRun(notifier, "subscriptions sync", reports, err)
+		return err
+	},
+}
+
+var subscriptionsPollCmd = &cobra.Command{
+	Use:   "poll [name...]",
+	Short: "Download new uploads found in the channel feeds",
+	Long: `Poll checks the upload feed of every subscribed channel, or only the named ones,
+and downloads the uploads that were not seen before into the channel's directory
+below --dir. This is much faster than "subscriptions sync" but only sees the
+latest uploads of each channel. Feeds are requested conditionally, and the
+seen uploads are remembered in the data directory. Channel IDs missing from
+the subscription list are resolved once with yt-dlp and stored.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, path, err := loadSubscriptions()
+		if err != nil {
+			return err
+		}
+		changed, resolveErr := list.ResolveChannelIDs(cfg)
+		if changed {
+			if err := list.Save(path); err != nil {
+				return err
+			}
+		}
+		if resolveErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", resolveErr)
+		}
+
+		subs, err := selectSubscriptions(list, args)
+		if err != nil || len(subs) == 0 {
+			return err
+		}
+
+		hook, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+		statePath, err := feed.DefaultStatePath()
+		if err != nil {
+			return err
+		}
+		state, err := feed.LoadState(statePath)
+		if err != nil {
+			return err
+		}
+
+		var reports []*downloader.Report
+		pollErr := subscriptions.Poll(subs, cfg, subscriptionsDir, feed.NewPoller(state), collectReports(hook, &reports), os.Stdout)
+		notifyRun(notifier, "subscriptions poll", reports, pollErr)
+		if err := state.Save(statePath); err != nil {
+			return errors.Join(pollErr, err)
+		}
+		return pollErr
+	},
+}
+
+// selectSubscriptions returns the subscriptions named in args, or all of
+// them if args is empty.
+func selectSubscriptions(list *subscriptions.List, args []string) ([]subscriptions.Subscription, error) {
+	subs := list.Subscriptions
+	if len(args) > 0 {
+		subs = []subscriptions.Subscription{}
+		for _, key := range args {
+			sub, err := list.Get(key)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+	}
+	if len(subs) == 0 {
+		fmt.Println("no subscriptions")
+	}
+	return subs, nil
+}
+
+// applyChangedSettings copies the download options given on the command
+// line into the subscription's settings.
+func applyChangedSettings(cmd *cobra.Command, sub *subscriptions.Subscription) {
+	changed := cmd.Flags().Changed
+	if changed("tab") {
+		sub.Tab = cfg.Tab
+	}
+	if changed("latest") {
+		sub.Latest = cfg.Latest
+	}
+	if changed("audio-only") {
+		sub.AudioOnly = cfg.AudioOnly
+	}
+	if changed("format") {
+		sub.Format = cfg.Format
+	}
+	if changed("quality") {
+		sub.Quality = cfg.Quality
+	}
+	if changed("min-duration") {
+		sub.MinDuration = cfg.MinDuration
+	}
+	if changed("max-duration") {
+		sub.MaxDuration = cfg.MaxDuration
+	}
+	if changed("match-title") {
+		sub.MatchTitle = cfg.MatchTitle
+	}
+	if changed("reject-title") {
+		sub.RejectTitle = cfg.RejectTitle
+	}
+}
+
+// resolveSubscriptionsFile returns the subscription list from --file or the data directory.
+func resolveSubscriptionsFile() (string, error) {
+	if subscriptionsFile != "" {
+		return subscriptionsFile, nil
+	}
+	return subscriptions.DefaultPath()
+}
+
+// loadSubscriptions reads the subscription list and returns it with its path.
+func loadSubscriptions() (*subscriptions.List, string, error) {
+	path, err := resolveSubscriptionsFile()
+	if err != nil {
+		return nil, "", err
+	}
+	list, err := subscriptions.Load(path)
+	return list, path, err
+}
+
+// updateSubscriptions loads the subscription list, applies update and saves
+// the list if update succeeds.
+func updateSubscriptions(update func(list *subscriptions.List) error) error {
+	list, path, err := loadSubscriptions()
+	if err != nil {
+		return err
+	}
+	if err := update(list); err != nil {
+		return err
+	}
+	return list.Save(path)
+}
+
+// printSubscriptions writes the subscriptions as a table.
+func printSubscriptions(w io.Writer, subs []subscriptions.Subscription) {
+	if len(subs) == 0 {
+		fmt.Fprintln(w, "no subscriptions")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tURL\tDIR\tSETTINGS")
+	for _, s := range subs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.URL, s.Dir, settingsSummary(s))
+	}
+	tw.Flush()
+}
+
+// settingsSummary describes the per-channel settings of a subscription.
+func settingsSummary(s subscriptions.Subscription) string {
+	var parts []string
+	add := func(cond bool, format string, a ...any) {
+		if cond {
+			parts = append(parts, fmt.Sprintf(format, a...))
+		}
+	}
+	add(s.Tab != "", "tab=%s", s.Tab)
+	add(s.Latest > 0, "latest=%d", s.Latest)
+	add(s.AudioOnly, "audio-only")
+	add(s.Format != "", "format=%s", s.Format)
+	add(s.Quality != "", "quality=%s", s.Quality)
+	add(s.MinDuration != 0, "min-duration=%s", s.MinDuration)
+	add(s.MaxDuration != 0, "max-duration=%s", s.MaxDuration)
+	add(s.MatchTitle != "", "match-title=%s", s.MatchTitle)
+	add(s.RejectTitle != "", "reject-title=%s", s.RejectTitle)
+	add(s.Prune, "prune")
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	subscriptionsCmd.PersistentFlags().StringVar(&subscriptionsFile, "file", "", "subscription list file (default: in the data directory)")
+
+	subscriptionsAddCmd.Flags().StringVar(&subscriptionAdd.Name, "name", "", "name of the subscription (default: derived from the URL)")
+	subscriptionsAddCmd.Flags().StringVar(&subscriptionAdd.Dir, "dir", "", "directory to mirror the channel into (default: the name)")
+	subscriptionsAddCmd.Flags().BoolVar(&subscriptionAdd.Prune, "prune", false, "remove local files of videos no longer on the channel")
+	subscriptionsImportCmd.Flags().StringVar(&importFormat, "from", "", "export format (opml, newpipe, freetube; default: detected)")
+	subscriptionsSyncCmd.Flags().StringVar(&subscriptionsDir, "dir", ".", "directory containing the channel directories")
+	subscriptionsPollCmd.Flags().StringVar(&subscriptionsDir, "dir", ".", "directory containing the channel directories")
+
+	subscriptionsCmd.AddCommand(subscriptionsAddCmd, subscriptionsRemoveCmd, subscriptionsListCmd,
+		subscriptionsImportCmd, subscriptionsSyncCmd, subscriptionsPollCmd)
+	rootCmd.AddCommand(subscriptionsCmd)
+}
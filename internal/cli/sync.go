@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+)
+
+var (
+	syncDir     string
+	syncOptions mirror.Options
+)
+
+// syncCmd mirrors a channel into a local directory.
+var syncCmd = &cobra.Command{
+	Use:   "sync <channel URL>",
+	Short: "Mirror a channel into a local directory",
+	Long: `Sync lists the channel's uploads, compares them with the directory's download
+archive and local files, and downloads only the new videos. With --prune, local
+files of videos that are no longer on the channel are removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		syncCfg := *cfg
+		syncCfg.URL = args[0]
+		syncCfg.OutputDir = syncDir
+		syncCfg.Playlist = true
+
+		err := syncCfg.Validate()
+		if err != nil {
+			return fmt.Errorf("configuration validation failed: %w", err)
+		}
+
+		if syncOptions.AfterDownload, err = loadHooks(); err != nil {
+			return err
+		}
+
+		notifier, err := openNotifier()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
+		summary, err := mirror.New(&syncCfg, syncOptions).Sync()
+		var report *downloader.Report
+		if summary != nil {
+			summary.Print(os.Stdout)
+			report = summary.Report
+		}
+		notifyRun(notifier, syncCfg.URL, []*downloader.Report{report}, err)
+		return err
+	},
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncDir, "dir", ".", "directory to mirror the channel into")
+	syncCmd.Flags().BoolVar(&syncOptions.Prune, "prune", false, "remove local files of videos no longer on the channel")
+
+	rootCmd.AddCommand(syncCmd)
+}
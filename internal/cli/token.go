@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+)
+
+var (
+	tokenFile   string
+	tokenScopes string
+	tokenCreate auth.Token
+)
+
+// tokenCmd manages the API tokens of the serve command.
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for the HTTP server",
+	Long: `Token manages the tokens clients of "drop-tube serve" authenticate with. Unless
+the server runs with --no-auth, every API request needs one in an
+"Authorization: Bearer" header.
+Tokens are stored hashed in drop-tube's data directory unless --file is given;
+changes take effect on a running server without a restart.`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an API token",
+	Long: `Create creates a token and prints it. The token cannot be shown again.
+
+Scopes: submit queues jobs and cancels the token's own jobs, read lists jobs and
+streams their events, admin allows everything including cancelling any job.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scopes, err := auth.ParseScopes(tokenScopes)
+		if err != nil {
+			return err
+		}
+		token := tokenCreate
+		token.Name = args[0]
+		token.Scopes = scopes
+
+		return updateTokens(func(tokens *auth.Tokens) error {
+			created, secret, err := tokens.Create(token)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "created token %q (%s); store it now, it cannot be shown again\n", created.Name, created.ID)
+			fmt.Println(secret)
+			return nil
+		})
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <name|ID>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateTokens(func(tokens *auth.Tokens) error {
+			revoked, err := tokens.Revoke(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("revoked token %q\n", revoked.Name)
+			return nil
+		})
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the API tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, _, err := loadTokens()
+		if err != nil {
+			return err
+		}
+		if cfg.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(tokens)
+		}
+		printTokens(os.Stdout, tokens.Tokens)
+		return nil
+	},
+}
+
+// resolveTokenFile returns the token file from --file or the data directory.
+func resolveTokenFile() (string, error) {
+	if tokenFile != "" {
+		return tokenFile, nil
+	}
+	return auth.DefaultPath()
+}
+
+// loadTokens reads the token list and returns it with its path.
+func loadTokens() (*auth.Tokens, string, error) {
+	path, err := resolveTokenFile()
+	if err != nil {
+		return nil, "", err
+	}
+	tokens, err := auth.Load(path)
+	return tokens, path, err
+}
+
+// updateTokens loads the token list, applies update and saves the list if
+// update succeeds.
+func updateTokens(update func(tokens *auth.Tokens) error) error {
+	tokens, path, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	if err := update(tokens); err != nil {
+		return err
+	}
+	return tokens.Save(path)
+}
+
+// printTokens writes the tokens as a table.
+func printTokens(w io.Writer, tokens []auth.Token) {
+	if len(tokens) == 0 {
+		fmt.Fprintln(w, "no tokens")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tMAX JOBS\tRATE LIMIT\tCREATED")
+	for _, t := range tokens {
+		scopes := make([]string, len(t.Scopes))
+		for i, scope := range t.Scopes {
+			scopes[i] = string(scope)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(scopes, ","),
+			limitString(t.MaxJobs, ""), limitString(t.RateLimit, "/min"), t.CreatedAt.Local().Format(time.DateTime))
+	}
+	tw.Flush()
+}
+
+// limitString formats a limit where 0 means unlimited.
+func limitString(n int, unit string) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%s", n, unit)
+}
+
+func init() {
+	tokenCmd.PersistentFlags().StringVar(&tokenFile, "file", "", "token file (default: in the data directory)")
+
+	tokenCreateCmd.Flags().StringVar(&tokenScopes, "scope", string(auth.SCOPE_READ), "comma-separated scopes (submit, read, admin)")
+	tokenCreateCmd.Flags().IntVar(&tokenCreate.MaxJobs, "max-jobs", 0, "maximum number of queued and running jobs (0: unlimited)")
+	tokenCreateCmd.Flags().IntVar(&tokenCreate.RateLimit, "rate-limit", 0, "maximum number of requests per minute (0: unlimited)")
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenRevokeCmd, tokenListCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/watch"
+)
+
+var watchPollInterval time.Duration
+
+// watchCmd queues the URL files dropped into a directory.
+var watchCmd = &cobra.Command{
+	Use:   "watch [OPTIONS] <dir>",
+	Short: "Queue the URLs of files dropped into a directory",
+	Long: `Watch monitors a directory for files containing URLs and adds them to the
+daemon's queue, for tools that can only write files: .txt files with one URL
+per line (blank lines and lines starting with # are ignored), Windows .url
+shortcuts and macOS .webloc files. New files are noticed at once on Linux and
+within --poll-interval elsewhere; files that are in the directory when watch
+starts are queued too.
+
+Every URL is queued with the download options given to watch, or with the
+options of a sidecar: a JSON file with the same name and the .json extension,
+such as music.json for music.txt, with the download options of a job submitted
+to the HTTP API and a "priority". Write the sidecar before the URL file. Output
+directories are resolved against --output and must stay inside it.
+
+Processed files are moved with their sidecars into the done/ subdirectory, or
+into failed/ together with a .error file describing the problem. A file is only
+queued if all of its URLs are valid.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		priority, err := queue.ParsePriority(jobPriority)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(args[0])
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", args[0])
+		}
+
+		jobCfg := *cfg
+		if jobCfg.OutputDir, err = filepath.Abs(jobCfg.OutputDir); err != nil {
+			return fmt.Errorf("invalid output directory path: %w", err)
+		}
+		dir, err := resolveQueueDir()
+		if err != nil {
+			return err
+		}
+		add := func(jobCfg config.Config, opts queue.AddOptions) (queue.Job, error) {
+			return queue.Submit(dir, jobCfg, opts)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		w := watch.New(args[0], add, watch.Options{Config: jobCfg, Priority: priority, PollInterval: watchPollInterval})
+		return w.Run(ctx)
+	},
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&queueDir, "queue-dir", "", "queue directory (default: in the data directory)")
+	watchCmd.Flags().StringVar(&jobPriority, "priority", queue.PRIORITY_NORMAL.String(), "priority of jobs without a sidecar: low, normal, high, urgent or a number")
+	watchCmd.Flags().DurationVar(&watchPollInterval, "poll-interval", watch.DEFAULT_POLL_INTERVAL, "how often to scan the directory where file notifications are not supported")
+
+	rootCmd.AddCommand(watchCmd)
+}
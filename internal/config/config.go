@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
 )
 
 const (
@@ -16,38 +21,95 @@ const (
 	DEFAULT_VERBOSE      = false
 	DEFAULT_AUDIO_ONLY   = false
 	DEFAULT_PLAYLIST     = false
+
+	DEFAULT_OUTPUT_TEMPLATE = "%(title)s.%(ext)s"
 )
 
 // Config represents the configuration for video downloading.
 // It contains all the necessary parameters for customizing the download process.
+// It is stored as JSON in run reports so that a run can be repeated.
 type Config struct {
-	OutputDir   string
-	Format      string
-	Quality     string
-	AudioOnly   bool
-	AudioFormat string
-	Playlist    bool
-	Verbose     bool
-	URL         string
+	OutputDir   string `json:"output_dir"`
+	Format      string `json:"format"`
+	Quality     string `json:"quality"`
+	AudioOnly   bool   `json:"audio_only,omitempty"`
+	AudioFormat string `json:"audio_format"`
+	Playlist    bool   `json:"playlist,omitempty"`
+	Verbose     bool   `json:"verbose,omitempty"`
+	URL         string `json:"url"`
+	// OutputTemplate is the yt-dlp output template relative to OutputDir.
+	OutputTemplate string `json:"output_template,omitempty"`
+	// ArchiveFile is the yt-dlp download archive used to skip downloaded videos.
+	ArchiveFile string `json:"archive_file,omitempty"`
+	// DryRun prints the download plan without downloading media files.
+	DryRun bool `json:"dry_run,omitempty"`
+	// JSON prints machine readable output where supported.
+	JSON bool `json:"json,omitempty"`
+	// AbortOnError stops a playlist run at the first failing item.
+	AbortOnError bool `json:"abort_on_error,omitempty"`
+	// ReportFile is where the end-of-run report is written (.json or .csv).
+	ReportFile string `json:"report_file,omitempty"`
+
+	// ExtraArgs are additional yt-dlp arguments appended as-is.
+	ExtraArgs []string `json:"extra_args,omitempty"`
+	// AllowedExtraArgs restricts ExtraArgs to the listed option names when
+	// non-empty. It is an operator setting (the daemon's --allow-ytdlp-arg)
+	// and never read from job files or API requests.
+	AllowedExtraArgs []string `json:"-"`
+	// LimitRate is the maximum download rate, such as "2M" (see ParseRate).
+	LimitRate string `json:"limit_rate,omitempty"`
+
+	// Items selects playlist items by position (e.g. "1-10,15,-3").
+	Items string `json:"items,omitempty"`
+	// Reverse downloads the selected playlist items in reverse order.
+	Reverse bool `json:"reverse,omitempty"`
+	// Random downloads the selected playlist items in random order.
+	Random bool `json:"random,omitempty"`
+	// MaxItems limits the number of playlist items downloaded (0 means no limit).
+	MaxItems int `json:"max_items,omitempty"`
+	// StartAfter skips playlist items up to and including the given video ID.
+	StartAfter string `json:"start_after,omitempty"`
+	// Tab selects the channel tab to download (videos, shorts, streams,
+	// podcasts or all). It implies Playlist.
+	Tab string `json:"tab,omitempty"`
+	// Latest limits channel and playlist listings to the newest N uploads.
+	Latest int `json:"latest,omitempty"`
+
+	// MinDuration skips videos shorter than the given duration.
+	MinDuration time.Duration `json:"min_duration,omitempty"`
+	// MaxDuration skips videos longer than the given duration.
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	// DateAfter skips videos uploaded before the given date (YYYYMMDD or YYYY-MM-DD).
+	DateAfter string `json:"date_after,omitempty"`
+	// DateBefore skips videos uploaded after the given date (YYYYMMDD or YYYY-MM-DD).
+	DateBefore string `json:"date_before,omitempty"`
+	// MatchTitle skips videos whose title does not match the regular expression.
+	MatchTitle string `json:"match_title,omitempty"`
+	// RejectTitle skips videos whose title matches the regular expression.
+	RejectTitle string `json:"reject_title,omitempty"`
+	// MinViews skips videos with fewer views.
+	MinViews int64 `json:"min_views,omitempty"`
 }
 
 // NewConfig creates a new configuration with default values.
 func NewConfig() *Config {
 	return &Config{
-		OutputDir:   DEFAULT_OUTPUT_DIR,
-		Format:      DEFAULT_FORMAT,
-		Quality:     DEFAULT_QUALITY,
-		AudioOnly:   DEFAULT_AUDIO_ONLY,
-		AudioFormat: DEFAULT_AUDIO_FORMAT,
-		Playlist:    DEFAULT_PLAYLIST,
-		Verbose:     DEFAULT_VERBOSE,
+		OutputDir:      DEFAULT_OUTPUT_DIR,
+		Format:         DEFAULT_FORMAT,
+		Quality:        DEFAULT_QUALITY,
+		AudioOnly:      DEFAULT_AUDIO_ONLY,
+		AudioFormat:    DEFAULT_AUDIO_FORMAT,
+		Playlist:       DEFAULT_PLAYLIST,
+		Verbose:        DEFAULT_VERBOSE,
+		OutputTemplate: DEFAULT_OUTPUT_TEMPLATE,
 	}
 }
 
-// Validate validates the configuration parameters.
+// Validate validates the configuration parameters and creates the output
+// directory, making its path absolute.
 func (c *Config) Validate() error {
-	if c.URL == "" {
-		return fmt.Errorf("youtube URL is required")
+	if err := c.Check(); err != nil {
+		return err
 	}
 
 	if c.OutputDir != "" {
@@ -65,6 +127,135 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// Check validates the configuration parameters like Validate, but leaves
+// the file system alone.
+func (c *Config) Check() error {
+	if c.URL == "" {
+		return fmt.Errorf("youtube URL is required")
+	}
+
+	if err := c.validateExtraArgs(); err != nil {
+		return fmt.Errorf("invalid yt-dlp arguments: %w", err)
+	}
+
+	if _, err := c.Rate(); err != nil {
+		return err
+	}
+
+	if c.Tab != "" {
+		if !youtubeurl.ValidTab(c.Tab) {
+			return fmt.Errorf("invalid channel tab %q", c.Tab)
+		}
+		c.Playlist = true
+	}
+
+	if err := c.validateSelection(); err != nil {
+		return fmt.Errorf("invalid playlist selection: %w", err)
+	}
+
+	if _, err := c.Filter(); err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	return nil
+}
+
+// Rate returns LimitRate in bytes per second, or 0 if downloads are not
+// limited.
+func (c *Config) Rate() (int64, error) {
+	if c.LimitRate == "" {
+		return 0, nil
+	}
+	return ParseRate(c.LimitRate)
+}
+
+// HasSelection reports whether any playlist item selection option is set.
+func (c *Config) HasSelection() bool {
+	return c.Items != "" || c.Reverse || c.Random || c.MaxItems > 0 || c.StartAfter != "" || c.Latest > 0
+}
+
+// validateSelection checks the playlist item selection options.
+func (c *Config) validateSelection() error {
+	if c.MaxItems < 0 {
+		return fmt.Errorf("max items must not be negative: %d", c.MaxItems)
+	}
+	if c.Latest < 0 {
+		return fmt.Errorf("latest must not be negative: %d", c.Latest)
+	}
+	if !c.HasSelection() {
+		return nil
+	}
+	if !c.Playlist {
+		return fmt.Errorf("playlist item selection requires --playlist")
+	}
+	if c.Reverse && c.Random {
+		return fmt.Errorf("--reverse and --random cannot be used together")
+	}
+	if c.Items != "" {
+		if _, err := playlist.ParseItems(c.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasFilters reports whether any content filter option is set.
+func (c *Config) HasFilters() bool {
+	return c.MinDuration != 0 || c.MaxDuration != 0 || c.DateAfter != "" || c.DateBefore != "" ||
+		c.MatchTitle != "" || c.RejectTitle != "" || c.MinViews != 0
+}
+
+// Filter builds the content filter from the configuration.
+// It returns nil if no filter option is set.
+func (c *Config) Filter() (*playlist.Filter, error) {
+	if !c.HasFilters() {
+		return nil, nil
+	}
+	if c.MinDuration < 0 || c.MaxDuration < 0 {
+		return nil, fmt.Errorf("durations must not be negative")
+	}
+	if c.MaxDuration > 0 && c.MinDuration > c.MaxDuration {
+		return nil, fmt.Errorf("min duration %s is longer than max duration %s", c.MinDuration, c.MaxDuration)
+	}
+	if c.MinViews < 0 {
+		return nil, fmt.Errorf("min views must not be negative: %d", c.MinViews)
+	}
+
+	f := &playlist.Filter{
+		MinDuration: c.MinDuration,
+		MaxDuration: c.MaxDuration,
+		MinViews:    c.MinViews,
+	}
+
+	var err error
+	if c.DateAfter != "" {
+		if f.DateAfter, err = playlist.ParseDate(c.DateAfter); err != nil {
+			return nil, err
+		}
+	}
+	if c.DateBefore != "" {
+		if f.DateBefore, err = playlist.ParseDate(c.DateBefore); err != nil {
+			return nil, err
+		}
+	}
+	if f.DateAfter != "" && f.DateBefore != "" && f.DateAfter > f.DateBefore {
+		return nil, fmt.Errorf("date after %s is later than date before %s", c.DateAfter, c.DateBefore)
+	}
+
+	if c.MatchTitle != "" {
+		if f.MatchTitle, err = regexp.Compile(c.MatchTitle); err != nil {
+			return nil, fmt.Errorf("invalid match title pattern: %w", err)
+		}
+	}
+	if c.RejectTitle != "" {
+		if f.RejectTitle, err = regexp.Compile(c.RejectTitle); err != nil {
+			return nil, fmt.Errorf("invalid reject title pattern: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
 // ensureOutputDir creates the output directory if it doesn't exist.
 func (c *Config) ensureOutputDir() error {
 	if _, err := os.Stat(c.OutputDir); os.IsNotExist(err) {
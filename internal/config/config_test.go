@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -47,6 +48,15 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid limit rate",
+			config: &Config{
+				URL:       "https://youtube.com/watch?v=123",
+				OutputDir: ".",
+				LimitRate: "fast",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -78,3 +88,202 @@ func TestConfig_EnsureOutputDir(t *testing.T) {
 		t.Errorf("ensureOutputDir() failed to create directory")
 	}
 }
+
+func TestConfig_ValidateExtraArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		extraArgs []string
+		allowed   []string
+		wantErr   bool
+	}{
+		{"no extra args", nil, nil, false},
+		{"safe option with value", []string{"--retries", "3"}, nil, false},
+		{"safe option with equals", []string{"--sleep-interval=5"}, nil, false},
+		{"output override", []string{"--output", "x.mp4"}, nil, true},
+		{"short output override", []string{"-o/tmp/x"}, nil, true},
+		{"format override with equals", []string{"--format=bestaudio"}, nil, true},
+		{"exec", []string{"--exec", "rm -rf /"}, nil, true},
+		{"grouped short options", []string{"-io/tmp/x"}, nil, true},
+		{"attached short value", []string{"-Phome:/tmp"}, nil, true},
+		{"abbreviated denied option", []string{"--load-info", "x.json"}, nil, true},
+		{"abbreviated denied option with equals", []string{"--print-to-fil=x"}, nil, true},
+		{"option that is a prefix of a denied one", []string{"--print", "title"}, nil, false},
+		{"external downloader", []string{"--downloader", "evil"}, nil, true},
+		{"postprocessor args alias", []string{"--ppa", "ffmpeg:-i /etc/passwd"}, nil, true},
+		{"cookies", []string{"--cookies-from-browser", "firefox"}, nil, true},
+		{"end of options", []string{"--", "-o"}, nil, true},
+		{"no simulate", []string{"--no-simulate"}, nil, true},
+		{"allowed option", []string{"--retries", "3"}, []string{"--retries"}, false},
+		{"option outside allowlist", []string{"--embed-subs"}, []string{"--retries"}, true},
+		{"rate limit override", []string{"--limit-rate", "10M"}, nil, true},
+		{"short rate limit override", []string{"-r", "10M"}, nil, true},
+		{"throttled rate", []string{"--throttled-rate=100K"}, nil, true},
+		{"denied option in allowlist", []string{"--exec", "ls"}, []string{"--exec"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{ExtraArgs: tt.extraArgs, AllowedExtraArgs: tt.allowed}
+			err := cfg.validateExtraArgs()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateExtraArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"no selection", &Config{}, false},
+		{"items with playlist", &Config{Playlist: true, Items: "1-10,15,-3"}, false},
+		{"newest items", &Config{Playlist: true, Reverse: true, MaxItems: 5}, false},
+		{"items without playlist", &Config{Items: "1-3"}, true},
+		{"reverse and random", &Config{Playlist: true, Reverse: true, Random: true}, true},
+		{"negative max items", &Config{Playlist: true, MaxItems: -1}, true},
+		{"invalid items", &Config{Playlist: true, Items: "1-x"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateSelection()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSelection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Filter(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantNil bool
+		wantErr bool
+	}{
+		{"no filters", &Config{}, true, false},
+		{"durations", &Config{MinDuration: time.Minute, MaxDuration: 3 * time.Hour}, false, false},
+		{"dates", &Config{DateAfter: "2024-01-01", DateBefore: "20241231"}, false, false},
+		{"titles", &Config{MatchTitle: "(?i)episode", RejectTitle: "#shorts"}, false, false},
+		{"min views", &Config{MinViews: 1000}, false, false},
+		{"min longer than max", &Config{MinDuration: time.Hour, MaxDuration: time.Minute}, false, true},
+		{"invalid date", &Config{DateAfter: "tomorrow"}, false, true},
+		{"reversed dates", &Config{DateAfter: "20250101", DateBefore: "20240101"}, false, true},
+		{"invalid regex", &Config{MatchTitle: "("}, false, true},
+		{"negative views", &Config{MinViews: -1}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tt.config.Filter()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (f == nil) != tt.wantNil {
+				t.Errorf("Filter() = %v, wantNil %v", f, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateTab(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"videos tab", &Config{URL: "https://www.youtube.com/@example", Tab: "videos"}, false},
+		{"all tabs with latest", &Config{URL: "https://www.youtube.com/@example", Tab: "all", Latest: 5}, false},
+		{"unknown tab", &Config{URL: "https://www.youtube.com/@example", Tab: "community"}, true},
+		{"negative latest", &Config{URL: "https://www.youtube.com/@example", Tab: "videos", Latest: -1}, true},
+		{"latest without playlist", &Config{URL: "https://www.youtube.com/@example", Latest: 5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.OutputDir = t.TempDir()
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.config.Playlist {
+				t.Error("Validate() should enable playlist mode for channel tabs")
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1 << 20, false},
+		{"500K", 500 << 10, false},
+		{"2M", 2 << 20, false},
+		{"1.5m", 3 << 19, false},
+		{"1G", 1 << 30, false},
+		{"0", 0, false},
+		{"unlimited", 0, false},
+		{"", 0, true},
+		{"M", 0, true},
+		{"2MB", 0, true},
+		{"-1M", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		rate int64
+		want string
+	}{
+		{0, "unlimited"},
+		{512, "512"},
+		{500 << 10, "500K"},
+		{3 << 19, "1.5M"},
+		{1 << 30, "1G"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatRate(tt.rate); got != tt.want {
+			t.Errorf("FormatRate(%d) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	t.Run("override", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv(DATA_DIR_ENV, dir)
+		got, err := DataDir()
+		if err != nil || got != dir {
+			t.Errorf("DataDir() = %q, %v, want %q", got, err, dir)
+		}
+	})
+
+	t.Run("xdg", func(t *testing.T) {
+		t.Setenv(DATA_DIR_ENV, "")
+		t.Setenv("XDG_DATA_HOME", "/xdg")
+		got, err := DataDir()
+		if err != nil || got != "/xdg/drop-tube" {
+			t.Errorf("DataDir() = %q, %v, want /xdg/drop-tube", got, err)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DATA_DIR_ENV overrides the directory where drop-tube keeps its own state.
+const DATA_DIR_ENV = "DROP_TUBE_DATA_DIR"
+
+// DataDir returns the directory where drop-tube keeps its own state, such as
+// the subscription list. It is $DROP_TUBE_DATA_DIR if set, otherwise
+// $XDG_DATA_HOME/drop-tube or ~/.local/share/drop-tube.
+// The directory is not created.
+func DataDir() (string, error) {
+	if dir := os.Getenv(DATA_DIR_ENV); dir != "" {
+		return filepath.Abs(dir)
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "drop-tube"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine data directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "drop-tube"), nil
+}
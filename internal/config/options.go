@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// DownloadOptions are the options of a configuration that others than the
+// operator may set, such as API clients and watch folder sidecars: what to
+// download and how. Options naming files outside the output directory, such
+// as the output template, the download archive and the report, are left to
+// the operator.
+type DownloadOptions struct {
+	URL string `json:"url"`
+	// OutputDir is resolved against the operator's base directory and must
+	// stay inside it (see ResolveOutputDir).
+	OutputDir    string   `json:"output_dir"`
+	Format       string   `json:"format"`
+	Quality      string   `json:"quality"`
+	AudioOnly    bool     `json:"audio_only,omitempty"`
+	AudioFormat  string   `json:"audio_format"`
+	Playlist     bool     `json:"playlist,omitempty"`
+	Verbose      bool     `json:"verbose,omitempty"`
+	AbortOnError bool     `json:"abort_on_error,omitempty"`
+	ExtraArgs    []string `json:"extra_args,omitempty"`
+	LimitRate    string   `json:"limit_rate,omitempty"`
+
+	Items      string `json:"items,omitempty"`
+	Reverse    bool   `json:"reverse,omitempty"`
+	Random     bool   `json:"random,omitempty"`
+	MaxItems   int    `json:"max_items,omitempty"`
+	StartAfter string `json:"start_after,omitempty"`
+	Tab        string `json:"tab,omitempty"`
+	Latest     int    `json:"latest,omitempty"`
+
+	MinDuration time.Duration `json:"min_duration,omitempty"`
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	DateAfter   string        `json:"date_after,omitempty"`
+	DateBefore  string        `json:"date_before,omitempty"`
+	MatchTitle  string        `json:"match_title,omitempty"`
+	RejectTitle string        `json:"reject_title,omitempty"`
+	MinViews    int64         `json:"min_views,omitempty"`
+}
+
+// NewDownloadOptions returns the download options of cfg.
+func NewDownloadOptions(cfg *Config) DownloadOptions {
+	return DownloadOptions{
+		URL:          cfg.URL,
+		OutputDir:    cfg.OutputDir,
+		Format:       cfg.Format,
+		Quality:      cfg.Quality,
+		AudioOnly:    cfg.AudioOnly,
+		AudioFormat:  cfg.AudioFormat,
+		Playlist:     cfg.Playlist,
+		Verbose:      cfg.Verbose,
+		AbortOnError: cfg.AbortOnError,
+		ExtraArgs:    cfg.ExtraArgs,
+		LimitRate:    cfg.LimitRate,
+		Items:        cfg.Items,
+		Reverse:      cfg.Reverse,
+		Random:       cfg.Random,
+		MaxItems:     cfg.MaxItems,
+		StartAfter:   cfg.StartAfter,
+		Tab:          cfg.Tab,
+		Latest:       cfg.Latest,
+		MinDuration:  cfg.MinDuration,
+		MaxDuration:  cfg.MaxDuration,
+		DateAfter:    cfg.DateAfter,
+		DateBefore:   cfg.DateBefore,
+		MatchTitle:   cfg.MatchTitle,
+		RejectTitle:  cfg.RejectTitle,
+		MinViews:     cfg.MinViews,
+	}
+}
+
+// Apply sets the download options of cfg. Its other options are kept.
+func (r DownloadOptions) Apply(cfg *Config) {
+	cfg.URL = r.URL
+	cfg.OutputDir = r.OutputDir
+	cfg.Format = r.Format
+	cfg.Quality = r.Quality
+	cfg.AudioOnly = r.AudioOnly
+	cfg.AudioFormat = r.AudioFormat
+	cfg.Playlist = r.Playlist
+	cfg.Verbose = r.Verbose
+	cfg.AbortOnError = r.AbortOnError
+	cfg.ExtraArgs = r.ExtraArgs
+	cfg.LimitRate = r.LimitRate
+	cfg.Items = r.Items
+	cfg.Reverse = r.Reverse
+	cfg.Random = r.Random
+	cfg.MaxItems = r.MaxItems
+	cfg.StartAfter = r.StartAfter
+	cfg.Tab = r.Tab
+	cfg.Latest = r.Latest
+	cfg.MinDuration = r.MinDuration
+	cfg.MaxDuration = r.MaxDuration
+	cfg.DateAfter = r.DateAfter
+	cfg.DateBefore = r.DateBefore
+	cfg.MatchTitle = r.MatchTitle
+	cfg.RejectTitle = r.RejectTitle
+	cfg.MinViews = r.MinViews
+}
+
+// ResolveOutputDir resolves a job's output directory against baseDir and
+// rejects directories outside of it.
+func ResolveOutputDir(baseDir, dir string) (string, error) {
+	path := filepath.Clean(dir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("output directory %q is outside of %s", dir, baseDir)
+	}
+	return path, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rateUnits are the suffixes of download rates, in binary multiples like
+// yt-dlp's --limit-rate.
+var rateUnits = map[byte]float64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+}
+
+// ParseRate parses a download rate in bytes per second, such as "500K",
+// "2M" or "1.5M". A plain number is in bytes per second. "0" and
+// "unlimited" mean no limit and return 0.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "unlimited") {
+		return 0, nil
+	}
+
+	number, multiplier := s, 1.0
+	if s != "" {
+		if m, ok := rateUnits[strings.ToUpper(s[len(s)-1:])[0]]; ok {
+			number, multiplier = s[:len(s)-1], m
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q: must be a number of bytes per second with an optional K, M or G suffix", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// FormatRate formats a rate in bytes per second for display, or
+// "unlimited" for 0.
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	for _, unit := range []byte{'G', 'M', 'K'} {
+		if m := int64(rateUnits[unit]); rate >= m {
+			value := strconv.FormatFloat(float64(rate)/float64(m), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + string(unit)
+		}
+	}
+	return strconv.FormatInt(rate, 10)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// deniedExtraArgs lists yt-dlp options that must not be passed through,
+// either because drop-tube already controls them or because they can run
+// arbitrary commands, load code or read arbitrary files.
+var deniedExtraArgs = map[string]string{
+	"--":                         "ending the option list is not allowed",
+	"-o":                         "output is controlled by --output",
+	"--output":                   "output is controlled by --output",
+	"-P":                         "output is controlled by --output",
+	"--paths":                    "output is controlled by --output",
+	"-f":                         "format is controlled by --format and --quality",
+	"--format":                   "format is controlled by --format and --quality",
+	"-S":                         "format is controlled by --format and --quality",
+	"--format-sort":              "format is controlled by --format and --quality",
+	"-x":                         "audio extraction is controlled by --audio-only",
+	"--extract-audio":            "audio extraction is controlled by --audio-only",
+	"--audio-format":             "audio format is controlled by --audio-format",
+	"--yes-playlist":             "playlist mode is controlled by --playlist",
+	"--no-playlist":              "playlist mode is controlled by --playlist",
+	"-I":                         "playlist items are controlled by --items and --latest",
+	"--playlist-items":           "playlist items are controlled by --items and --latest",
+	"-i":                         "error handling is controlled by --abort-on-error",
+	"--ignore-errors":            "error handling is controlled by --abort-on-error",
+	"--no-ignore-errors":         "error handling is controlled by --abort-on-error",
+	"--abort-on-error":           "error handling is controlled by --abort-on-error",
+	"--no-abort-on-error":        "error handling is controlled by --abort-on-error",
+	"-r":                         "the download rate is controlled by --limit-rate and the daemon's --bandwidth",
+	"--limit-rate":               "the download rate is controlled by --limit-rate and the daemon's --bandwidth",
+	"--throttled-rate":           "the download rate is controlled by --limit-rate and the daemon's --bandwidth",
+	"--download-archive":         "the download archive is managed by drop-tube",
+	"--no-download-archive":      "the download archive is managed by drop-tube",
+	"-a":                         "batch files are not supported",
+	"--batch-file":               "batch files are not supported",
+	"--exec":                     "executing commands is not allowed",
+	"--exec-before-download":     "executing commands is not allowed",
+	"--config-location":          "loading yt-dlp config files is not allowed",
+	"--config-locations":         "loading yt-dlp config files is not allowed",
+	"--netrc-cmd":                "executing commands is not allowed",
+	"--load-info-json":           "loading info files is not allowed",
+	"--print-to-file":            "writing arbitrary files is not allowed",
+	"--update":                   "updating yt-dlp is not allowed",
+	"--update-to":                "updating yt-dlp is not allowed",
+	"-U":                         "updating yt-dlp is not allowed",
+	"--alias":                    "defining option aliases is not allowed",
+	"--downloader":               "external downloaders are not allowed",
+	"--external-downloader":      "external downloaders are not allowed",
+	"--downloader-args":          "external downloaders are not allowed",
+	"--external-downloader-args": "external downloaders are not allowed",
+	"--ffmpeg-location":          "executing commands is not allowed",
+	"--use-postprocessor":        "loading postprocessors is not allowed",
+	"--postprocessor-args":       "passing arguments to postprocessors is not allowed",
+	"--ppa":                      "passing arguments to postprocessors is not allowed",
+	"--plugin-dirs":              "loading plugins is not allowed",
+	"--cookies":                  "reading cookie files is not allowed",
+	"--cookies-from-browser":     "reading browser cookies is not allowed",
+	"--no-simulate":              "listings and dry runs must not download",
+}
+
+// completeOptions are yt-dlp options whose names are prefixes of denied
+// options. yt-dlp matches them exactly, so they are not abbreviations of
+// the denied options.
+var completeOptions = map[string]bool{
+	"--print": true,
+	"--netrc": true,
+}
+
+// validateExtraArgs checks the passthrough yt-dlp arguments against the
+// denylist and, when set, the allowlist.
+func (c *Config) validateExtraArgs() error {
+	allowed := make(map[string]bool, len(c.AllowedExtraArgs))
+	for _, name := range c.AllowedExtraArgs {
+		allowed[name] = true
+	}
+
+	for _, arg := range c.ExtraArgs {
+		name, err := extraArgName(arg)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if option, reason, ok := deniedOption(name); ok {
+			if option != name {
+				return fmt.Errorf("yt-dlp option %s (%s) is not allowed: %s", name, option, reason)
+			}
+			return fmt.Errorf("yt-dlp option %s is not allowed: %s", name, reason)
+		}
+		if len(allowed) > 0 && !allowed[name] {
+			return fmt.Errorf("yt-dlp option %s is not in the allowed list", name)
+		}
+	}
+	return nil
+}
+
+// extraArgName returns the option name of a passthrough argument
+// (e.g. "--limit-rate=1M" -> "--limit-rate"). It returns an empty string
+// for option values. Short options must stand alone: yt-dlp reads "-io/tmp"
+// as "-i -o /tmp", so grouped options and attached values are rejected.
+func extraArgName(arg string) (string, error) {
+	switch {
+	case strings.HasPrefix(arg, "--"):
+		name, _, _ := strings.Cut(arg, "=")
+		return name, nil
+	case strings.HasPrefix(arg, "-") && len(arg) > 2:
+		return "", fmt.Errorf("yt-dlp argument %s is not allowed: pass short options one at a time and their values as separate arguments", arg)
+	case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		return arg, nil
+	default:
+		return "", nil
+	}
+}
+
+// deniedOption returns the denied option that name stands for and why it
+// is denied. yt-dlp accepts any unambiguous prefix of a long option, so a
+// name that is a prefix of a denied option is denied as well.
+func deniedOption(name string) (option, reason string, denied bool) {
+	if reason, ok := deniedExtraArgs[name]; ok {
+		return name, reason, true
+	}
+	if !strings.HasPrefix(name, "--") || completeOptions[name] {
+		return "", "", false
+	}
+	for _, option := range slices.Sorted(maps.Keys(deniedExtraArgs)) {
+		if option != "--" && strings.HasPrefix(option, name) {
+			return option, deniedExtraArgs[option], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,200 @@
+package daemon
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+// weekdays maps day names to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// BandwidthRule limits the combined download rate of all running jobs during
+// a daily time window in local time.
+type BandwidthRule struct {
+	// Days are the days the window starts on. It is every day if empty.
+	Days []time.Weekday
+	// Start and End are the minutes after midnight the window starts and
+	// ends. A window whose end is before its start runs past midnight, and
+	// one whose start and end are equal lasts all day.
+	Start, End int
+	// Rate is the limit in bytes per second, 0 for unlimited.
+	Rate int64
+}
+
+// BandwidthSchedule is a list of rules. The first rule whose window
+// contains a time gives the limit at that time; outside all windows
+// downloads are unlimited.
+type BandwidthSchedule []BandwidthRule
+
+// ParseBandwidthSchedule parses rules of the form "[DAYS] [HH:MM-HH:MM]=RATE",
+// such as "mon-fri 09:00-18:00=1M", or a bare "RATE" for all day. DAYS is a
+// list of day names and ranges ("sat,sun"), and RATE a rate for
+// config.ParseRate.
+func ParseBandwidthSchedule(rules []string) (BandwidthSchedule, error) {
+	var schedule BandwidthSchedule
+	for _, s := range rules {
+		rule, err := parseBandwidthRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bandwidth rule %q: %w", s, err)
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, nil
+}
+
+// parseBandwidthRule parses a single rule.
+func parseBandwidthRule(s string) (BandwidthRule, error) {
+	var rule BandwidthRule
+	window, rate, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok {
+		window, rate = "", window
+	}
+	var err error
+	if rule.Rate, err = config.ParseRate(rate); err != nil {
+		return rule, err
+	}
+
+	fields := strings.Fields(window)
+	switch len(fields) {
+	case 0:
+		return rule, nil
+	case 1:
+		if !strings.Contains(fields[0], ":") {
+			rule.Days, err = parseDays(fields[0])
+			return rule, err
+		}
+	case 2:
+		if rule.Days, err = parseDays(fields[0]); err != nil {
+			return rule, err
+		}
+		fields = fields[1:]
+	default:
+		return rule, fmt.Errorf("expected [DAYS] [HH:MM-HH:MM]=RATE")
+	}
+
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return rule, fmt.Errorf("time window %q must be HH:MM-HH:MM", fields[0])
+	}
+	if rule.Start, err = parseClock(start); err != nil {
+		return rule, err
+	}
+	if rule.End, err = parseClock(end); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// parseDays parses a comma-separated list of day names and ranges.
+func parseDays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses HH:MM, or H:MM, into minutes after midnight. "24:00"
+// is midnight at the end of the day.
+func parseClock(s string) (int, error) {
+	invalid := fmt.Errorf("invalid time %q: must be HH:MM", s)
+	h, m, ok := strings.Cut(s, ":")
+	if !ok || len(h) < 1 || len(h) > 2 || len(m) != 2 || !isDigits(h) || !isDigits(m) {
+		return 0, invalid
+	}
+	hour, _ := strconv.Atoi(h)
+	minute, _ := strconv.Atoi(m)
+	if minute > 59 || hour*60+minute > 24*60 {
+		return 0, invalid
+	}
+	return (hour*60 + minute) % (24 * 60), nil
+}
+
+// isDigits reports whether s consists of ASCII digits only.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Limit returns the combined rate limit at t in bytes per second, or 0 if
+// downloads are unlimited.
+func (s BandwidthSchedule) Limit(t time.Time) int64 {
+	for _, rule := range s {
+		if rule.contains(t) {
+			return rule.Rate
+		}
+	}
+	return 0
+}
+
+// contains reports whether t is in the rule's window.
+func (r BandwidthRule) contains(t time.Time) bool {
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case r.Start == r.End:
+	case r.Start < r.End:
+		if minute < r.Start || minute >= r.End {
+			return false
+		}
+	case minute >= r.Start:
+	case minute < r.End:
+		// The window started the day before.
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return r.onDay(day)
+}
+
+// onDay reports whether the rule's window starts on day.
+func (r BandwidthRule) onDay(day time.Weekday) bool {
+	return len(r.Days) == 0 || slices.Contains(r.Days, day)
+}
+
+// shareRate returns the rate of one of jobs running jobs sharing the limit
+// evenly, capped by the job's own limit. 0 means unlimited.
+func shareRate(limit int64, jobs int, own int64) int64 {
+	if limit <= 0 || jobs <= 0 {
+		return own
+	}
+	share := max(limit/int64(jobs), 1)
+	if own > 0 && own < share {
+		return own
+	}
+	return share
+}
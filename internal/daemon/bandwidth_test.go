@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidthSchedule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    BandwidthRule
+		wantErr bool
+	}{
+		{"2M", BandwidthRule{Rate: 2 << 20}, false},
+		{"09:00-18:00=1M", BandwidthRule{Start: 540, End: 1080, Rate: 1 << 20}, false},
+		{"22:30-06:00=500K", BandwidthRule{Start: 1350, End: 360, Rate: 500 << 10}, false},
+		{"mon-fri 09:00-18:00=1M", BandwidthRule{Days: []time.Weekday{1, 2, 3, 4, 5}, Start: 540, End: 1080, Rate: 1 << 20}, false},
+		{"fri-mon 00:00-24:00=1M", BandwidthRule{Days: []time.Weekday{5, 6, 0, 1}, Rate: 1 << 20}, false},
+		{"sat,sun=unlimited", BandwidthRule{Days: []time.Weekday{6, 0}}, false},
+		{"09:00-18:00", BandwidthRule{}, true},
+		{"9-18=1M", BandwidthRule{}, true},
+		{"09:00-25:00=1M", BandwidthRule{}, true},
+		{"9:00-18:00=1M", BandwidthRule{Start: 540, End: 1080, Rate: 1 << 20}, false},
+		{"09:00x-18:00=1M", BandwidthRule{}, true},
+		{"9:0junk-18:00=1M", BandwidthRule{}, true},
+		{"09:00-18:0=1M", BandwidthRule{}, true},
+		{"09:00-18:000=1M", BandwidthRule{}, true},
+		{"+9:00-18:00=1M", BandwidthRule{}, true},
+		{"09:60-18:00=1M", BandwidthRule{}, true},
+		{"09:00-24:01=1M", BandwidthRule{}, true},
+		{"009:00-18:00=1M", BandwidthRule{}, true},
+		{"someday 09:00-18:00=1M", BandwidthRule{}, true},
+		{"mon 09:00-18:00 extra=1M", BandwidthRule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseBandwidthSchedule([]string{tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidthSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			r := got[0]
+			if r.Start != tt.want.Start || r.End != tt.want.End || r.Rate != tt.want.Rate || !slices.Equal(r.Days, tt.want.Days) {
+				t.Errorf("ParseBandwidthSchedule() = %+v, want %+v", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestBandwidthSchedule_Limit(t *testing.T) {
+	schedule, err := ParseBandwidthSchedule([]string{
+		"sat,sun=unlimited",
+		"09:00-18:00=1M",
+		"fri 22:00-02:00=100K",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-10-16 is a Friday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want int64
+	}{
+		{"working hours", at(16, 9, 0), 1 << 20},
+		{"end of working hours", at(16, 18, 0), 0},
+		{"friday night", at(16, 23, 0), 100 << 10},
+		{"past midnight", at(17, 1, 59), 0},
+		{"weekend", at(17, 12, 0), 0},
+		{"thursday night", at(15, 23, 0), 0},
+		{"monday", at(19, 17, 59), 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.Limit(tt.t); got != tt.want {
+				t.Errorf("Limit(%s) = %d, want %d", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShareRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64
+		jobs  int
+		own   int64
+		want  int64
+	}{
+		{"unlimited", 0, 2, 0, 0},
+		{"own limit without schedule", 0, 2, 500, 500},
+		{"single job", 1000, 1, 0, 1000},
+		{"divided", 1000, 4, 0, 250},
+		{"own limit below share", 1000, 2, 100, 100},
+		{"own limit above share", 1000, 2, 800, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shareRate(tt.limit, tt.jobs, tt.own); got != tt.want {
+				t.Errorf("shareRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
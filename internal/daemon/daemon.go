@@ -0,0 +1,452 @@
+// Package daemon runs queued download jobs in the background.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+const (
+	DEFAULT_WORKERS       = 1
+	DEFAULT_POLL_INTERVAL = 2 * time.Second
+)
+
+// rebalanceDelay is how long the daemon waits after jobs start or finish
+// before restarting running jobs at their new share of the bandwidth, so
+// that jobs starting together cause a single restart.
+const rebalanceDelay = 5 * time.Second
+
+// Options controls how the daemon runs jobs.
+type Options struct {
+	// Workers is the number of jobs run at the same time.
+	Workers int
+	// MaxPerSite limits the jobs downloading from the same site, such as
+	// youtube.com, at the same time if it is positive. Queued jobs of other
+	// sites are started instead, even if their priority is lower.
+	MaxPerSite int
+	// SiteLimits overrides MaxPerSite for individual sites.
+	SiteLimits map[string]int
+	// Bandwidth limits the combined download rate of the running jobs and
+	// shared downloads by time of day. The limit is divided evenly among
+	// them, and they are restarted at their new rate when jobs or shared
+	// downloads start or finish and when the limit changes. yt-dlp continues
+	// their partial downloads.
+	Bandwidth BandwidthSchedule
+	// AfterDownload is run for every video downloaded by a job if set. A
+	// job whose hook fails a video is marked as failed.
+	AfterDownload downloader.Hook
+	// AllowedExtraArgs restricts the passthrough yt-dlp options of jobs to
+	// the listed ones when non-empty. Jobs passing other options fail.
+	AllowedExtraArgs []string
+	// PollInterval is how often the queue directory is checked for jobs
+	// submitted by other processes.
+	PollInterval time.Duration
+	// OnProgress receives the download progress of running jobs. When it is
+	// set, no progress bars are drawn.
+	OnProgress func(jobID string, p downloader.Progress)
+}
+
+var (
+	// errPaused and errCancelled stop a running job as the cause of its
+	// context's cancellation.
+	errPaused    = errors.New("job paused")
+	errCancelled = errors.New("job cancelled")
+	// errRateChanged restarts the download of a running job at a new rate.
+	errRateChanged = errors.New("download rate changed")
+)
+
+// Daemon runs the jobs of a queue.
+type Daemon struct {
+	queue   *queue.Queue
+	options Options
+
+	// mu guards running and makes claiming a job and registering it atomic,
+	// so that a job is always either in the queue's hands or in running.
+	mu      sync.Mutex
+	running map[string]*runningJob
+	// shared holds the downloads of RunShared by their names.
+	shared map[*runningJob]string
+
+	// rebalance is signalled when jobs start or finish.
+	rebalance chan struct{}
+}
+
+// runningJob is a job being downloaded by a worker, or a download of
+// RunShared.
+type runningJob struct {
+	site string
+	// own is the job's own rate limit and rate the limit of its download,
+	// its share of the bandwidth. 0 means unlimited. rate and restart are
+	// guarded by Daemon.mu.
+	own  int64
+	rate int64
+	// restart interrupts the current download with errRateChanged.
+	restart context.CancelCauseFunc
+	stop    context.CancelCauseFunc
+	// done is closed once the outcome of the job is recorded.
+	done chan struct{}
+}
+
+// New creates a Daemon for the queue. Zero options use the defaults.
+func New(q *queue.Queue, opts Options) *Daemon {
+	if opts.Workers <= 0 {
+		opts.Workers = DEFAULT_WORKERS
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	return &Daemon{queue: q, options: opts, running: make(map[string]*runningJob), shared: make(map[*runningJob]string), rebalance: make(chan struct{}, 1)}
+}
+
+// Run resumes jobs left running by an earlier daemon and runs queued jobs
+// until ctx is cancelled. Jobs interrupted by the cancellation are put back
+// in the queue and resumed by the next run.
+func (d *Daemon) Run(ctx context.Context) error {
+	recovered, err := d.queue.Recover()
+	if err != nil {
+		return err
+	}
+	for _, id := range recovered {
+		log.Printf("resuming interrupted job %s", id)
+	}
+
+	var wg sync.WaitGroup
+	if len(d.options.Bandwidth) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.balance(ctx)
+		}()
+	}
+	for range d.options.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-ticker.C:
+			if err := d.queue.Reload(); err != nil {
+				log.Printf("failed to reload queue: %v", err)
+			}
+		}
+	}
+}
+
+// Pause stops a running job, keeping its partially downloaded files so that
+// it continues where it stopped when it is resumed, or holds a queued job.
+func (d *Daemon) Pause(id string) (queue.Job, error) {
+	d.mu.Lock()
+	if r, ok := d.running[id]; ok {
+		d.mu.Unlock()
+		return d.stop(id, r, errPaused)
+	}
+	defer d.mu.Unlock()
+	return d.queue.Pause(id)
+}
+
+// Resume puts a paused job back in the queue. Its partial downloads are
+// continued.
+func (d *Daemon) Resume(id string) (queue.Job, error) {
+	return d.queue.Resume(id)
+}
+
+// Cancel stops a running job or cancels a queued or paused one, and removes
+// the partially downloaded files of the interrupted video. Files of videos
+// that were completed are kept.
+func (d *Daemon) Cancel(id string) (queue.Job, error) {
+	d.mu.Lock()
+	if r, ok := d.running[id]; ok {
+		d.mu.Unlock()
+		return d.stop(id, r, errCancelled)
+	}
+	job, err := d.queue.Cancel(id)
+	d.mu.Unlock()
+	if err != nil {
+		return job, err
+	}
+	removePartialFiles(job, job.Results)
+	return job, nil
+}
+
+// stop interrupts a running job and waits until its worker has recorded the
+// outcome.
+func (d *Daemon) stop(id string, r *runningJob, cause error) (queue.Job, error) {
+	r.stop(cause)
+	<-r.done
+	return d.queue.Get(id)
+}
+
+// work claims and runs jobs until ctx is cancelled.
+func (d *Daemon) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		job, ok, err := d.queue.ClaimFunc(d.allowed)
+		var r *runningJob
+		var jobCtx context.Context
+		if ok {
+			var stop context.CancelCauseFunc
+			jobCtx, stop = context.WithCancelCause(ctx)
+			r = &runningJob{site: youtubeurl.Site(job.Config.URL), stop: stop, done: make(chan struct{})}
+			r.own, _ = job.Config.Rate()
+			d.running[job.ID] = r
+			r.rate = shareRate(d.options.Bandwidth.Limit(time.Now()), d.active(), r.own)
+		}
+		d.mu.Unlock()
+
+		if err != nil {
+			log.Printf("failed to claim job: %v", err)
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+			case <-d.queue.Wake():
+			case <-time.After(d.options.PollInterval):
+			}
+			continue
+		}
+
+		d.signalRebalance()
+		d.runJob(ctx, jobCtx, job, r)
+
+		d.mu.Lock()
+		delete(d.running, job.ID)
+		d.mu.Unlock()
+		r.stop(nil)
+		close(r.done)
+		d.signalRebalance()
+	}
+}
+
+// RunShared runs a download outside of the queue, such as a subscription
+// sync, at a share of the bandwidth like a job's: download is called with
+// the rate to download at, 0 for unlimited, and called again with the new
+// rate whenever the share changes, continuing where it was interrupted.
+// own is the download's own rate limit. RunShared returns download's error
+// once it finishes or ctx is cancelled.
+func (d *Daemon) RunShared(ctx context.Context, name string, own int64, download func(ctx context.Context, rate int64) error) error {
+	r := &runningJob{own: own}
+	d.mu.Lock()
+	d.shared[r] = name
+	r.rate = shareRate(d.options.Bandwidth.Limit(time.Now()), d.active(), own)
+	d.mu.Unlock()
+	d.signalRebalance()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.shared, r)
+		d.mu.Unlock()
+		d.signalRebalance()
+	}()
+	return d.downloadAtShare(ctx, name, r, download)
+}
+
+// active returns the number of running jobs and shared downloads. The
+// caller holds d.mu.
+func (d *Daemon) active() int {
+	return len(d.running) + len(d.shared)
+}
+
+// signalRebalance makes the daemon recalculate the download rates of the
+// running jobs.
+func (d *Daemon) signalRebalance() {
+	select {
+	case d.rebalance <- struct{}{}:
+	default:
+	}
+}
+
+// balance keeps the download rates of the running jobs at their share of
+// the bandwidth until ctx is cancelled. The rates are recalculated when
+// jobs start or finish and every minute for changes of the limit.
+func (d *Daemon) balance(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.rebalance:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(rebalanceDelay):
+			}
+		}
+		d.applyBandwidth(time.Now())
+	}
+}
+
+// applyBandwidth restarts the running jobs and shared downloads whose share
+// of the bandwidth at now differs from the rate they are downloading at.
+func (d *Daemon) applyBandwidth(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	limit := d.options.Bandwidth.Limit(now)
+	apply := func(name string, r *runningJob) {
+		rate := shareRate(limit, d.active(), r.own)
+		if rate == r.rate {
+			return
+		}
+		log.Printf("%s: download rate %s -> %s", name, config.FormatRate(r.rate), config.FormatRate(rate))
+		r.rate = rate
+		if r.restart != nil {
+			r.restart(errRateChanged)
+		}
+	}
+	for id, r := range d.running {
+		apply("job "+id, r)
+	}
+	for r, name := range d.shared {
+		apply(name, r)
+	}
+}
+
+// allowed reports whether the job's site is below its limit of running
+// jobs. The caller holds d.mu.
+func (d *Daemon) allowed(job queue.Job) bool {
+	site := youtubeurl.Site(job.Config.URL)
+	limit, ok := d.options.SiteLimits[site]
+	if !ok {
+		limit = d.options.MaxPerSite
+	}
+	if limit <= 0 {
+		return true
+	}
+	running := 0
+	for _, r := range d.running {
+		if r.site == site {
+			running++
+		}
+	}
+	return running < limit
+}
+
+// runJob downloads a claimed job and records its outcome. jobCtx is
+// cancelled with errPaused or errCancelled to stop the job, and together
+// with ctx when the daemon stops. The download is restarted when the rate
+// of r changes.
+func (d *Daemon) runJob(ctx, jobCtx context.Context, job queue.Job, r *runningJob) {
+	log.Printf("starting job %s: %s", job.ID, job.Config.URL)
+
+	job.Config.AllowedExtraArgs = d.options.AllowedExtraArgs
+	if err := job.Config.Validate(); err != nil {
+		log.Printf("job %s failed: %v", job.ID, err)
+		if err := d.queue.Complete(job.ID, nil, fmt.Errorf("configuration validation failed: %w", err)); err != nil {
+			log.Printf("failed to record outcome of job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	var results []downloader.Result
+	runErr := d.downloadAtShare(jobCtx, "job "+job.ID, r, func(ctx context.Context, rate int64) error {
+		report, err := d.download(ctx, job, rate)
+		if report != nil {
+			results = downloader.ContinueResults(results, report.Results)
+		}
+		return err
+	})
+
+	// A job that finished before it could be stopped is recorded as usual.
+	if runErr != nil {
+		switch cause := context.Cause(jobCtx); {
+		case errors.Is(cause, errPaused):
+			log.Printf("job %s paused", job.ID)
+			if err := d.queue.Stop(job.ID, queue.STATE_PAUSED, results); err != nil {
+				log.Printf("failed to pause job %s: %v", job.ID, err)
+			}
+			return
+		case errors.Is(cause, errCancelled):
+			log.Printf("job %s cancelled", job.ID)
+			removePartialFiles(job, results)
+			if err := d.queue.Stop(job.ID, queue.STATE_CANCELLED, results); err != nil {
+				log.Printf("failed to cancel job %s: %v", job.ID, err)
+			}
+			return
+		}
+	}
+
+	if runErr != nil && ctx.Err() != nil {
+		log.Printf("job %s interrupted, requeued: %v", job.ID, runErr)
+		if err := d.queue.Stop(job.ID, queue.STATE_QUEUED, results); err != nil {
+			log.Printf("failed to requeue job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	if runErr != nil {
+		log.Printf("job %s failed: %v", job.ID, runErr)
+	} else {
+		log.Printf("job %s done", job.ID)
+	}
+	if err := d.queue.Complete(job.ID, results, runErr); err != nil {
+		log.Printf("failed to record outcome of job %s: %v", job.ID, err)
+	}
+}
+
+// downloadAtShare runs download at the rate of r and restarts it whenever
+// the rate changes, until it finishes or ctx is cancelled.
+func (d *Daemon) downloadAtShare(ctx context.Context, name string, r *runningJob, download func(ctx context.Context, rate int64) error) error {
+	for {
+		d.mu.Lock()
+		rate := r.rate
+		attemptCtx, restart := context.WithCancelCause(ctx)
+		r.restart = restart
+		d.mu.Unlock()
+
+		err := download(attemptCtx, rate)
+		restarted := err != nil && ctx.Err() == nil && errors.Is(context.Cause(attemptCtx), errRateChanged)
+		restart(nil)
+		if !restarted {
+			return err
+		}
+		log.Printf("%s: restarting download at the new rate", name)
+	}
+}
+
+// download runs a job's download at the given rate, 0 for unlimited.
+func (d *Daemon) download(ctx context.Context, job queue.Job, rate int64) (*downloader.Report, error) {
+	cfg := job.Config
+	cfg.LimitRate = ""
+	if rate > 0 {
+		cfg.LimitRate = strconv.FormatInt(rate, 10)
+	}
+	dl := downloader.New(&cfg)
+	dl.SetContext(ctx)
+	dl.AfterDownload(d.options.AfterDownload)
+	if d.options.OnProgress != nil {
+		dl.OnProgress(func(p downloader.Progress) { d.options.OnProgress(job.ID, p) })
+	}
+	return dl.Download()
+}
+
+// removePartialFiles removes the partial downloads a job's interrupted run
+// left behind.
+func removePartialFiles(job queue.Job, results []downloader.Result) {
+	removed, err := downloader.RemovePartialFiles(job.Config.OutputDir, results)
+	for _, path := range removed {
+		log.Printf("job %s: removed partial file %s", job.ID, path)
+	}
+	if err != nil {
+		log.Printf("job %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,445 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+// fakeYtDlp installs a shell script named yt-dlp at the front of PATH.
+func fakeYtDlp(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake yt-dlp: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+const fakeVideoScript = `
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*private*)
+	echo "ERROR: [youtube] private: Private video"
+	exit 1
+	;;
+*)
+	echo "[download] 100% of 1.00MiB"
+	;;
+esac
+`
+
+func addJob(t *testing.T, q *queue.Queue, url string) queue.Job {
+	t.Helper()
+	cfg := config.NewConfig()
+	cfg.URL = url
+	cfg.OutputDir = t.TempDir()
+	job, err := q.Add(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// waitFinished waits until the queue holds n jobs and all of them are finished.
+func waitFinished(t *testing.T, q *queue.Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		jobs := q.List()
+		finished := len(jobs) == n
+		for _, job := range jobs {
+			finished = finished && job.Finished()
+		}
+		if finished {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("jobs did not finish: %+v", q.List())
+}
+
+func TestDaemon_Run(t *testing.T) {
+	fakeYtDlp(t, fakeVideoScript)
+
+	dir := t.TempDir()
+	q, err := queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := addJob(t, q, "https://www.youtube.com/watch?v=ok")
+	failing := addJob(t, q, "https://www.youtube.com/watch?v=private")
+
+	// A job left running by an earlier daemon is resumed.
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- New(q, Options{Workers: 2, PollInterval: 50 * time.Millisecond}).Run(ctx) }()
+
+	// Jobs submitted by other processes are picked up from the directory.
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/watch?v=submitted"
+	cfg.OutputDir = t.TempDir()
+	submitted, err := queue.Submit(dir, *cfg, queue.AddOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFinished(t, q, 3)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	tests := []struct {
+		id       string
+		state    queue.State
+		attempts int
+	}{
+		{ok.ID, queue.STATE_DONE, 2},
+		{failing.ID, queue.STATE_FAILED, 1},
+		{submitted.ID, queue.STATE_DONE, 1},
+	}
+	for _, tt := range tests {
+		job, err := q.Get(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State != tt.state || job.Attempts != tt.attempts {
+			t.Errorf("job %s = %s after %d attempts, want %s after %d (error %q)",
+				job.Config.URL, job.State, job.Attempts, tt.state, tt.attempts, job.Error)
+		}
+	}
+}
+
+func TestDaemon_AllowedExtraArgs(t *testing.T) {
+	fakeYtDlp(t, fakeVideoScript)
+
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(extraArgs ...string) queue.Job {
+		cfg := config.NewConfig()
+		cfg.URL = "https://www.youtube.com/watch?v=ok"
+		cfg.OutputDir = t.TempDir()
+		cfg.ExtraArgs = extraArgs
+		job, err := q.Add(*cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	allowed := add("--embed-subs")
+	other := add("--write-comments")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- New(q, Options{AllowedExtraArgs: []string{"--embed-subs"}, PollInterval: 50 * time.Millisecond}).Run(ctx)
+	}()
+	waitFinished(t, q, 2)
+	cancel()
+	<-done
+
+	if job, _ := q.Get(allowed.ID); job.State != queue.STATE_DONE {
+		t.Errorf("job with an allowed option = %s (%s), want done", job.State, job.Error)
+	}
+	if job, _ := q.Get(other.ID); job.State != queue.STATE_FAILED || !strings.Contains(job.Error, "not in the allowed list") {
+		t.Errorf("job with another option = %s (%s), want failed", job.State, job.Error)
+	}
+}
+
+// fakeResumableScript downloads until it is interrupted, leaving a partial
+// file behind, and completes the partial file when run again.
+const fakeResumableScript = `
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*)
+	echo "[download] Destination: video.mp4"
+	if [ -f video.mp4.part ]; then
+		echo "[download] 100% of 1.00MiB"
+		mv video.mp4.part video.mp4
+		exit 0
+	fi
+	trap 'exit 130' INT
+	touch video.mp4.part
+	echo "[download]  10.0% of 1.00MiB"
+	sleep 10 >/dev/null 2>&1 &
+	wait
+	;;
+esac
+`
+
+func TestDaemon_PauseResumeCancel(t *testing.T) {
+	fakeYtDlp(t, fakeResumableScript)
+
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan string, 100)
+	d := New(q, Options{PollInterval: 50 * time.Millisecond, OnProgress: func(id string, p downloader.Progress) {
+		if p.Percent > 0 && p.Percent < 100 {
+			started <- id
+		}
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// waitStarted waits for the job's download to make progress, ignoring
+	// late updates of earlier jobs.
+	waitStarted := func(id string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case got := <-started:
+				if got == id {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("job %s did not start", id)
+			}
+		}
+	}
+
+	job := addJob(t, q, "https://www.youtube.com/watch?v=a")
+	waitStarted(job.ID)
+	paused, err := d.Pause(job.ID)
+	if err != nil || paused.State != queue.STATE_PAUSED || len(paused.Results) != 1 || paused.Results[0].Status != downloader.STATUS_ABORTED {
+		t.Fatalf("Pause() = %+v, %v, want a paused job with an aborted result", paused, err)
+	}
+	partial := filepath.Join(job.Config.OutputDir, "video.mp4.part")
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("partial file of the paused job was removed: %v", err)
+	}
+
+	// The resumed job continues the partial download.
+	if _, err := d.Resume(job.ID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	waitFinished(t, q, 1)
+	if resumed, _ := q.Get(job.ID); resumed.State != queue.STATE_DONE || resumed.Attempts != 2 {
+		t.Errorf("resumed job = %s after %d attempts, want done after 2", resumed.State, resumed.Attempts)
+	}
+	if _, err := os.Stat(filepath.Join(job.Config.OutputDir, "video.mp4")); err != nil {
+		t.Errorf("resumed job did not complete the download: %v", err)
+	}
+
+	// Cancelling a running job removes its partial files.
+	job = addJob(t, q, "https://www.youtube.com/watch?v=b")
+	waitStarted(job.ID)
+	cancelled, err := d.Cancel(job.ID)
+	if err != nil || cancelled.State != queue.STATE_CANCELLED {
+		t.Fatalf("Cancel() = %+v, %v, want a cancelled job", cancelled, err)
+	}
+	if _, err := os.Stat(filepath.Join(job.Config.OutputDir, "video.mp4.part")); !os.IsNotExist(err) {
+		t.Errorf("partial file of the cancelled job was kept: %v", err)
+	}
+
+	if _, err := d.Pause(job.ID); err == nil {
+		t.Error("Pause() of a cancelled job should fail")
+	}
+}
+
+func TestDaemon_Allowed(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(q, Options{Workers: 4, MaxPerSite: 2, SiteLimits: map[string]int{"vimeo.com": 1, "example.com": 0}})
+	d.running = map[string]*runningJob{
+		"a": {site: "youtube.com"},
+		"b": {site: "youtube.com"},
+		"c": {site: "vimeo.com"},
+		"d": {site: "example.com"},
+	}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://youtu.be/a", false},
+		{"https://vimeo.com/1", false},
+		{"https://www.example.com/video", true},
+		{"https://dailymotion.com/video/1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			job := queue.Job{Config: config.Config{URL: tt.url}}
+			if got := d.allowed(job); got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaemon_ApplyBandwidth(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := ParseBandwidthSchedule([]string{"09:00-18:00=1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(q, Options{Workers: 2, Bandwidth: schedule})
+
+	restarted := make(map[string]bool)
+	job := func(id string, own, rate int64) *runningJob {
+		return &runningJob{own: own, rate: rate, restart: func(cause error) {
+			if !errors.Is(cause, errRateChanged) {
+				t.Errorf("job %s restarted with %v", id, cause)
+			}
+			restarted[id] = true
+		}}
+	}
+	d.running = map[string]*runningJob{
+		"a": job("a", 0, 1000),
+		"b": job("b", 100, 100),
+	}
+
+	day := time.Date(2026, 10, 19, 10, 0, 0, 0, time.Local)
+	d.applyBandwidth(day)
+	if !restarted["a"] || restarted["b"] {
+		t.Errorf("restarted = %v, want only a", restarted)
+	}
+	if d.running["a"].rate != 500 || d.running["b"].rate != 100 {
+		t.Errorf("rates = %d, %d, want 500, 100", d.running["a"].rate, d.running["b"].rate)
+	}
+
+	clear(restarted)
+	d.applyBandwidth(day.Add(9 * time.Hour))
+	if !restarted["a"] || restarted["b"] || d.running["a"].rate != 0 {
+		t.Errorf("after hours: restarted = %v, rate of a = %d, want a restarted unlimited", restarted, d.running["a"].rate)
+	}
+}
+
+func TestDaemon_RunShared(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := ParseBandwidthSchedule([]string{"1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(q, Options{Bandwidth: schedule})
+	d.running = map[string]*runningJob{"a": {rate: 1000, restart: func(error) {}}}
+
+	rates := make(chan int64)
+	finish := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- d.RunShared(context.Background(), "sync", 0, func(ctx context.Context, rate int64) error {
+			rates <- rate
+			select {
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			case <-finish:
+				return nil
+			}
+		})
+	}()
+
+	if rate := <-rates; rate != 500 {
+		t.Errorf("shared download started at %d, want half of the limit", rate)
+	}
+	d.applyBandwidth(time.Now())
+	if rate := d.running["a"].rate; rate != 500 {
+		t.Errorf("rate of the running job = %d, want it to share the limit", rate)
+	}
+
+	d.mu.Lock()
+	delete(d.running, "a")
+	d.mu.Unlock()
+	d.applyBandwidth(time.Now())
+	if rate := <-rates; rate != 1000 {
+		t.Errorf("shared download restarted at %d, want the whole limit", rate)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Errorf("RunShared() error = %v", err)
+	}
+	if len(d.shared) != 0 {
+		t.Errorf("shared downloads after RunShared() = %v, want none", d.shared)
+	}
+}
+
+func TestDaemon_RestartAtNewRate(t *testing.T) {
+	fakeYtDlp(t, `case "$*" in *--version*) ;; *) echo "$*" >> args.log ;; esac
+`+fakeResumableScript)
+
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan string, 100)
+	d := New(q, Options{PollInterval: 50 * time.Millisecond, OnProgress: func(id string, p downloader.Progress) {
+		if p.Percent > 0 && p.Percent < 100 {
+			started <- id
+		}
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	job := addJob(t, q, "https://www.youtube.com/watch?v=a")
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("job did not start")
+	}
+
+	d.mu.Lock()
+	d.options.Bandwidth = BandwidthSchedule{{Rate: 1000}}
+	d.mu.Unlock()
+	d.applyBandwidth(time.Now())
+
+	waitFinished(t, q, 1)
+	got, _ := q.Get(job.ID)
+	if got.State != queue.STATE_DONE || got.Attempts != 1 || len(got.Results) != 1 || got.Results[0].Status != downloader.STATUS_DOWNLOADED {
+		t.Errorf("job = %s after %d attempts with %+v, want done after 1 with one download", got.State, got.Attempts, got.Results)
+	}
+
+	data, err := os.ReadFile(filepath.Join(job.Config.OutputDir, "args.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(runs) != 2 || strings.Contains(runs[0], "--limit-rate") || !strings.Contains(runs[1], "--limit-rate 1000") {
+		t.Errorf("yt-dlp runs = %q, want an unlimited run and one at 1000 bytes/s", runs)
+	}
+}
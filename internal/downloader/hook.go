@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+)
+
+// hookBacklog is how many downloaded videos may wait for their hook before
+// reading yt-dlp's output, and with it the download, is held up.
+const hookBacklog = 64
+
+// Hook is run for every video once it is downloaded, such as the
+// post-download hooks of the hooks package. An error marks the video as
+// failed.
+type Hook func(ctx context.Context, r Result) error
+
+// AfterDownload registers fn to be run for every downloaded video. Videos
+// are handed to fn one at a time in the order they finish, while the next
+// ones are downloaded; the run waits for fn before it returns. fn is not
+// stopped when the run is interrupted.
+func (d *Downloader) AfterDownload(fn Hook) {
+	d.afterDownload = fn
+}
+
+// hookRunner runs the after-download hook in the background and remembers
+// which results it failed for.
+type hookRunner struct {
+	hook    Hook
+	ctx     context.Context
+	pending chan indexedResult
+	done    chan struct{}
+	// failures is written by the hook's goroutine and read once it is done.
+	failures map[int]error
+}
+
+// indexedResult is a result and its position among the tracker's results.
+type indexedResult struct {
+	index  int
+	result Result
+}
+
+// startHooks starts running the hook of the downloader, or returns nil if
+// none is registered.
+func (d *Downloader) startHooks() *hookRunner {
+	if d.afterDownload == nil {
+		return nil
+	}
+	h := &hookRunner{
+		hook:     d.afterDownload,
+		ctx:      context.WithoutCancel(d.ctx),
+		pending:  make(chan indexedResult, hookBacklog),
+		done:     make(chan struct{}),
+		failures: make(map[int]error),
+	}
+	go func() {
+		defer close(h.done)
+		for item := range h.pending {
+			if err := h.hook(h.ctx, item.result); err != nil {
+				h.failures[item.index] = err
+			}
+		}
+	}()
+	return h
+}
+
+// add queues a downloaded result, the index-th result of the tracker.
+func (h *hookRunner) add(index int, r Result) {
+	h.pending <- indexedResult{index: index, result: r}
+}
+
+// wait waits for the queued results and marks the results the hook failed
+// for as failed. results are the tracker's results.
+func (h *hookRunner) wait(results []Result) {
+	close(h.pending)
+	<-h.done
+	for i, err := range h.failures {
+		if i < len(results) {
+			results[i].Status = STATUS_FAILED
+			results[i].Reason = fmt.Sprintf("post-download hook failed: %v", err)
+			results[i].Transient = false
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+// ErrIncompleteListing is returned with the entries of the other channel tabs
+// when some of the selected tabs could not be listed.
+var ErrIncompleteListing = errors.New("some channel tabs could not be listed")
+
+// fetchEntries lists the videos behind the configured URL without downloading them.
+// Flat listings are used unless full metadata is required, e.g. for upload dates.
+// When a channel tab is configured, the entries of every selected tab are
+// combined. If only some tabs could be listed, e.g. with TAB_ALL and a channel
+// without shorts, the entries of the others are returned with an error
+// wrapping ErrIncompleteListing.
+func (d *Downloader) fetchEntries(full bool) ([]playlist.Entry, error) {
+	urls, err := d.listURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []playlist.Entry{}
+	seen := make(map[string]bool)
+	var errs []error
+	for _, u := range urls {
+		tabEntries, err := d.fetchURLEntries(u, full)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, e := range tabEntries {
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			e.Index = len(entries) + 1
+			entries = append(entries, e)
+		}
+	}
+
+	if len(errs) == len(urls) {
+		return nil, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		return entries, fmt.Errorf("%w: %w", ErrIncompleteListing, errors.Join(errs...))
+	}
+	return entries, nil
+}
+
+// listURLs returns the URLs to list, which are the channel tab URLs if a tab
+// is configured.
+func (d *Downloader) listURLs() ([]string, error) {
+	cleaned := d.cleanURL(d.config.URL)
+	if d.config.Tab == "" {
+		return []string{cleaned}, nil
+	}
+
+	urls, err := youtubeurl.ChannelTabURLs(cleaned, d.config.Tab)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel tab: %w", err)
+	}
+	return urls, nil
+}
+
+// fetchURLEntries lists the videos behind a single URL.
+func (d *Downloader) fetchURLEntries(u string, full bool) ([]playlist.Entry, error) {
+	args := []string{"--dump-single-json"}
+	if !full {
+		args = append(args, "--flat-playlist")
+	}
+	if d.config.Playlist {
+		args = append(args, "--yes-playlist")
+	} else {
+		args = append(args, "--no-playlist")
+	}
+	if d.config.Latest > 0 {
+		// Channel tabs list the newest uploads first.
+		args = append(args, "--playlist-items", fmt.Sprintf("1:%d", d.config.Latest))
+	}
+	// Passthrough arguments are left out so that listings never download.
+	args = append(args, u)
+
+	if d.config.Verbose {
+		log.Printf("executing: yt-dlp %s", strings.Join(args, " "))
+	}
+
+	out, err := d.command(args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("failed to fetch metadata for %s: %w: %s", u, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to fetch metadata for %s: %w", u, err)
+	}
+
+	return playlist.Parse(out)
+}
+
+// selectEntries lists the videos and applies the configured item selection and
+// filters. It returns the entries to download and the skipped entries. Channel
+// tabs that could not be listed are ignored.
+func (d *Downloader) selectEntries() ([]playlist.Entry, []playlist.Skipped, error) {
+	entries, err := d.ListEntries()
+	if errors.Is(err, ErrIncompleteListing) {
+		if d.config.Verbose {
+			log.Printf("ignoring unavailable channel tabs: %v", err)
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return d.SelectEntries(entries)
+}
+
+// ListEntries lists the videos behind the configured URL without downloading
+// them. Full metadata is fetched when the configured filters need it. If some
+// channel tabs could not be listed, the entries of the others are returned
+// with an error wrapping ErrIncompleteListing.
+func (d *Downloader) ListEntries() ([]playlist.Entry, error) {
+	sel, err := d.selection()
+	if err != nil {
+		return nil, err
+	}
+	return d.fetchEntries(sel.Filter.NeedsUploadDate())
+}
+
+// SelectEntries applies the configured item selection and filters to the
+// entries. It returns the entries to download and the skipped entries.
+func (d *Downloader) SelectEntries(entries []playlist.Entry) ([]playlist.Entry, []playlist.Skipped, error) {
+	sel, err := d.selection()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected, skipped, err := playlist.Select(entries, sel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to select playlist items: %w", err)
+	}
+
+	if d.config.Verbose {
+		log.Printf("selected %d of %d items, %d skipped by filters", len(selected), len(entries), len(skipped))
+	}
+	return selected, skipped, nil
+}
+
+// selection returns the playlist item selection and filter from the configuration.
+func (d *Downloader) selection() (playlist.Selection, error) {
+	filter, err := d.config.Filter()
+	if err != nil {
+		return playlist.Selection{}, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	return playlist.Selection{
+		Items:      d.config.Items,
+		Reverse:    d.config.Reverse,
+		Random:     d.config.Random,
+		MaxItems:   d.config.MaxItems,
+		StartAfter: d.config.StartAfter,
+		Filter:     filter,
+	}, nil
+}
+
+// entryURLs returns the download URL of each entry.
+func entryURLs(entries []playlist.Entry) []string {
+	urls := make([]string, 0, len(entries))
+	for i := range entries {
+		urls = append(urls, entries[i].VideoURL())
+	}
+	return urls
+}
+
+// ChannelID returns the ID of the channel behind the configured URL. URLs
+// that carry the ID are resolved locally; handles and custom URLs are
+// resolved through yt-dlp.
+func (d *Downloader) ChannelID() (string, error) {
+	cleaned := d.cleanURL(d.config.URL)
+	if id, ok := youtubeurl.ChannelID(cleaned); ok {
+		return id, nil
+	}
+
+	args := []string{"--dump-single-json", "--flat-playlist", "--playlist-items", "1", cleaned}
+	if d.config.Verbose {
+		log.Printf("executing: yt-dlp %s", strings.Join(args, " "))
+	}
+	out, err := d.command(args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve channel ID of %s: %w", cleaned, err)
+	}
+
+	var info struct {
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("failed to parse yt-dlp metadata: %w", err)
+	}
+	if info.ChannelID == "" {
+		return "", fmt.Errorf("yt-dlp did not report a channel ID for %s", cleaned)
+	}
+	return info.ChannelID, nil
+}
@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+const fakeChannelTabsScript = `
+case "$*" in
+*/videos*)
+	echo '{"_type": "playlist", "entries": [{"id": "v1", "title": "Video 1"}, {"id": "v2", "title": "Video 2"}]}'
+	;;
+*/streams*)
+	case "$*" in
+	*"--playlist-items 1:1"*) echo '{"_type": "playlist", "entries": [{"id": "s1", "title": "Stream 1"}]}' ;;
+	*) echo '{"_type": "playlist", "entries": [{"id": "s1", "title": "Stream 1"}, {"id": "v2", "title": "Video 2"}]}' ;;
+	esac
+	;;
+*)
+	echo "ERROR: [youtube:tab] This channel does not have a tab" >&2
+	exit 1
+	;;
+esac
+`
+
+func TestFetchEntries_ChannelTabs(t *testing.T) {
+	tests := []struct {
+		name       string
+		tab        string
+		latest     int
+		want       []string
+		incomplete bool
+		wantErr    bool
+	}{
+		{"single tab", "streams", 0, []string{"s1", "v2"}, false, false},
+		{"all tabs report missing ones", "all", 0, []string{"v1", "v2", "s1"}, true, false},
+		{"latest", "streams", 1, []string{"s1"}, false, false},
+		{"missing tab", "shorts", 0, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeYtDlp(t, fakeChannelTabsScript)
+
+			cfg := config.NewConfig()
+			cfg.URL = "https://www.youtube.com/@example"
+			cfg.Playlist = true
+			cfg.Tab = tt.tab
+			cfg.Latest = tt.latest
+
+			entries, err := New(cfg).fetchEntries(false)
+			if errors.Is(err, ErrIncompleteListing) != tt.incomplete {
+				t.Errorf("fetchEntries() error = %v, want incomplete listing %v", err, tt.incomplete)
+			}
+			if tt.incomplete {
+				err = nil
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			ids := []string{}
+			for i, e := range entries {
+				ids = append(ids, e.ID)
+				if e.Index != i+1 {
+					t.Errorf("entry %s index = %d, want %d", e.ID, e.Index, i+1)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("fetchEntries() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelID(t *testing.T) {
+	fakeYtDlp(t, `echo '{"_type": "playlist", "id": "UCtab", "channel_id": "UC123", "entries": []}'`)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/channel/UC456/videos", "UC456"},
+		{"https://www.youtube.com/@example", "UC123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			cfg := config.NewConfig()
+			cfg.URL = tt.url
+			got, err := New(cfg).ChannelID()
+			if err != nil || got != tt.want {
+				t.Errorf("ChannelID() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
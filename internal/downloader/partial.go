@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// formatIDRegex matches the format ID yt-dlp puts in the names of formats
+// downloaded separately for merging.
+var formatIDRegex = regexp.MustCompile(`^\.f\d[\w-]*$`)
+
+// RemovePartialFiles removes the incomplete files yt-dlp left behind for
+// the aborted results of an interrupted run: partial downloads, their
+// fragments and resume state. Files of completed videos are kept. Relative
+// result paths are resolved against dir. It returns the removed files.
+func RemovePartialFiles(dir string, results []Result) ([]string, error) {
+	var removed []string
+	var errs []error
+	for _, res := range results {
+		if res.Status != STATUS_ABORTED || res.Path == "" {
+			continue
+		}
+		path := res.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		// Formats downloaded separately for merging are named like
+		// "title.f137.mp4", so everything starting with the title belongs
+		// to the video.
+		stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if formatIDRegex.MatchString(filepath.Ext(stem)) {
+			stem = strings.TrimSuffix(stem, filepath.Ext(stem))
+		}
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, stem+".") || !isPartialFile(name) {
+				continue
+			}
+			file := filepath.Join(filepath.Dir(path), name)
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", file, err))
+				continue
+			}
+			removed = append(removed, file)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// isPartialFile reports whether name is an incomplete yt-dlp download.
+func isPartialFile(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.Contains(name, ".part-Frag") ||
+		strings.HasSuffix(name, ".ytdl") || strings.Contains(name, ".temp.")
+}
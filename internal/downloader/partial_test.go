@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRemovePartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"First.f137.mp4.part", "First.f137.mp4.part-Frag3", "First.f137.mp4.ytdl", "First.f251.webm.part",
+		"Second.mp4", "Third.mp4.part", "First Again.mp4.part",
+	}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := []Result{
+		{ID: "a", Status: STATUS_ABORTED, Path: "First.f137.mp4"},
+		{ID: "b", Status: STATUS_DOWNLOADED, Path: "Second.mp4"},
+		{ID: "c", Status: STATUS_FAILED, Path: filepath.Join(dir, "Third.mp4")},
+		{ID: "d", Status: STATUS_ABORTED},
+	}
+	removed, err := RemovePartialFiles(dir, results)
+	if err != nil {
+		t.Fatalf("RemovePartialFiles() error = %v", err)
+	}
+	if len(removed) != 4 {
+		t.Errorf("RemovePartialFiles() removed %v, want the 4 partial files of the aborted video", removed)
+	}
+
+	var left []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	want := []string{"First Again.mp4.part", "Second.mp4", "Third.mp4.part"}
+	if !slices.Equal(left, want) {
+		t.Errorf("files left = %v, want %v", left, want)
+	}
+}
@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// Plan describes what a download run would do.
+type Plan struct {
+	URL       string             `json:"url"`
+	OutputDir string             `json:"output_dir"`
+	Command   []string           `json:"command"`
+	Items     []PlanItem         `json:"items"`
+	Skipped   []playlist.Skipped `json:"skipped"`
+}
+
+// PlanItem is a video that would be downloaded, with its target file name.
+type PlanItem struct {
+	playlist.Entry
+	Filename string `json:"filename"`
+}
+
+// Plan resolves the videos and target file names for the configured URL
+// without downloading any media.
+func (d *Downloader) Plan() (*Plan, error) {
+	selected, skipped, err := d.selectEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		URL:       d.cleanURL(d.config.URL),
+		OutputDir: d.config.OutputDir,
+		Command:   append([]string{"yt-dlp"}, append(d.buildOptionArgs(), entryURLs(selected)...)...),
+		Items:     make([]PlanItem, 0, len(selected)),
+		Skipped:   skipped,
+	}
+	if len(selected) == 0 {
+		return plan, nil
+	}
+
+	filenames, err := d.resolveFilenames(selected)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range selected {
+		plan.Items = append(plan.Items, PlanItem{Entry: e, Filename: filenames[e.ID]})
+	}
+	return plan, nil
+}
+
+// dryRun prints the plan instead of downloading.
+func (d *Downloader) dryRun() error {
+	plan, err := d.Plan()
+	if err != nil {
+		return fmt.Errorf("failed to build download plan: %w", err)
+	}
+
+	if d.config.JSON {
+		return plan.WriteJSON(os.Stdout)
+	}
+	plan.Print(os.Stdout)
+	return nil
+}
+
+// resolveFilenames asks yt-dlp for the target file name of each entry,
+// keyed by video ID. Entries whose metadata cannot be fetched are omitted.
+// Passthrough arguments are left out so that a dry run never downloads.
+func (d *Downloader) resolveFilenames(entries []playlist.Entry) (map[string]string, error) {
+	args := append(d.buildSimulateArgs(), "--ignore-errors", "--print", "id", "--print", "filename")
+	args = append(args, entryURLs(entries)...)
+
+	if d.config.Verbose {
+		log.Printf("executing: yt-dlp %s", strings.Join(args, " "))
+	}
+
+	cmd := d.command(args...)
+	cmd.Dir = d.config.OutputDir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if d.config.Verbose {
+		cmd.Stderr = os.Stderr
+	}
+	// With --ignore-errors a non-zero exit only means some entries are
+	// unavailable; those are reported by their missing file names.
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		return nil, fmt.Errorf("failed to resolve file names: %w", err)
+	}
+
+	return d.parseFilenames(&stdout), nil
+}
+
+// parseFilenames parses alternating id and filename lines printed by yt-dlp.
+func (d *Downloader) parseFilenames(r io.Reader) map[string]string {
+	filenames := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		filenames[id] = d.finalFilename(strings.TrimSpace(scanner.Text()))
+	}
+	return filenames
+}
+
+// finalFilename adjusts a file name for post-processing, e.g. audio extraction
+// changes the extension to the configured audio format.
+func (d *Downloader) finalFilename(name string) string {
+	if d.config.AudioOnly && d.config.AudioFormat != "" {
+		return strings.TrimSuffix(name, filepath.Ext(name)) + "." + d.config.AudioFormat
+	}
+	return name
+}
+
+// Print writes the plan in a human readable form.
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintln(w, "dry run: no media files will be written")
+	fmt.Fprintf(w, "url: %s\n", p.URL)
+	fmt.Fprintf(w, "output: %s\n", p.OutputDir)
+	fmt.Fprintf(w, "command: %s\n", strings.Join(p.Command, " "))
+
+	fmt.Fprintf(w, "items (%d):\n", len(p.Items))
+	for _, item := range p.Items {
+		fmt.Fprintf(w, "  #%d [%s] %s\n", item.Index, item.ID, item.Title)
+		if item.Filename != "" {
+			fmt.Fprintf(w, "      -> %s\n", item.Filename)
+		} else {
+			fmt.Fprintln(w, "      -> (unavailable)")
+		}
+	}
+
+	if len(p.Skipped) > 0 {
+		fmt.Fprintf(w, "skipped (%d):\n", len(p.Skipped))
+		for _, s := range p.Skipped {
+			fmt.Fprintf(w, "  #%d [%s] %s: %s\n", s.Index, s.ID, s.Title, s.Reason)
+		}
+	}
+}
+
+// WriteJSON writes the plan as indented JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return nil
+}
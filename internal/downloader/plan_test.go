@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// fakeYtDlp installs a shell script named yt-dlp at the front of PATH.
+func fakeYtDlp(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake yt-dlp: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+const fakePlaylistScript = `
+case "$*" in
+*--dump-single-json*)
+	cat <<'JSON'
+{"_type": "playlist", "id": "PL1", "entries": [
+	{"id": "a", "title": "Episode 1", "url": "https://www.youtube.com/watch?v=a", "duration": 600},
+	{"id": "b", "title": "Short", "url": "https://www.youtube.com/watch?v=b", "duration": 30},
+	{"id": "c", "title": "Episode 2", "url": "https://www.youtube.com/watch?v=c", "duration": 900}
+]}
+JSON
+	;;
+*--print*)
+	printf 'a\n/out/Episode 1.webm\nc\n/out/Episode 2.webm\n'
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+func TestPlan(t *testing.T) {
+	fakeYtDlp(t, fakePlaylistScript)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = t.TempDir()
+	cfg.Playlist = true
+	cfg.Reverse = true
+	cfg.MinDuration = time.Minute
+
+	plan, err := New(cfg).Plan()
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+
+	if len(plan.Items) != 2 || plan.Items[0].ID != "c" || plan.Items[1].ID != "a" {
+		t.Fatalf("Plan() items = %+v, want c then a", plan.Items)
+	}
+	if plan.Items[0].Filename != "/out/Episode 2.webm" {
+		t.Errorf("Plan() filename = %q, want /out/Episode 2.webm", plan.Items[0].Filename)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].ID != "b" {
+		t.Errorf("Plan() skipped = %+v, want b", plan.Skipped)
+	}
+	if last := plan.Command[len(plan.Command)-1]; last != "https://www.youtube.com/watch?v=a" {
+		t.Errorf("Plan() command ends with %q, want the last selected item", last)
+	}
+
+	entries, _ := os.ReadDir(cfg.OutputDir)
+	if len(entries) != 0 {
+		t.Errorf("Plan() wrote %d files to the output directory", len(entries))
+	}
+}
+
+func TestSimulate_NoExtraArgs(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	fakeYtDlp(t, `echo "$*" >> "`+calls+`"
+echo '{"_type": "playlist", "id": "PL1", "entries": []}'
+`)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = t.TempDir()
+	cfg.Playlist = true
+	cfg.ExtraArgs = []string{"--no-simulate"}
+	dl := New(cfg)
+
+	if _, err := dl.fetchEntries(false); err != nil {
+		t.Fatalf("fetchEntries() error = %v", err)
+	}
+	if _, err := dl.resolveFilenames([]playlist.Entry{{ID: "a", URL: "https://www.youtube.com/watch?v=a"}}); err != nil {
+		t.Fatalf("resolveFilenames() error = %v", err)
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("yt-dlp was run %d times, want 2: %q", len(lines), data)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "--no-simulate") {
+			t.Errorf("simulated command got the passthrough arguments: %s", line)
+		}
+	}
+}
+
+func TestResolveFilenames_Context(t *testing.T) {
+	fakeYtDlp(t, "sleep 10\n")
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/watch?v=a"
+	cfg.OutputDir = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dl := New(cfg)
+	dl.SetContext(ctx)
+
+	start := time.Now()
+	if _, err := dl.resolveFilenames([]playlist.Entry{{ID: "a", URL: cfg.URL}}); err == nil {
+		t.Error("resolveFilenames() with a cancelled context should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("resolveFilenames() took %s after the context was cancelled", elapsed)
+	}
+}
+
+func TestPlan_Output(t *testing.T) {
+	plan := &Plan{
+		URL:     "https://www.youtube.com/playlist?list=PL1",
+		Command: []string{"yt-dlp", "--no-playlist"},
+		Items:   []PlanItem{{Filename: "/out/a.mp4"}},
+	}
+	plan.Items[0].ID = "a"
+
+	var text bytes.Buffer
+	plan.Print(&text)
+	if !strings.Contains(text.String(), "/out/a.mp4") || !strings.Contains(text.String(), "[a]") {
+		t.Errorf("Print() = %q, want item id and file name", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := plan.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON() produced invalid JSON: %v", err)
+	}
+	if len(decoded.Items) != 1 || decoded.Items[0].Filename != "/out/a.mp4" {
+		t.Errorf("WriteJSON() items = %+v", decoded.Items)
+	}
+}
+
+func TestFinalFilename(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AudioOnly = true
+	cfg.AudioFormat = "mp3"
+
+	if got := New(cfg).finalFilename("/out/song.webm"); got != "/out/song.mp3" {
+		t.Errorf("finalFilename() = %v, want /out/song.mp3", got)
+	}
+}
@@ -0,0 +1,308 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// progressBarWidth is the width of the rendered progress bars.
+const progressBarWidth = 40
+
+// maxTitleWidth is the number of title characters shown next to a progress bar.
+const maxTitleWidth = 60
+
+// alreadyDoneReason is the skip reason for videos yt-dlp did not download again.
+const alreadyDoneReason = "already downloaded"
+
+// Progress regex patterns for yt-dlp output
+var (
+	progressRegex    = regexp.MustCompile(`\[download\]\s+(\d+(?:\.\d+)?)%`)
+	itemRegex        = regexp.MustCompile(`\[download\] Downloading (?:item|video) (\d+) of (\d+)`)
+	extractRegex     = regexp.MustCompile(`^\[[\w:]+\] Extracting URL: (\S+)`)
+	alreadyDoneRegex = regexp.MustCompile(`^\[download\] (.*) has already been (?:downloaded|recorded in the archive)`)
+	errorRegex       = regexp.MustCompile(`^ERROR: (.*)`)
+	videoIDRegex     = regexp.MustCompile(`^\[[\w:]+\] ([\w-]+): Downloading`)
+	destinationRegex = regexp.MustCompile(`^\[(?:download|ExtractAudio)\] Destination: (.+)$`)
+	mergerRegex      = regexp.MustCompile(`^\[Merger\] Merging formats into "(.+)"$`)
+)
+
+// Progress is a snapshot of the progress of a download run.
+type Progress struct {
+	Item      int     `json:"item"`
+	Total     int     `json:"total"`
+	ID        string  `json:"id,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Percent   float64 `json:"percent"`
+	Succeeded int     `json:"succeeded"`
+	Skipped   int     `json:"skipped"`
+	Failed    int     `json:"failed"`
+}
+
+// itemOutcome is what happened to the current item so far.
+type itemOutcome struct {
+	id     string
+	path   string
+	status Status
+	reason string
+}
+
+// progressTracker follows yt-dlp output and keeps track of the current item,
+// its download percentage and the number of finished items per status.
+type progressTracker struct {
+	mu       sync.Mutex
+	entries  []playlist.Entry
+	progress Progress
+	current  *itemOutcome
+	finished []Result
+	native   bool
+	// interrupted is set when the run was stopped before yt-dlp finished.
+	interrupted bool
+	onUpdate    func(Progress)
+	// onFinished receives every downloaded video and its position in the
+	// results. It is called with the tracker locked.
+	onFinished func(index int, r Result)
+}
+
+// newProgressTracker creates a tracker for the given entries. Entries already
+// skipped before running yt-dlp are counted as skipped.
+func newProgressTracker(entries []playlist.Entry, skipped int) *progressTracker {
+	total := len(entries)
+	if total == 0 {
+		total = 1
+	}
+	return &progressTracker{
+		entries:  entries,
+		progress: Progress{Total: total, Skipped: skipped},
+	}
+}
+
+// handleLine updates the progress from a single line of yt-dlp output.
+func (t *progressTracker) handleLine(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case itemRegex.MatchString(line):
+		matches := itemRegex.FindStringSubmatch(line)
+		item, _ := strconv.Atoi(matches[1])
+		total, _ := strconv.Atoi(matches[2])
+		if !t.native {
+			// Anything before the first item line was the playlist itself.
+			t.current = nil
+			t.native = true
+		}
+		t.progress.Total = total
+		t.startItem(item)
+	case extractRegex.MatchString(line):
+		if t.native {
+			return
+		}
+		t.startItem(t.progress.Item + 1)
+	case alreadyDoneRegex.MatchString(line):
+		t.ensureItem()
+		t.current.status = STATUS_SKIPPED
+		t.current.reason = alreadyDoneReason
+		t.current.path = alreadyDoneRegex.FindStringSubmatch(line)[1]
+	case errorRegex.MatchString(line):
+		t.ensureItem()
+		t.current.status = STATUS_FAILED
+		t.current.reason = errorRegex.FindStringSubmatch(line)[1]
+	case destinationRegex.MatchString(line):
+		t.ensureItem()
+		t.current.path = destinationRegex.FindStringSubmatch(line)[1]
+		return
+	case mergerRegex.MatchString(line):
+		t.ensureItem()
+		t.current.path = mergerRegex.FindStringSubmatch(line)[1]
+		return
+	case videoIDRegex.MatchString(line):
+		t.ensureItem()
+		if t.current.id == "" {
+			t.current.id = videoIDRegex.FindStringSubmatch(line)[1]
+		}
+		return
+	case progressRegex.MatchString(line):
+		percent, err := strconv.ParseFloat(progressRegex.FindStringSubmatch(line)[1], 64)
+		if err != nil {
+			return
+		}
+		t.ensureItem()
+		t.progress.Percent = percent
+	default:
+		return
+	}
+	t.notify()
+}
+
+// finish records the outcome of the last item.
+func (t *progressTracker) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finishItem()
+	t.notify()
+}
+
+// interrupt marks the current item as aborted because the run was stopped.
+func (t *progressTracker) interrupt() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.interrupted = true
+	if t.current != nil && t.current.status == STATUS_DOWNLOADED {
+		t.current.status = STATUS_ABORTED
+		t.current.reason = interruptedReason
+	}
+}
+
+// snapshot returns the current progress.
+func (t *progressTracker) snapshot() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.progress
+}
+
+// ensureItem starts the first item if output arrives before any item boundary.
+func (t *progressTracker) ensureItem() {
+	if t.current == nil {
+		t.startItem(max(t.progress.Item, 1))
+	}
+}
+
+// startItem finishes the current item and starts the given one.
+func (t *progressTracker) startItem(item int) {
+	t.finishItem()
+
+	t.current = &itemOutcome{status: STATUS_DOWNLOADED}
+	t.progress.Item = item
+	t.progress.Percent = 0
+	t.progress.ID = ""
+	t.progress.Title = ""
+	if !t.native && item >= 1 && item <= len(t.entries) {
+		t.progress.ID = t.entries[item-1].ID
+		t.progress.Title = t.entries[item-1].Title
+	}
+}
+
+// results returns the outcome of every item seen so far, followed by the
+// entries yt-dlp never reached.
+func (t *progressTracker) results() []Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	results := append([]Result{}, t.finished...)
+	reason := abortedReason
+	if t.interrupted {
+		reason = interruptedReason
+	}
+	if !t.native {
+		for i := t.progress.Item; i < len(t.entries); i++ {
+			results = append(results, newResult(&t.entries[i], STATUS_ABORTED, reason))
+		}
+	}
+	return results
+}
+
+// finishItem counts and records the outcome of the current item.
+func (t *progressTracker) finishItem() {
+	if t.current == nil {
+		return
+	}
+
+	result := Result{ID: t.current.id}
+	if !t.native && t.progress.Item >= 1 && t.progress.Item <= len(t.entries) {
+		result = newResult(&t.entries[t.progress.Item-1], "", "")
+	}
+	result.Status = t.current.status
+	result.Reason = t.current.reason
+	result.Path = t.current.path
+	result.Transient = result.Status == STATUS_FAILED && isTransient(result.Reason)
+	t.finished = append(t.finished, result)
+
+	switch t.current.status {
+	case STATUS_FAILED:
+		t.progress.Failed++
+	case STATUS_SKIPPED:
+		t.progress.Skipped++
+	case STATUS_ABORTED:
+	default:
+		t.progress.Succeeded++
+		t.progress.Percent = 100
+		if t.onFinished != nil {
+			t.onFinished(len(t.finished)-1, result)
+		}
+	}
+	t.current = nil
+}
+
+// notify reports the current progress to the update callback.
+func (t *progressTracker) notify() {
+	if t.onUpdate != nil {
+		t.onUpdate(t.progress)
+	}
+}
+
+// newSingleBar renders progress for a single video as one progress bar.
+func newSingleBar() (func(Progress), func()) {
+	bar := progressbar.NewOptions(100,
+		progressbar.OptionSetDescription("downloading video..."),
+		progressbar.OptionSetWidth(50),
+		progressbar.OptionShowCount())
+
+	update := func(p Progress) {
+		bar.Set(int(p.Percent))
+	}
+	return update, func() { bar.Finish() }
+}
+
+// playlistBar renders an overall bar and the current item's bar on two lines.
+type playlistBar struct {
+	w     io.Writer
+	drawn bool
+}
+
+// render redraws both bars in place.
+func (b *playlistBar) render(p Progress) {
+	if b.drawn {
+		fmt.Fprint(b.w, "\033[1A")
+	}
+	fmt.Fprintf(b.w, "\r\033[K%s\n\r\033[K%s", overallLine(p), itemLine(p))
+	b.drawn = true
+}
+
+// finish moves the cursor below the bars.
+func (b *playlistBar) finish() {
+	if b.drawn {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// overallLine renders the playlist position and per-status counts.
+func overallLine(p Progress) string {
+	done := float64(max(p.Item-1, 0)) + p.Percent/100
+	return fmt.Sprintf("item %d/%d %s %d ok, %d skipped, %d failed",
+		p.Item, p.Total, renderBar(done/float64(max(p.Total, 1))), p.Succeeded, p.Skipped, p.Failed)
+}
+
+// itemLine renders the current item's download percentage and title.
+func itemLine(p Progress) string {
+	title := []rune(p.Title)
+	if len(title) > maxTitleWidth {
+		title = append(title[:maxTitleWidth-1], '…')
+	}
+	return fmt.Sprintf("%5.1f%% %s %s", p.Percent, renderBar(p.Percent/100), string(title))
+}
+
+// renderBar renders a fraction between 0 and 1 as a fixed width bar.
+func renderBar(fraction float64) string {
+	filled := int(min(max(fraction, 0), 1) * progressBarWidth)
+	return "|" + strings.Repeat("█", filled) + strings.Repeat(" ", progressBarWidth-filled) + "|"
+}
@@ -0,0 +1,120 @@
+package downloader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+func TestProgressTracker_MultipleURLs(t *testing.T) {
+	entries := []playlist.Entry{
+		{Index: 1, ID: "a", Title: "First"},
+		{Index: 2, ID: "b", Title: "Second"},
+		{Index: 3, ID: "c", Title: "Third"},
+	}
+	tracker := newProgressTracker(entries, 2)
+
+	var updates []Progress
+	tracker.onUpdate = func(p Progress) { updates = append(updates, p) }
+
+	lines := []string{
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=a",
+		"[youtube] a: Downloading webpage",
+		"[download]  42.0% of 10.00MiB at 1.00MiB/s ETA 00:06",
+		"[download] 100% of 10.00MiB in 00:00:10",
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=b",
+		"ERROR: [youtube] b: Private video. Sign in if you've been granted access to this video",
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=c",
+		"[download] /out/Third.mp4 has already been downloaded",
+	}
+
+	for i, line := range lines {
+		tracker.handleLine(line)
+		if i == 2 {
+			p := tracker.snapshot()
+			if p.Item != 1 || p.ID != "a" || p.Percent != 42 {
+				t.Errorf("after progress line: %+v, want item 1 (a) at 42%%", p)
+			}
+		}
+	}
+
+	p := tracker.snapshot()
+	if p.Item != 3 || p.Title != "Third" {
+		t.Errorf("current item = %d %q, want 3 Third", p.Item, p.Title)
+	}
+
+	tracker.finish()
+	p = tracker.snapshot()
+	if p.Succeeded != 1 || p.Failed != 1 || p.Skipped != 3 {
+		t.Errorf("counts = %d ok, %d failed, %d skipped, want 1, 1, 3", p.Succeeded, p.Failed, p.Skipped)
+	}
+	if len(updates) == 0 {
+		t.Error("onUpdate was never called")
+	}
+}
+
+func TestProgressTracker_NativePlaylist(t *testing.T) {
+	tracker := newProgressTracker(nil, 0)
+
+	lines := []string{
+		"[youtube:tab] Extracting URL: https://www.youtube.com/playlist?list=PL1",
+		"[download] Downloading playlist: Example",
+		"[download] Downloading item 1 of 42",
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=a",
+		"[download]  10.0% of 10.00MiB",
+		"[download] Downloading item 2 of 42",
+		"[youtube] Extracting URL: https://www.youtube.com/watch?v=b",
+	}
+	for _, line := range lines {
+		tracker.handleLine(line)
+	}
+
+	p := tracker.snapshot()
+	if p.Item != 2 || p.Total != 42 || p.Succeeded != 1 {
+		t.Errorf("progress = %+v, want item 2/42 with 1 succeeded", p)
+	}
+}
+
+func TestPlaylistBar_Render(t *testing.T) {
+	var out bytes.Buffer
+	bar := &playlistBar{w: &out}
+
+	bar.render(Progress{Item: 7, Total: 42, Title: "Episode", Percent: 50, Succeeded: 5, Skipped: 1})
+	bar.render(Progress{Item: 7, Total: 42, Title: "Episode", Percent: 60, Succeeded: 5, Skipped: 1})
+	bar.finish()
+
+	text := out.String()
+	if !strings.Contains(text, "item 7/42") || !strings.Contains(text, "5 ok, 1 skipped, 0 failed") {
+		t.Errorf("render() = %q, want overall position and counts", text)
+	}
+	if !strings.Contains(text, " 60.0% ") || !strings.Contains(text, "Episode") {
+		t.Errorf("render() = %q, want current item percent and title", text)
+	}
+	if strings.Count(text, "\033[1A") != 1 {
+		t.Errorf("render() should move the cursor up only when redrawing")
+	}
+}
+
+func TestRenderBar(t *testing.T) {
+	tests := []struct {
+		name     string
+		fraction float64
+		filled   int
+	}{
+		{"empty", 0, 0},
+		{"half", 0.5, progressBarWidth / 2},
+		{"full", 1, progressBarWidth},
+		{"over", 1.5, progressBarWidth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bar := renderBar(tt.fraction)
+			if got := strings.Count(bar, "█"); got != tt.filled {
+				t.Errorf("renderBar(%v) filled = %d, want %d", tt.fraction, got, tt.filled)
+			}
+		})
+	}
+}
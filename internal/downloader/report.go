@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+// ErrPartialFailure is returned when a run finished but some videos failed.
+var ErrPartialFailure = errors.New("some videos failed")
+
+// Report is the end-of-run summary with the outcome of every video.
+// It records the effective configuration so that failures can be retried.
+type Report struct {
+	URL        string         `json:"url"`
+	Config     *config.Config `json:"config,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Results    []Result       `json:"results"`
+}
+
+// newReport creates an empty report for a run starting now.
+func newReport(url string, cfg *config.Config) *Report {
+	return &Report{
+		URL:       url,
+		Config:    cfg,
+		StartedAt: time.Now(),
+		Results:   []Result{},
+	}
+}
+
+// ReadReport reads a JSON report written by a previous run.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// Retryable returns the results that failed with a transient error or were
+// never attempted.
+func (r *Report) Retryable() []Result {
+	retryable := []Result{}
+	for _, res := range r.Results {
+		if res.Status == STATUS_ABORTED || (res.Status == STATUS_FAILED && res.Transient) {
+			retryable = append(retryable, res)
+		}
+	}
+	return retryable
+}
+
+// merge returns a copy of the report with the results of a later run
+// replacing the results for the same videos.
+func (r *Report) merge(later *Report) *Report {
+	updated := make(map[string]Result, len(later.Results))
+	for _, res := range later.Results {
+		updated[res.ID] = res
+	}
+
+	merged := *r
+	merged.StartedAt = later.StartedAt
+	merged.Results = make([]Result, 0, len(r.Results))
+	for _, res := range r.Results {
+		if u, ok := updated[res.ID]; ok {
+			res = u
+		}
+		merged.Results = append(merged.Results, res)
+	}
+	return &merged
+}
+
+// Count returns the number of results with the given status.
+func (r *Report) Count(status Status) int {
+	count := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// PrintTable writes the per-status counts and a table of all results.
+func (r *Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "summary: %d downloaded, %d skipped, %d failed, %d aborted\n",
+		r.Count(STATUS_DOWNLOADED), r.Count(STATUS_SKIPPED), r.Count(STATUS_FAILED), r.Count(STATUS_ABORTED))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tID\tTITLE\tREASON")
+	for _, res := range r.Results {
+		reason := res.Reason
+		if res.Status == STATUS_FAILED && !res.Transient {
+			reason += " (permanent)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Status, res.ID, res.Title, reason)
+	}
+	tw.Flush()
+}
+
+// WriteFile writes the report to path, as CSV if the file name ends in
+// ".csv" and as JSON otherwise.
+func (r *Report) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = r.writeCSV(f)
+	} else {
+		err = r.writeJSON(f)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// writeJSON writes the report as indented JSON.
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeCSV writes one row per result.
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"status", "id", "title", "url", "reason", "transient", "path"})
+	for _, res := range r.Results {
+		cw.Write([]string{string(res.Status), res.ID, res.Title, res.URL, res.Reason, strconv.FormatBool(res.Transient), res.Path})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,292 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+func testReport() *Report {
+	report := newReport("https://www.youtube.com/playlist?list=PL1", config.NewConfig())
+	report.Results = []Result{
+		{ID: "a", Title: "First", Status: STATUS_DOWNLOADED, Path: "/out/First.mp4"},
+		{ID: "b", Title: "Second", Status: STATUS_FAILED, Reason: "Private video"},
+		{ID: "c", Title: "Third", Status: STATUS_SKIPPED, Reason: "title matches \"#shorts\""},
+	}
+	return report
+}
+
+func TestReport_Count(t *testing.T) {
+	report := testReport()
+
+	if got := report.Count(STATUS_FAILED); got != 1 {
+		t.Errorf("Count(failed) = %d, want 1", got)
+	}
+	if got := report.Count(STATUS_ABORTED); got != 0 {
+		t.Errorf("Count(aborted) = %d, want 0", got)
+	}
+}
+
+func TestReport_PrintTable(t *testing.T) {
+	var out bytes.Buffer
+	testReport().PrintTable(&out)
+
+	text := out.String()
+	if !strings.Contains(text, "1 downloaded, 1 skipped, 1 failed") {
+		t.Errorf("PrintTable() = %q, want per-status counts", text)
+	}
+	if !strings.Contains(text, "Private video") {
+		t.Errorf("PrintTable() = %q, want failure reasons", text)
+	}
+}
+
+func TestReport_WriteFile(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if err := testReport().WriteFile(jsonPath); err != nil {
+		t.Fatalf("WriteFile(json) error = %v", err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("WriteFile(json) produced invalid JSON: %v", err)
+	}
+	if len(decoded.Results) != 3 || decoded.Results[1].Status != STATUS_FAILED {
+		t.Errorf("WriteFile(json) results = %+v", decoded.Results)
+	}
+
+	csvPath := filepath.Join(dir, "report.csv")
+	if err := testReport().WriteFile(csvPath); err != nil {
+		t.Fatalf("WriteFile(csv) error = %v", err)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatalf("failed to open report: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("WriteFile(csv) produced invalid CSV: %v", err)
+	}
+	if len(rows) != 4 || rows[0][0] != "status" || rows[2][1] != "b" {
+		t.Errorf("WriteFile(csv) rows = %v", rows)
+	}
+}
+
+const fakePartialFailureScript = `
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*--dump-single-json*)
+	cat <<'JSON'
+{"_type": "playlist", "id": "PL1", "entries": [
+	{"id": "a", "title": "First", "url": "https://www.youtube.com/watch?v=a"},
+	{"id": "b", "title": "Private", "url": "https://www.youtube.com/watch?v=b"},
+	{"id": "c", "title": "Third", "url": "https://www.youtube.com/watch?v=c"}
+]}
+JSON
+	;;
+*)
+	abort=false
+	case "$*" in *--abort-on-error*) abort=true ;; esac
+	for arg in "$@"; do
+		case "$arg" in
+		*watch?v=b)
+			echo "[youtube] Extracting URL: $arg"
+			echo "ERROR: [youtube] b: Private video" >&2
+			if $abort; then exit 1; fi
+			;;
+		*watch?v=*)
+			echo "[youtube] Extracting URL: $arg"
+			echo "[download] Destination: /out/$arg.mp4"
+			echo "[download] 100% of 1.00MiB"
+			;;
+		esac
+	done
+	exit 1
+	;;
+esac
+`
+
+func TestDownload_PartialFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		abortOnError bool
+		want         []Status
+	}{
+		{"continue past failures", false, []Status{STATUS_DOWNLOADED, STATUS_FAILED, STATUS_DOWNLOADED}},
+		{"abort on error", true, []Status{STATUS_DOWNLOADED, STATUS_FAILED, STATUS_ABORTED}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeYtDlp(t, fakePartialFailureScript)
+
+			cfg := config.NewConfig()
+			cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+			cfg.OutputDir = t.TempDir()
+			cfg.Playlist = true
+			cfg.AbortOnError = tt.abortOnError
+			cfg.ReportFile = filepath.Join(cfg.OutputDir, "report.json")
+
+			report, err := New(cfg).Download()
+			if !errors.Is(err, ErrPartialFailure) {
+				t.Fatalf("Download() error = %v, want ErrPartialFailure", err)
+			}
+
+			if len(report.Results) != len(tt.want) {
+				t.Fatalf("Download() results = %+v, want %d results", report.Results, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if report.Results[i].Status != want {
+					t.Errorf("result %d status = %s, want %s", i, report.Results[i].Status, want)
+				}
+			}
+			if report.Results[1].Reason == "" {
+				t.Error("failed result has no reason")
+			}
+			if _, err := os.Stat(cfg.ReportFile); err != nil {
+				t.Errorf("report file not written: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownload_OnProgress(t *testing.T) {
+	fakeYtDlp(t, fakePartialFailureScript)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = t.TempDir()
+	cfg.Playlist = true
+
+	var updates []Progress
+	dl := New(cfg)
+	dl.OnProgress(func(p Progress) { updates = append(updates, p) })
+	if _, err := dl.Download(); !errors.Is(err, ErrPartialFailure) {
+		t.Fatalf("Download() error = %v, want ErrPartialFailure", err)
+	}
+
+	if len(updates) == 0 {
+		t.Fatal("OnProgress() callback was not called")
+	}
+	last := updates[len(updates)-1]
+	if last.Total != 3 || last.Succeeded != 2 || last.Failed != 1 {
+		t.Errorf("last progress = %+v, want 2 succeeded and 1 failed of 3", last)
+	}
+}
+
+func TestDownload_AfterDownload(t *testing.T) {
+	fakeYtDlp(t, fakePartialFailureScript)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = t.TempDir()
+	cfg.Playlist = true
+
+	var hooked []string
+	dl := New(cfg)
+	dl.AfterDownload(func(ctx context.Context, r Result) error {
+		hooked = append(hooked, r.ID)
+		if r.ID == "a" {
+			return errors.New("transcoding failed")
+		}
+		return nil
+	})
+	report, err := dl.Download()
+	if !errors.Is(err, ErrPartialFailure) {
+		t.Fatalf("Download() error = %v, want ErrPartialFailure", err)
+	}
+
+	if len(hooked) != 2 || hooked[0] != "a" || hooked[1] != "c" {
+		t.Errorf("hook ran for %v, want the downloaded videos a and c", hooked)
+	}
+	first := report.Results[0]
+	if first.Status != STATUS_FAILED || first.Transient || !strings.Contains(first.Reason, "transcoding failed") {
+		t.Errorf("result of a = %+v, want a permanent hook failure", first)
+	}
+	if report.Results[2].Status != STATUS_DOWNLOADED {
+		t.Errorf("result of c = %+v, want downloaded", report.Results[2])
+	}
+}
+
+// fakeInterruptibleScript downloads the first video of a playlist until it
+// is interrupted, leaving a partial file behind.
+const fakeInterruptibleScript = `
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*--dump-single-json*)
+	cat <<'JSON'
+{"_type": "playlist", "id": "PL1", "entries": [
+	{"id": "a", "title": "First", "url": "https://www.youtube.com/watch?v=a"},
+	{"id": "b", "title": "Second", "url": "https://www.youtube.com/watch?v=b"}
+]}
+JSON
+	;;
+*)
+	trap 'exit 130' INT
+	echo "[youtube] Extracting URL: https://www.youtube.com/watch?v=a"
+	echo "[download] Destination: First.mp4"
+	touch First.mp4.part
+	echo "[download]  10.0% of 1.00MiB"
+	sleep 10 >/dev/null 2>&1 &
+	wait
+	;;
+esac
+`
+
+func TestDownload_SetContext(t *testing.T) {
+	fakeYtDlp(t, fakeInterruptibleScript)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = t.TempDir()
+	cfg.Playlist = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dl := New(cfg)
+	dl.SetContext(ctx)
+	dl.OnProgress(func(p Progress) {
+		if p.Percent > 0 {
+			cancel()
+		}
+	})
+
+	start := time.Now()
+	report, err := dl.Download()
+	if err == nil {
+		t.Fatal("Download() of an interrupted run should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Download() took %s after the context was cancelled", elapsed)
+	}
+
+	want := []Result{
+		{ID: "a", Title: "First", URL: "https://www.youtube.com/watch?v=a", Status: STATUS_ABORTED, Reason: interruptedReason, Path: "First.mp4"},
+		{ID: "b", Title: "Second", URL: "https://www.youtube.com/watch?v=b", Status: STATUS_ABORTED, Reason: interruptedReason},
+	}
+	if !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("Download() results = %+v, want %+v", report.Results, want)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "First.mp4.part")); err != nil {
+		t.Errorf("partial file was not kept: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// Status is the outcome of a single video download.
+type Status string
+
+const (
+	STATUS_DOWNLOADED Status = "downloaded"
+	STATUS_SKIPPED    Status = "skipped"
+	STATUS_FAILED     Status = "failed"
+	STATUS_ABORTED    Status = "aborted"
+)
+
+// abortedReason is the reason recorded for videos not attempted after an error.
+const abortedReason = "not attempted after an earlier error"
+
+// interruptedReason is the reason recorded for the video being downloaded
+// when a run is stopped.
+const interruptedReason = "interrupted"
+
+// permanentErrors are yt-dlp error messages that retrying will not fix.
+var permanentErrors = []string{
+	"private video",
+	"video unavailable",
+	"has been removed",
+	"members-only",
+	"join this channel",
+	"sign in to confirm your age",
+	"copyright",
+	"not available in your country",
+	"account associated with this video has been terminated",
+	"unsupported url",
+	"is not a valid url",
+}
+
+// Result describes what happened to a single video during a run.
+type Result struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Status Status `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	// Transient is set for failures that may succeed when retried.
+	Transient bool   `json:"transient,omitempty"`
+	Path      string `json:"path,omitempty"`
+}
+
+// newResult creates a result for the given playlist entry.
+func newResult(e *playlist.Entry, status Status, reason string) Result {
+	return Result{
+		ID:     e.ID,
+		Title:  e.Title,
+		URL:    e.VideoURL(),
+		Status: status,
+		Reason: reason,
+	}
+}
+
+// entry converts the result back into a playlist entry for a new run.
+func (r *Result) entry(index int) playlist.Entry {
+	return playlist.Entry{Index: index, ID: r.ID, Title: r.Title, URL: r.URL}
+}
+
+// isTransient reports whether a failure with the given reason may succeed
+// when retried. Unknown errors are assumed to be transient.
+func isTransient(reason string) bool {
+	reason = strings.ToLower(reason)
+	for _, permanent := range permanentErrors {
+		if strings.Contains(reason, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContinueResults combines the results of an interrupted run with those of
+// the run that continued it. Videos the interrupted run downloaded and the
+// continuing run found already downloaded keep their earlier result, which
+// may be a failure of a post-download hook.
+func ContinueResults(previous, results []Result) []Result {
+	downloaded := make(map[string]Result)
+	for _, r := range previous {
+		if (r.Status == STATUS_DOWNLOADED || r.Status == STATUS_FAILED) && r.ID != "" {
+			downloaded[r.ID] = r
+		}
+	}
+
+	merged := make([]Result, len(results))
+	for i, r := range results {
+		if earlier, ok := downloaded[r.ID]; ok && r.Status == STATUS_SKIPPED && r.Reason == alreadyDoneReason {
+			r = earlier
+		}
+		merged[i] = r
+	}
+	return merged
+}
@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"fmt"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// Retry downloads the videos of a previous run that failed with a transient
+// error or were never attempted, and returns the previous report updated with
+// their new results.
+func (d *Downloader) Retry(previous *Report) (*Report, error) {
+	retryable := previous.Retryable()
+	if len(retryable) == 0 {
+		fmt.Println("no failed videos to retry")
+		return previous, nil
+	}
+
+	if err := d.checkYtDlpInstalled(); err != nil {
+		return nil, fmt.Errorf("yt-dlp dependency check failed: %w", err)
+	}
+
+	entries := make([]playlist.Entry, 0, len(retryable))
+	for i := range retryable {
+		entries = append(entries, retryable[i].entry(i+1))
+	}
+	fmt.Printf("retrying %d of %d videos\n", len(entries), len(previous.Results))
+
+	retried := newReport(previous.URL, d.config)
+	args := append(d.buildOptionArgs(), entryURLs(entries)...)
+	runErr := d.execute(retried, entries, args)
+
+	report := previous.merge(retried)
+	report.Config = d.config
+	return report, d.complete(report, true, runErr)
+}
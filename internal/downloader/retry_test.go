@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   bool
+	}{
+		{"[youtube] b: Private video. Sign in if you've been granted access to this video", false},
+		{"[youtube] b: Video unavailable. This video has been removed by the uploader", false},
+		{"[youtube] b: Join this channel to get access to members-only content", false},
+		{"unable to download video data: HTTP Error 503: Service Unavailable", true},
+		{"[youtube] b: Read timed out.", true},
+		{"something unexpected", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			if got := isTransient(tt.reason); got != tt.want {
+				t.Errorf("isTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_Retryable(t *testing.T) {
+	report := &Report{Results: []Result{
+		{ID: "a", Status: STATUS_DOWNLOADED},
+		{ID: "b", Status: STATUS_FAILED, Transient: true},
+		{ID: "c", Status: STATUS_FAILED},
+		{ID: "d", Status: STATUS_SKIPPED},
+		{ID: "e", Status: STATUS_ABORTED},
+	}}
+
+	retryable := report.Retryable()
+	if len(retryable) != 2 || retryable[0].ID != "b" || retryable[1].ID != "e" {
+		t.Errorf("Retryable() = %+v, want b and e", retryable)
+	}
+}
+
+func TestContinueResults(t *testing.T) {
+	previous := []Result{
+		{ID: "a", Status: STATUS_DOWNLOADED, Path: "a.mp4"},
+		{ID: "b", Status: STATUS_ABORTED, Reason: interruptedReason},
+		{ID: "d", Status: STATUS_FAILED, Reason: "post-download hook failed: exit status 1", Path: "d.mp4"},
+	}
+	results := []Result{
+		{ID: "a", Status: STATUS_SKIPPED, Reason: alreadyDoneReason, Path: "a.mp4"},
+		{ID: "b", Status: STATUS_DOWNLOADED, Path: "b.mp4"},
+		{ID: "c", Status: STATUS_SKIPPED, Reason: alreadyDoneReason},
+		{ID: "d", Status: STATUS_SKIPPED, Reason: alreadyDoneReason, Path: "d.mp4"},
+	}
+
+	got := ContinueResults(previous, results)
+	want := []Status{STATUS_DOWNLOADED, STATUS_DOWNLOADED, STATUS_SKIPPED, STATUS_FAILED}
+	if len(got) != len(want) {
+		t.Fatalf("ContinueResults() = %+v, want %d results", got, len(want))
+	}
+	for i, status := range want {
+		if got[i].Status != status {
+			t.Errorf("result %s: status = %s, want %s", got[i].ID, got[i].Status, status)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	fakeYtDlp(t, `
+case "$*" in
+*--version*) echo 2025.01.01 ;;
+*)
+	echo "$@" > `+argsFile+`
+	for arg in "$@"; do
+		case "$arg" in
+		*watch?v=*)
+			echo "[youtube] Extracting URL: $arg"
+			echo "[download] 100% of 1.00MiB"
+			;;
+		esac
+	done
+	;;
+esac
+`)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/playlist?list=PL1"
+	cfg.OutputDir = dir
+	cfg.Playlist = true
+	cfg.ReportFile = filepath.Join(dir, "report.json")
+
+	previous := newReport(cfg.URL, cfg)
+	previous.Results = []Result{
+		{ID: "a", URL: "https://www.youtube.com/watch?v=a", Status: STATUS_DOWNLOADED},
+		{ID: "b", URL: "https://www.youtube.com/watch?v=b", Status: STATUS_FAILED, Reason: "HTTP Error 503", Transient: true},
+		{ID: "c", URL: "https://www.youtube.com/watch?v=c", Status: STATUS_FAILED, Reason: "Private video"},
+	}
+
+	report, err := New(cfg).Retry(previous)
+	if err == nil {
+		t.Fatal("Retry() error = nil, want the permanent failure to be reported")
+	}
+
+	want := []Status{STATUS_DOWNLOADED, STATUS_DOWNLOADED, STATUS_FAILED}
+	for i, status := range want {
+		if report.Results[i].Status != status {
+			t.Errorf("result %s status = %s, want %s", report.Results[i].ID, report.Results[i].Status, status)
+		}
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("yt-dlp was not run: %v", err)
+	}
+	if strings.Contains(string(args), "v=a") || strings.Contains(string(args), "v=c") || !strings.Contains(string(args), "v=b") {
+		t.Errorf("yt-dlp args = %s, want only the transient failure", args)
+	}
+
+	written, err := ReadReport(cfg.ReportFile)
+	if err != nil {
+		t.Fatalf("ReadReport() error = %v", err)
+	}
+	if len(written.Results) != 3 || written.Config == nil || written.Config.URL != cfg.URL {
+		t.Errorf("ReadReport() = %+v, want the updated report with its config", written)
+	}
+}
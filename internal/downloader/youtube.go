@@ -4,69 +4,187 @@ package downloader
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/schollz/progressbar/v3"
+	"time"
 
 	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/playlist"
 )
 
 // Downloader handles YouTube video downloads using yt-dlp.
 type Downloader struct {
-	config *config.Config
+	config        *config.Config
+	onProgress    func(Progress)
+	afterDownload Hook
+	ctx           context.Context
 }
 
+// interruptGracePeriod is how long yt-dlp may take to exit after it is
+// interrupted before it is killed.
+const interruptGracePeriod = 10 * time.Second
+
 // New creates a new Downloader instance with the given configuration.
 func New(cfg *config.Config) *Downloader {
 	return &Downloader{
 		config: cfg,
+		ctx:    context.Background(),
 	}
 }
 
+// SetContext makes the download stop when ctx is cancelled. yt-dlp is
+// interrupted rather than killed, so partially downloaded files are kept
+// and a later run continues them. The item being downloaded is reported as
+// aborted.
+func (d *Downloader) SetContext(ctx context.Context) {
+	d.ctx = ctx
+}
+
+// OnProgress registers fn to receive progress updates instead of drawing
+// progress bars. fn is called from the goroutine reading the yt-dlp output
+// and should return quickly.
+func (d *Downloader) OnProgress(fn func(Progress)) {
+	d.onProgress = fn
+}
+
 // Download downloads a YouTube video from the given URL.
-// It returns an error if the download fails.
-func (d *Downloader) Download() error {
+// It returns a report with the outcome of every video and an error if the
+// download fails. Failing playlist items do not stop the run unless
+// AbortOnError is set; they are reported and an error wrapping
+// ErrPartialFailure is returned at the end.
+func (d *Downloader) Download() (*Report, error) {
 	if err := d.checkYtDlpInstalled(); err != nil {
-		return fmt.Errorf("yt-dlp dependency check failed: %w", err)
+		return nil, fmt.Errorf("yt-dlp dependency check failed: %w", err)
 	}
 
 	if d.config.Verbose {
 		log.Printf("starting download with config: %+v", d.config)
 	}
 
+	if d.config.DryRun {
+		return nil, d.dryRun()
+	}
+
+	report := newReport(d.cleanURL(d.config.URL), d.config)
 	args := d.buildYtDlpArgs()
+	var entries []playlist.Entry
+	if d.config.Playlist || d.config.HasFilters() {
+		selected, skipped, err := d.selectEntries()
+		if err != nil {
+			return nil, err
+		}
+		for i := range skipped {
+			report.Results = append(report.Results, newResult(&skipped[i].Entry, STATUS_SKIPPED, skipped[i].Reason))
+		}
+		if len(selected) == 0 {
+			fmt.Println("no videos to download")
+			return report, d.finishReport(report, true)
+		}
+		entries = selected
+		args = append(d.buildOptionArgs(), entryURLs(entries)...)
+	}
 
+	runErr := d.execute(report, entries, args)
+	return report, d.complete(report, len(entries) > 0, runErr)
+}
+
+// DownloadEntries downloads the given entries without listing or selecting
+// them again. Skipped entries are included in the report as skipped.
+func (d *Downloader) DownloadEntries(entries []playlist.Entry, skipped []playlist.Skipped) (*Report, error) {
+	if err := d.checkYtDlpInstalled(); err != nil {
+		return nil, fmt.Errorf("yt-dlp dependency check failed: %w", err)
+	}
+
+	report := newReport(d.cleanURL(d.config.URL), d.config)
+	for i := range skipped {
+		report.Results = append(report.Results, newResult(&skipped[i].Entry, STATUS_SKIPPED, skipped[i].Reason))
+	}
+	if len(entries) == 0 {
+		return report, d.finishReport(report, len(skipped) > 0)
+	}
+
+	args := append(d.buildOptionArgs(), entryURLs(entries)...)
+	runErr := d.execute(report, entries, args)
+	return report, d.complete(report, true, runErr)
+}
+
+// execute runs yt-dlp with the given arguments and appends the outcome of
+// every entry to the report. It returns the yt-dlp execution error, if any.
+func (d *Downloader) execute(report *Report, entries []playlist.Entry, args []string) error {
 	if d.config.Verbose {
 		log.Printf("executing: yt-dlp %s", strings.Join(args, " "))
 	}
 
-	cmd := exec.Command("yt-dlp", args...)
+	cmd := d.command(args...)
 	cmd.Dir = d.config.OutputDir
 
-	if d.config.Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("yt-dlp execution failed: %w", err)
-		}
-	} else {
-		if err := d.runWithProgress(cmd); err != nil {
-			return fmt.Errorf("yt-dlp execution failed: %w", err)
-		}
+	tracker := newProgressTracker(entries, len(report.Results))
+	hooks := d.startHooks()
+	if hooks != nil {
+		tracker.onFinished = hooks.add
+	}
+	runErr := d.runWithProgress(cmd, tracker)
+	offset := len(report.Results)
+	report.Results = append(report.Results, tracker.results()...)
+	if hooks != nil {
+		hooks.wait(report.Results[offset:])
+	}
+	return runErr
+}
+
+// command returns a yt-dlp command that is interrupted when the context of
+// the download is cancelled.
+func (d *Downloader) command(args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(d.ctx, "yt-dlp", args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = interruptGracePeriod
+	return cmd
+}
+
+// complete finishes the report and turns failed videos and yt-dlp errors
+// into the error returned by the run.
+func (d *Downloader) complete(report *Report, printTable bool, runErr error) error {
+	failed := report.Count(STATUS_FAILED)
+	if err := d.finishReport(report, printTable || failed > 0); err != nil {
+		return err
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d of %d videos failed: %w", failed, len(report.Results), ErrPartialFailure)
+	case runErr != nil:
+		return fmt.Errorf("yt-dlp execution failed: %w", runErr)
 	}
 
 	fmt.Printf("download completed successfully in %s\n", d.config.OutputDir)
 	return nil
 }
 
+// finishReport completes the report, prints the result table if requested
+// and writes the report file if one is configured.
+func (d *Downloader) finishReport(report *Report, printTable bool) error {
+	report.FinishedAt = time.Now()
+
+	if printTable {
+		report.PrintTable(os.Stdout)
+	}
+
+	if d.config.ReportFile != "" {
+		if err := report.WriteFile(d.config.ReportFile); err != nil {
+			return err
+		}
+		fmt.Printf("report written to %s\n", d.config.ReportFile)
+	}
+	return nil
+}
+
 // checkYtDlpInstalled verifies that yt-dlp is installed and accessible.
 func (d *Downloader) checkYtDlpInstalled() error {
 	cmd := exec.Command("yt-dlp", "--version")
@@ -78,6 +196,18 @@ func (d *Downloader) checkYtDlpInstalled() error {
 
 // buildYtDlpArgs constructs the command line arguments for yt-dlp.
 func (d *Downloader) buildYtDlpArgs() []string {
+	return append(d.buildOptionArgs(), d.cleanURL(d.config.URL))
+}
+
+// buildOptionArgs constructs the yt-dlp options without the URLs to download.
+func (d *Downloader) buildOptionArgs() []string {
+	return append(d.buildSimulateArgs(), d.config.ExtraArgs...)
+}
+
+// buildSimulateArgs constructs the yt-dlp options without the passthrough
+// arguments, for commands that must not download, such as resolving the
+// file names of a dry run.
+func (d *Downloader) buildSimulateArgs() []string {
 	args := []string{}
 
 	if d.config.AudioOnly {
@@ -92,22 +222,36 @@ func (d *Downloader) buildYtDlpArgs() []string {
 
 	if d.config.Playlist {
 		args = append(args, "--yes-playlist")
+		if d.config.AbortOnError {
+			args = append(args, "--abort-on-error")
+		} else {
+			args = append(args, "--ignore-errors")
+		}
 	} else {
 		args = append(args, "--no-playlist")
 	}
 
-	outputTemplate := filepath.Join(d.config.OutputDir, "%(title)s.%(ext)s")
+	template := d.config.OutputTemplate
+	if template == "" {
+		template = config.DEFAULT_OUTPUT_TEMPLATE
+	}
+	outputTemplate := filepath.Join(d.config.OutputDir, template)
 	args = append(args, "--output", outputTemplate)
 
+	if d.config.ArchiveFile != "" {
+		args = append(args, "--download-archive", d.config.ArchiveFile)
+	}
+
+	if rate, err := d.config.Rate(); err == nil && rate > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(rate, 10))
+	}
+
 	if !d.config.Verbose {
 		args = append(args, "--no-warnings", "--newline")
 	} else {
 		args = append(args, "--newline")
 	}
 
-	cleanURL := d.cleanURL(d.config.URL)
-	args = append(args, cleanURL)
-
 	return args
 }
 
@@ -140,66 +284,54 @@ func (d *Downloader) extractHeight(quality string) string {
 }
 
 // runWithProgress executes yt-dlp with progress tracking.
-func (d *Downloader) runWithProgress(cmd *exec.Cmd) error {
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-
-	stderr, err := cmd.StderrPipe()
+// Playlist runs show an overall bar and the current item's bar, and verbose
+// runs print the yt-dlp output instead of bars. A registered progress
+// callback replaces the bars.
+func (d *Downloader) runWithProgress(cmd *exec.Cmd, tracker *progressTracker) error {
+	// stdout and stderr share one pipe so that errors stay in order with the
+	// item boundaries they belong to.
+	reader, writer, err := os.Pipe()
 	if err != nil {
 		return err
 	}
+	defer reader.Close()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
 
 	if err := cmd.Start(); err != nil {
+		writer.Close()
 		return err
 	}
+	writer.Close()
+
+	switch {
+	case d.onProgress != nil:
+		tracker.onUpdate = d.onProgress
+	case d.config.Verbose:
+	case tracker.progress.Total > 1:
+		bar := &playlistBar{w: os.Stdout}
+		tracker.onUpdate = bar.render
+		defer bar.finish()
+	default:
+		update, finish := newSingleBar()
+		tracker.onUpdate = update
+		defer finish()
+	}
 
-	bar := progressbar.NewOptions(100,
-		progressbar.OptionSetDescription("downloading video..."),
-		progressbar.OptionSetWidth(50),
-		progressbar.OptionShowCount())
-	defer bar.Finish()
-
-	// Progress regex patterns for yt-dlp output
-	progressRegex := regexp.MustCompile(`\[download\]\s+(\d+(?:\.\d+)?)%`)
-	downloadRegex := regexp.MustCompile(`\[download\]`)
-
-	done := make(chan bool)
-
-	// Read both stdout and stderr in separate goroutines
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if downloadRegex.MatchString(line) {
-				if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
-					if percent, err := strconv.ParseFloat(matches[1], 64); err == nil {
-						bar.Set(int(percent))
-					}
-				}
-			}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if d.config.Verbose {
+			fmt.Println(scanner.Text())
 		}
-	}()
-
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if downloadRegex.MatchString(line) {
-				if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
-					if percent, err := strconv.ParseFloat(matches[1], 64); err == nil {
-						bar.Set(int(percent))
-					}
-				}
-			}
-		}
-		done <- true
-	}()
+		tracker.handleLine(scanner.Text())
+	}
 
 	// Wait for command to complete
 	cmdErr := cmd.Wait()
-	<-done
+	if d.ctx.Err() != nil {
+		tracker.interrupt()
+	}
+	tracker.finish()
 
 	return cmdErr
 }
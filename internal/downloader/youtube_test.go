@@ -181,8 +181,20 @@ func TestBuildYtDlpArgs(t *testing.T) {
 				cfg.Playlist = true
 				return cfg
 			},
-			contains:    []string{"--yes-playlist"},
-			notContains: []string{"--no-playlist"},
+			contains:    []string{"--yes-playlist", "--ignore-errors"},
+			notContains: []string{"--no-playlist", "--abort-on-error"},
+		},
+		{
+			name: "playlist with abort on error",
+			config: func() *config.Config {
+				cfg := config.NewConfig()
+				cfg.URL = "https://www.youtube.com/watch?v=test"
+				cfg.Playlist = true
+				cfg.AbortOnError = true
+				return cfg
+			},
+			contains:    []string{"--yes-playlist", "--abort-on-error"},
+			notContains: []string{"--ignore-errors"},
 		},
 		{
 			name: "verbose",
@@ -195,6 +207,28 @@ func TestBuildYtDlpArgs(t *testing.T) {
 			contains:    []string{"--newline"},
 			notContains: []string{"--quiet", "--no-warnings"},
 		},
+		{
+			name: "limit rate",
+			config: func() *config.Config {
+				cfg := config.NewConfig()
+				cfg.URL = "https://www.youtube.com/watch?v=test"
+				cfg.LimitRate = "2M"
+				return cfg
+			},
+			contains:    []string{"--limit-rate", "2097152"},
+			notContains: []string{},
+		},
+		{
+			name: "extra args",
+			config: func() *config.Config {
+				cfg := config.NewConfig()
+				cfg.URL = "https://www.youtube.com/watch?v=test"
+				cfg.ExtraArgs = []string{"--retries", "3"}
+				return cfg
+			},
+			contains:    []string{"--retries", "3"},
+			notContains: []string{},
+		},
 	}
 
 	for _, tt := range tests {
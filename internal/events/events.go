@@ -0,0 +1,165 @@
+// Package events distributes job state changes and download progress to
+// subscribers such as Server-Sent Events and WebSocket clients. Recent events
+// are kept so that reconnecting clients can catch up from the last event
+// they received.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+const (
+	EVENT_JOB      = "job"
+	EVENT_PROGRESS = "progress"
+
+	DEFAULT_HISTORY_SIZE = 1000
+)
+
+const (
+	// subscriberBuffer is the number of events a subscriber may lag behind
+	// before it is dropped.
+	subscriberBuffer = 256
+	// progressInterval is the minimum time between progress events of a job
+	// while the same item is downloading.
+	progressInterval = 250 * time.Millisecond
+)
+
+// Event is a job state change or a progress update of a running job.
+type Event struct {
+	// ID increases with every event and identifies the event on reconnection.
+	ID       uint64               `json:"id"`
+	Type     string               `json:"type"`
+	JobID    string               `json:"job_id"`
+	Time     time.Time            `json:"time"`
+	Job      *queue.Job           `json:"job,omitempty"`
+	Progress *downloader.Progress `json:"progress,omitempty"`
+}
+
+// Subscription receives the events of one job or of all jobs.
+type Subscription struct {
+	// C receives the events. It is closed when the subscription ends,
+	// including when the subscriber falls too far behind; the subscriber
+	// can then subscribe again from the last event it received.
+	C      <-chan Event
+	c      chan Event
+	jobID  string
+	closed bool
+}
+
+// Broker publishes events to subscriptions and keeps a bounded history.
+type Broker struct {
+	mu           sync.Mutex
+	lastID       uint64
+	history      []Event
+	historySize  int
+	subs         map[*Subscription]bool
+	lastProgress map[string]Event
+}
+
+// NewBroker creates a Broker keeping the given number of recent events.
+func NewBroker(historySize int) *Broker {
+	if historySize <= 0 {
+		historySize = DEFAULT_HISTORY_SIZE
+	}
+	return &Broker{
+		historySize:  historySize,
+		subs:         make(map[*Subscription]bool),
+		lastProgress: make(map[string]Event),
+	}
+}
+
+// PublishJob publishes a job state change.
+func (b *Broker) PublishJob(job queue.Job) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if job.Finished() {
+		delete(b.lastProgress, job.ID)
+	}
+	b.publish(Event{Type: EVENT_JOB, JobID: job.ID, Job: &job})
+}
+
+// PublishProgress publishes the progress of a running job. Updates within
+// the same item are rate limited, except for the completion of the item.
+func (b *Broker) PublishProgress(jobID string, p downloader.Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if last, ok := b.lastProgress[jobID]; ok {
+		sameItem := last.Progress.Item == p.Item && last.Progress.Failed == p.Failed && last.Progress.Skipped == p.Skipped
+		if sameItem && p.Percent < 100 && time.Since(last.Time) < progressInterval {
+			return
+		}
+	}
+	b.lastProgress[jobID] = b.publish(Event{Type: EVENT_PROGRESS, JobID: jobID, Progress: &p})
+}
+
+// publish assigns the event its ID, records it and delivers it. The caller
+// holds b.mu.
+func (b *Broker) publish(e Event) Event {
+	b.lastID++
+	e.ID = b.lastID
+	e.Time = time.Now()
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.historySize {
+		b.history = append(b.history[:0:0], b.history[len(b.history)-b.historySize:]...)
+	}
+
+	for sub := range b.subs {
+		if sub.jobID != "" && sub.jobID != e.JobID {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			b.remove(sub)
+		}
+	}
+	return e
+}
+
+// Subscribe subscribes to the events of the job, or of all jobs if jobID is
+// empty. Events after lastEventID that are still in the history are
+// delivered first; lastEventID 0 starts with new events only.
+func (b *Broker) Subscribe(jobID string, lastEventID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	if lastEventID > 0 {
+		for _, e := range b.history {
+			if e.ID > lastEventID && (jobID == "" || e.JobID == jobID) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	c := make(chan Event, len(missed)+subscriberBuffer)
+	for _, e := range missed {
+		c <- e
+	}
+	sub := &Subscription{C: c, c: c, jobID: jobID}
+	b.subs[sub] = true
+	return sub
+}
+
+// Unsubscribe ends the subscription and closes its channel.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// remove ends a subscription. The caller holds b.mu.
+func (b *Broker) remove(sub *Subscription) {
+	delete(b.subs, sub)
+	if !sub.closed {
+		close(sub.c)
+		sub.closed = true
+	}
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+// receive returns the events currently buffered in the subscription.
+func receive(sub *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBroker_Subscribe(t *testing.T) {
+	b := NewBroker(0)
+	all := b.Subscribe("", 0)
+	one := b.Subscribe("job1", 0)
+
+	b.PublishJob(queue.Job{ID: "job1", State: queue.STATE_RUNNING})
+	b.PublishJob(queue.Job{ID: "job2", State: queue.STATE_QUEUED})
+	b.PublishProgress("job1", downloader.Progress{Item: 1, Total: 1, Percent: 50})
+
+	if got := receive(all); len(got) != 3 || got[0].ID != 1 || got[2].ID != 3 {
+		t.Errorf("global subscription received %+v, want events 1 to 3", got)
+	}
+	got := receive(one)
+	if len(got) != 2 || got[0].Type != EVENT_JOB || got[1].Type != EVENT_PROGRESS || got[1].Progress.Percent != 50 {
+		t.Errorf("job subscription received %+v, want the job's state and progress", got)
+	}
+
+	b.Unsubscribe(one)
+	if _, ok := <-one.C; ok {
+		t.Error("Unsubscribe() did not close the channel")
+	}
+}
+
+func TestBroker_Reconnect(t *testing.T) {
+	b := NewBroker(3)
+	for _, id := range []string{"a", "b", "a", "b", "a"} {
+		b.PublishJob(queue.Job{ID: id, State: queue.STATE_QUEUED})
+	}
+
+	// Events 3 to 5 are in the history; event 2 is gone.
+	tests := []struct {
+		name   string
+		jobID  string
+		lastID uint64
+		want   []uint64
+	}{
+		{"new events only", "", 0, nil},
+		{"all jobs", "", 3, []uint64{4, 5}},
+		{"one job", "a", 1, []uint64{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []uint64
+			for _, e := range receive(b.Subscribe(tt.jobID, tt.lastID)) {
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("replayed %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("replayed %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBroker_ProgressRateLimit(t *testing.T) {
+	b := NewBroker(0)
+	sub := b.Subscribe("", 0)
+
+	b.PublishProgress("job", downloader.Progress{Item: 1, Total: 2, Percent: 10})
+	b.PublishProgress("job", downloader.Progress{Item: 1, Total: 2, Percent: 20})
+	b.PublishProgress("job", downloader.Progress{Item: 1, Total: 2, Percent: 100})
+	b.PublishProgress("job", downloader.Progress{Item: 2, Total: 2, Percent: 0})
+	time.Sleep(progressInterval)
+	b.PublishProgress("job", downloader.Progress{Item: 2, Total: 2, Percent: 30})
+
+	var percents []float64
+	for _, e := range receive(sub) {
+		percents = append(percents, e.Progress.Percent)
+	}
+	want := []float64{10, 100, 0, 30}
+	if len(percents) != len(want) {
+		t.Fatalf("published progress %v, want %v", percents, want)
+	}
+	for i := range want {
+		if percents[i] != want[i] {
+			t.Errorf("published progress %v, want %v", percents, want)
+		}
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker(0)
+	sub := b.Subscribe("", 0)
+
+	for range subscriberBuffer + 1 {
+		b.PublishJob(queue.Job{ID: "job", State: queue.STATE_QUEUED})
+	}
+	if got := receive(sub); len(got) != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events, want %d before being dropped", len(got), subscriberBuffer)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("slow subscriber was not dropped")
+	}
+}
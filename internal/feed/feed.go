@@ -0,0 +1,80 @@
+// Package feed polls the Atom feeds of YouTube channels for new uploads.
+// A feed lists only a channel's latest uploads, but fetching it is much
+// cheaper than listing the channel through yt-dlp, and conditional requests
+// make unchanged feeds nearly free.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+// Feed is a parsed channel upload feed.
+type Feed struct {
+	ChannelID string
+	Title     string
+	// Entries are the uploads in feed order, newest first.
+	Entries []playlist.Entry
+}
+
+// atomFeed is the subset of the YouTube Atom feed used by drop-tube.
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ChannelID string      `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	Title     string      `xml:"http://www.w3.org/2005/Atom title"`
+	Entries   []atomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type atomEntry struct {
+	VideoID string `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	Title   string `xml:"http://www.w3.org/2005/Atom title"`
+	Links   []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.w3.org/2005/Atom link"`
+	Published string `xml:"http://www.w3.org/2005/Atom published"`
+	Group     struct {
+		Community struct {
+			Statistics struct {
+				Views *int64 `xml:"views,attr"`
+			} `xml:"http://search.yahoo.com/mrss/ statistics"`
+		} `xml:"http://search.yahoo.com/mrss/ community"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+// Parse parses a channel upload feed. Entries carry the video ID, title,
+// URL, upload date and view count where the feed provides them.
+func Parse(data []byte) (*Feed, error) {
+	var doc atomFeed
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	feed := &Feed{ChannelID: doc.ChannelID, Title: doc.Title, Entries: []playlist.Entry{}}
+	for _, e := range doc.Entries {
+		if e.VideoID == "" {
+			continue
+		}
+
+		entry := playlist.Entry{
+			Index:     len(feed.Entries) + 1,
+			ID:        e.VideoID,
+			Title:     e.Title,
+			ViewCount: e.Group.Community.Statistics.Views,
+		}
+		for _, link := range e.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				entry.WebpageURL = link.Href
+				break
+			}
+		}
+		if published, err := time.Parse(time.RFC3339, e.Published); err == nil {
+			entry.UploadDate = published.UTC().Format("20060102")
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
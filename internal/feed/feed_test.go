@@ -0,0 +1,56 @@
+package feed
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data, err := os.ReadFile("testdata/videos.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if feed.ChannelID != "UC123" || feed.Title != "Example Channel" {
+		t.Errorf("Parse() channel = %q %q, want UC123 Example Channel", feed.ChannelID, feed.Title)
+	}
+	if len(feed.Entries) != 3 {
+		t.Fatalf("Parse() returned %d entries, want 3", len(feed.Entries))
+	}
+
+	tests := []struct {
+		index      int
+		id         string
+		url        string
+		uploadDate string
+		views      int64
+	}{
+		{0, "vid3", "https://www.youtube.com/shorts/vid3", "20250303", 300},
+		{1, "vid2", "https://www.youtube.com/watch?v=vid2", "20250203", 200},
+		{2, "vid1", "https://www.youtube.com/watch?v=vid1", "20250101", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			e := feed.Entries[tt.index]
+			if e.ID != tt.id || e.WebpageURL != tt.url || e.UploadDate != tt.uploadDate || e.Index != tt.index+1 {
+				t.Errorf("entry = %+v, want ID %s, URL %s, upload date %s", e, tt.id, tt.url, tt.uploadDate)
+			}
+			switch {
+			case tt.views < 0 && e.ViewCount != nil:
+				t.Errorf("ViewCount = %d, want nil", *e.ViewCount)
+			case tt.views >= 0 && (e.ViewCount == nil || *e.ViewCount != tt.views):
+				t.Errorf("ViewCount = %v, want %d", e.ViewCount, tt.views)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse([]byte("<html>not a feed</html>")); err == nil {
+		t.Error("Parse() should fail for a non-Atom document")
+	}
+}
@@ -0,0 +1,209 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+const (
+	STATE_FILE_NAME = "feeds.json"
+
+	// maxSeen bounds the remembered video IDs per channel. Feeds list about
+	// 15 uploads, so older IDs can never reappear.
+	maxSeen = 200
+	// requestTimeout bounds a single feed request.
+	requestTimeout = 30 * time.Second
+)
+
+// ChannelState is what is remembered about a channel's feed between polls.
+type ChannelState struct {
+	// ETag and LastModified are the validators of the last feed response,
+	// sent back as If-None-Match and If-Modified-Since.
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+	// Seen are the video IDs already handled, newest last.
+	Seen []string `json:"seen"`
+	// Pending are unseen entries returned by a poll but not marked as seen
+	// yet. They are returned again even when the feed is unchanged.
+	Pending []playlist.Entry `json:"pending,omitempty"`
+}
+
+// State is the feed state of every polled channel, keyed by channel ID.
+type State struct {
+	Channels map[string]*ChannelState `json:"channels"`
+}
+
+// DefaultStatePath returns the location of the feed state in the data directory.
+func DefaultStatePath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, STATE_FILE_NAME), nil
+}
+
+// LoadState reads the feed state at path. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{Channels: make(map[string]*ChannelState)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse feed state %s: %w", path, err)
+	}
+	if state.Channels == nil {
+		state.Channels = make(map[string]*ChannelState)
+	}
+	return state, nil
+}
+
+// Save writes the feed state to path, creating its directory if needed.
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feed state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write feed state %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write feed state %s: %w", path, err)
+	}
+	return nil
+}
+
+// channel returns the state of a channel, creating it if needed.
+func (s *State) channel(channelID string) *ChannelState {
+	cs, ok := s.Channels[channelID]
+	if !ok {
+		cs = &ChannelState{Seen: []string{}}
+		s.Channels[channelID] = cs
+	}
+	return cs
+}
+
+// Poller fetches channel feeds and tracks which uploads have been seen.
+type Poller struct {
+	State *State
+	// Client is the HTTP client used for feed requests.
+	Client *http.Client
+	// FeedURL is the feed endpoint; the channel ID is added as the
+	// channel_id query parameter.
+	FeedURL string
+}
+
+// NewPoller creates a Poller for the YouTube feed endpoint.
+func NewPoller(state *State) *Poller {
+	return &Poller{
+		State:   state,
+		Client:  &http.Client{Timeout: requestTimeout},
+		FeedURL: youtubeurl.FEED_URL,
+	}
+}
+
+// Poll fetches the channel's feed and returns the entries that have not
+// been seen yet, oldest first, including entries pending from earlier polls.
+// The feed is requested conditionally, so an unchanged feed only yields the
+// pending entries. Returned entries stay pending until marked as seen. The
+// request is abandoned when ctx is cancelled.
+func (p *Poller) Poll(ctx context.Context, channelID string) ([]playlist.Entry, error) {
+	cs := p.State.channel(channelID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.feedURL(channelID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	req.Header.Set("User-Agent", "drop-tube")
+	if cs.ETag != "" {
+		req.Header.Set("If-None-Match", cs.ETag)
+	}
+	if cs.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cs.LastModified)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed of %s: %w", channelID, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		cs.CheckedAt = time.Now()
+		return slices.Clone(cs.Pending), nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed to fetch feed of %s: %s", channelID, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed of %s: %w", channelID, err)
+	}
+	feed, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("feed of %s: %w", channelID, err)
+	}
+
+	// Feeds list the newest upload first; new entries are returned oldest
+	// first so that they are downloaded in upload order.
+	for i := len(feed.Entries) - 1; i >= 0; i-- {
+		e := feed.Entries[i]
+		if slices.Contains(cs.Seen, e.ID) || slices.ContainsFunc(cs.Pending, func(pending playlist.Entry) bool { return pending.ID == e.ID }) {
+			continue
+		}
+		cs.Pending = append(cs.Pending, e)
+	}
+	for i := range cs.Pending {
+		cs.Pending[i].Index = i + 1
+	}
+
+	cs.ETag = resp.Header.Get("ETag")
+	cs.LastModified = resp.Header.Get("Last-Modified")
+	cs.CheckedAt = time.Now()
+	return slices.Clone(cs.Pending), nil
+}
+
+// MarkSeen records the video IDs as handled so that later polls skip them.
+func (p *Poller) MarkSeen(channelID string, ids ...string) {
+	cs := p.State.channel(channelID)
+	for _, id := range ids {
+		cs.Pending = slices.DeleteFunc(cs.Pending, func(e playlist.Entry) bool { return e.ID == id })
+		if !slices.Contains(cs.Seen, id) {
+			cs.Seen = append(cs.Seen, id)
+		}
+	}
+	if len(cs.Seen) > maxSeen {
+		cs.Seen = slices.Clone(cs.Seen[len(cs.Seen)-maxSeen:])
+	}
+}
+
+// feedURL returns the feed URL of the channel.
+func (p *Poller) feedURL(channelID string) string {
+	return p.FeedURL + "?channel_id=" + url.QueryEscape(channelID)
+}
@@ -0,0 +1,148 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+)
+
+const (
+	testETag         = `"v1"`
+	testLastModified = "Mon, 03 Mar 2025 12:30:00 GMT"
+)
+
+// newFeedServer serves the fixture feed for channel UC123 and answers
+// conditional requests with 304 Not Modified. It counts full responses.
+func newFeedServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/videos.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("channel_id") != "UC123" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == testETag && r.Header.Get("If-Modified-Since") == testLastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		served++
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", testLastModified)
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &served
+}
+
+func newTestPoller(srv *httptest.Server) *Poller {
+	p := NewPoller(&State{Channels: make(map[string]*ChannelState)})
+	p.Client = srv.Client()
+	p.FeedURL = srv.URL + "/feeds/videos.xml"
+	return p
+}
+
+func entryIDs(entries []playlist.Entry) []string {
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestPoller_Poll(t *testing.T) {
+	srv, served := newFeedServer(t)
+	p := newTestPoller(srv)
+	p.MarkSeen("UC123", "vid1")
+
+	entries, err := p.Poll(context.Background(), "UC123")
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if got, want := entryIDs(entries), []string{"vid2", "vid3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Poll() = %v, want unseen entries oldest first %v", got, want)
+	}
+
+	// vid3 was not handled, so it stays pending although the feed is unchanged.
+	p.MarkSeen("UC123", "vid2")
+	entries, err = p.Poll(context.Background(), "UC123")
+	if err != nil {
+		t.Fatalf("second Poll() error = %v", err)
+	}
+	if got, want := entryIDs(entries), []string{"vid3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second Poll() = %v, want %v", got, want)
+	}
+	if *served != 1 {
+		t.Errorf("feed served %d times, want 1 full response and a 304", *served)
+	}
+
+	p.MarkSeen("UC123", "vid3")
+	entries, err = p.Poll(context.Background(), "UC123")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("third Poll() = %v, %v, want no entries", entryIDs(entries), err)
+	}
+}
+
+func TestPoller_PollError(t *testing.T) {
+	srv, _ := newFeedServer(t)
+	p := newTestPoller(srv)
+
+	if _, err := p.Poll(context.Background(), "UCmissing"); err == nil {
+		t.Error("Poll() of a missing feed should fail")
+	}
+}
+
+func TestPoller_PollCancelled(t *testing.T) {
+	srv, _ := newFeedServer(t)
+	p := newTestPoller(srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Poll(ctx, "UC123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Poll() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestState_LoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", STATE_FILE_NAME)
+
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() of a missing file error = %v", err)
+	}
+
+	srv, _ := newFeedServer(t)
+	p := newTestPoller(srv)
+	p.State = state
+	if _, err := p.Poll(context.Background(), "UC123"); err != nil {
+		t.Fatal(err)
+	}
+	p.MarkSeen("UC123", "vid1")
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	cs := loaded.Channels["UC123"]
+	if cs == nil || cs.ETag != testETag || cs.LastModified != testLastModified {
+		t.Fatalf("LoadState() channel = %+v, want the saved validators", cs)
+	}
+	if !reflect.DeepEqual(cs.Seen, []string{"vid1"}) || !reflect.DeepEqual(entryIDs(cs.Pending), []string{"vid2", "vid3"}) {
+		t.Errorf("LoadState() seen %v, pending %v", cs.Seen, entryIDs(cs.Pending))
+	}
+}
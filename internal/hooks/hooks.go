@@ -0,0 +1,246 @@
+// Package hooks runs user commands after every downloaded video, such as
+// transcoding, indexing or notifications. Hooks are defined in a JSON file in
+// drop-tube's data directory, never in a job's configuration, so that only
+// the user running drop-tube decides which commands run.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+const (
+	FILE_NAME = "hooks.json"
+
+	DEFAULT_TIMEOUT = 10 * time.Minute
+
+	// POLICY_IGNORE ignores a failing hook.
+	POLICY_IGNORE Policy = "ignore"
+	// POLICY_WARN logs a warning for a failing hook.
+	POLICY_WARN Policy = "warn"
+	// POLICY_FAIL marks the video, and with it the run or job, as failed and
+	// skips the remaining hooks of the video.
+	POLICY_FAIL Policy = "fail"
+)
+
+// waitDelay bounds how long the output of a hook that exited or was killed
+// is still read, e.g. from background processes it started.
+const waitDelay = 5 * time.Second
+
+// Policy is what happens when a hook fails.
+type Policy string
+
+// Hook is a command run for every downloaded video. It receives the
+// video's downloader.Result as JSON on stdin and the environment variables
+// DROP_TUBE_PATH, DROP_TUBE_TITLE, DROP_TUBE_ID and DROP_TUBE_URL, and runs
+// in the directory of the downloaded file. Its output is logged.
+type Hook struct {
+	Name string `json:"name"`
+	// Command is the program and its arguments. It is not run by a shell;
+	// use ["sh", "-c", "..."] for shell syntax.
+	Command []string `json:"command"`
+	// Timeout is a duration such as "30s". It is DEFAULT_TIMEOUT unless set.
+	Timeout string `json:"timeout,omitempty"`
+	// OnFailure is POLICY_WARN unless set.
+	OnFailure Policy `json:"on_failure,omitempty"`
+}
+
+// File is the stored list of hooks, run in order.
+type File struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// DefaultPath returns the location of the hook file in the data directory.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FILE_NAME), nil
+}
+
+// Load reads and validates the hook file at path. A missing file has no
+// hooks.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{Hooks: []Hook{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks %s: %w", path, err)
+	}
+
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse hooks %s: %w", path, err)
+	}
+	if f.Hooks == nil {
+		f.Hooks = []Hook{}
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hooks %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks every hook.
+func (f *File) Validate() error {
+	for _, h := range f.Hooks {
+		if err := h.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the name, command, timeout and failure policy of the hook.
+func (h Hook) Validate() error {
+	if strings.TrimSpace(h.Name) == "" {
+		return fmt.Errorf("hook name is required")
+	}
+	if len(h.Command) == 0 || h.Command[0] == "" {
+		return fmt.Errorf("hook %q: command is required", h.Name)
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("hook %q: invalid timeout %q", h.Name, h.Timeout)
+		}
+	}
+	switch h.OnFailure {
+	case "", POLICY_IGNORE, POLICY_WARN, POLICY_FAIL:
+	default:
+		return fmt.Errorf("hook %q: invalid failure policy %q: must be %s, %s or %s", h.Name, h.OnFailure, POLICY_IGNORE, POLICY_WARN, POLICY_FAIL)
+	}
+	return nil
+}
+
+// Policy returns the failure policy, POLICY_WARN unless set.
+func (h Hook) Policy() Policy {
+	if h.OnFailure == "" {
+		return POLICY_WARN
+	}
+	return h.OnFailure
+}
+
+// timeout returns how long the hook may run.
+func (h Hook) timeout() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DEFAULT_TIMEOUT
+}
+
+// AfterDownload returns a downloader.Hook running the hooks of the file, or
+// nil if there are none.
+func (f *File) AfterDownload() downloader.Hook {
+	if len(f.Hooks) == 0 {
+		return nil
+	}
+	return f.Run
+}
+
+// Run runs the hooks for a downloaded video in order and applies their
+// failure policies. It returns the error of a hook with POLICY_FAIL.
+func (f *File) Run(ctx context.Context, r downloader.Result) error {
+	for _, h := range f.Hooks {
+		err := h.Run(ctx, r)
+		if err == nil {
+			continue
+		}
+		switch h.Policy() {
+		case POLICY_FAIL:
+			return fmt.Errorf("hook %s: %w", h.Name, err)
+		case POLICY_WARN:
+			log.Printf("warning: hook %s failed for %s: %v", h.Name, describe(r), err)
+		}
+	}
+	return nil
+}
+
+// Run runs the hook for a downloaded video, logging its output line by
+// line.
+func (h Hook) Run(ctx context.Context, r downloader.Result) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"DROP_TUBE_PATH="+r.Path,
+		"DROP_TUBE_TITLE="+r.Title,
+		"DROP_TUBE_ID="+r.ID,
+		"DROP_TUBE_URL="+r.URL,
+	)
+	if r.Path != "" {
+		cmd.Dir = filepath.Dir(r.Path)
+	}
+	output := &logWriter{prefix: fmt.Sprintf("hook %s: ", h.Name)}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = waitDelay
+
+	err = cmd.Run()
+	output.flush()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", h.timeout())
+	}
+	return err
+}
+
+// describe names a video in log messages.
+func describe(r downloader.Result) string {
+	if r.Title != "" {
+		return r.Title
+	}
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Path
+}
+
+// logWriter logs the lines written to it with a prefix. A hook's stdout and
+// stderr share one writer, which exec writes to from a single goroutine.
+type logWriter struct {
+	prefix string
+	buf    []byte
+}
+
+// Write logs every complete line of p and keeps the rest for the next write.
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", w.prefix, bytes.TrimRight(w.buf[:i], "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs the incomplete last line, if any.
+func (w *logWriter) flush() {
+	if len(w.buf) > 0 {
+		log.Printf("%s%s", w.prefix, w.buf)
+		w.buf = nil
+	}
+}
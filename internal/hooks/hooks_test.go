@@ -0,0 +1,165 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+// captureLog redirects the log into a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests require a POSIX shell")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"hooks", `{"hooks": [{"name": "index", "command": ["updatedb"]}, {"name": "transcode", "command": ["sh", "-c", "true"], "timeout": "1h", "on_failure": "fail"}]}`, 2, false},
+		{"empty", `{}`, 0, false},
+		{"missing name", `{"hooks": [{"command": ["true"]}]}`, 0, true},
+		{"missing command", `{"hooks": [{"name": "x", "command": []}]}`, 0, true},
+		{"invalid timeout", `{"hooks": [{"name": "x", "command": ["true"], "timeout": "soon"}]}`, 0, true},
+		{"invalid policy", `{"hooks": [{"name": "x", "command": ["true"], "on_failure": "panic"}]}`, 0, true},
+		{"unknown field", `{"hooks": [{"name": "x", "command": ["true"], "shell": true}]}`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FILE_NAME)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(f.Hooks) != tt.want {
+				t.Errorf("Load() = %d hooks, want %d", len(f.Hooks), tt.want)
+			}
+		})
+	}
+
+	f, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(f.Hooks) != 0 || f.AfterDownload() != nil {
+		t.Errorf("Load() of a missing file = %+v, %v, want no hooks", f, err)
+	}
+}
+
+func TestHook_Run(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	result := downloader.Result{
+		ID:     "a",
+		Title:  "First video",
+		URL:    "https://www.youtube.com/watch?v=a",
+		Status: downloader.STATUS_DOWNLOADED,
+		Path:   filepath.Join(dir, "First video.mp4"),
+	}
+
+	t.Run("payload and environment", func(t *testing.T) {
+		logs := captureLog(t)
+		h := Hook{Name: "record", Command: []string{"sh", "-c",
+			`cat > payload.json; printf '%s|%s|%s|%s' "$DROP_TUBE_PATH" "$DROP_TUBE_TITLE" "$DROP_TUBE_ID" "$DROP_TUBE_URL" > env.txt; echo indexed; echo warning >&2`}}
+		if err := h.Run(context.Background(), result); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		var payload downloader.Result
+		data, _ := os.ReadFile(filepath.Join(dir, "payload.json"))
+		if err := json.Unmarshal(data, &payload); err != nil || payload != result {
+			t.Errorf("payload = %s, %v, want the result", data, err)
+		}
+		env, _ := os.ReadFile(filepath.Join(dir, "env.txt"))
+		if want := result.Path + "|First video|a|" + result.URL; string(env) != want {
+			t.Errorf("environment = %q, want %q", env, want)
+		}
+		for _, line := range []string{"hook record: indexed", "hook record: warning"} {
+			if !strings.Contains(logs.String(), line) {
+				t.Errorf("log %q does not contain %q", logs, line)
+			}
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		captureLog(t)
+		h := Hook{Name: "fail", Command: []string{"sh", "-c", "exit 3"}}
+		if err := h.Run(context.Background(), result); err == nil {
+			t.Error("Run() of a failing command should fail")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		captureLog(t)
+		h := Hook{Name: "slow", Command: []string{"sleep", "10"}, Timeout: "100ms"}
+		start := time.Now()
+		err := h.Run(context.Background(), result)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Run() error = %v, want a timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Run() took %s, want it stopped at the timeout", elapsed)
+		}
+	})
+}
+
+func TestFile_Run(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	result := downloader.Result{ID: "a", Status: downloader.STATUS_DOWNLOADED, Path: filepath.Join(dir, "a.mp4")}
+	failing := []string{"sh", "-c", "exit 1"}
+	marker := Hook{Name: "after", Command: []string{"touch", "after"}}
+
+	tests := []struct {
+		policy    Policy
+		wantErr   bool
+		wantWarn  bool
+		wantAfter bool
+	}{
+		{POLICY_IGNORE, false, false, true},
+		{"", false, true, true},
+		{POLICY_WARN, false, true, true},
+		{POLICY_FAIL, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			logs := captureLog(t)
+			os.Remove(filepath.Join(dir, "after"))
+			f := &File{Hooks: []Hook{{Name: "check", Command: failing, OnFailure: tt.policy}, marker}}
+
+			err := f.AfterDownload()(context.Background(), result)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if warned := strings.Contains(logs.String(), "warning: hook check failed"); warned != tt.wantWarn {
+				t.Errorf("warning logged = %v, want %v", warned, tt.wantWarn)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "after")); (err == nil) != tt.wantAfter {
+				t.Errorf("later hook ran = %v, want %v", err == nil, tt.wantAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package mirror
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// localIDRegex extracts the 11-character YouTube video ID from file names
+// written with OUTPUT_TEMPLATE, including intermediate files such as
+// "title [id].f137.mp4.part".
+var localIDRegex = regexp.MustCompile(`\[([\w-]{11})\](?:\.[\w-]+)+$`)
+
+// readArchive returns the video IDs recorded in a yt-dlp download archive.
+// A missing archive is treated as empty.
+func readArchive(path string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open download archive %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Archive lines have the form "<extractor> <video ID>".
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			ids[fields[1]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read download archive %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// removeFromArchive rewrites the download archive without the given IDs.
+func removeFromArchive(path string, ids map[string]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read download archive %s: %w", path, err)
+	}
+
+	kept := []string{}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && ids[fields[1]] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write download archive %s: %w", path, err)
+	}
+	return nil
+}
+
+// scanLocalFiles maps video IDs to the files in dir that belong to them.
+func scanLocalFiles(dir string) (map[string][]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	local := make(map[string][]string)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if matches := localIDRegex.FindStringSubmatch(f.Name()); len(matches) > 1 {
+			local[matches[1]] = append(local[matches[1]], filepath.Join(dir, f.Name()))
+		}
+	}
+	return local, nil
+}
@@ -0,0 +1,252 @@
+// Package mirror keeps a local directory in sync with a YouTube channel.
+// Downloaded videos are tracked in a yt-dlp download archive inside the
+// directory, and file names carry the video ID so that local files can be
+// matched to the channel's uploads.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+const (
+	ARCHIVE_FILE_NAME = ".drop-tube-archive"
+	OUTPUT_TEMPLATE   = "%(title)s [%(id)s].%(ext)s"
+)
+
+// Options controls how a channel is mirrored.
+type Options struct {
+	// Prune removes local files of videos that are no longer on the channel.
+	Prune bool
+	// AfterDownload is run for every downloaded video if set.
+	AfterDownload downloader.Hook
+	// Context stops the sync's downloads when it is cancelled if set.
+	Context context.Context
+}
+
+// Summary describes the changes made by a sync.
+type Summary struct {
+	Added    []downloader.Result `json:"added"`
+	Removed  []string            `json:"removed"`
+	Existing int                 `json:"existing"`
+	Report   *downloader.Report  `json:"report,omitempty"`
+}
+
+// Syncer mirrors the channel configured in cfg.URL into cfg.OutputDir.
+type Syncer struct {
+	config  *config.Config
+	options Options
+}
+
+// New creates a Syncer. The configuration is copied and adjusted for
+// mirroring: playlist mode, the directory's download archive and an output
+// template that includes the video ID. A channel's home page is synced from
+// its videos tab unless another tab is configured.
+func New(cfg *config.Config, opts Options) *Syncer {
+	syncCfg := *cfg
+	if syncCfg.Tab == "" && youtubeurl.IsChannelHome(syncCfg.URL) {
+		syncCfg.Tab = youtubeurl.TAB_VIDEOS
+	}
+	syncCfg.Playlist = true
+	syncCfg.DryRun = false
+	syncCfg.OutputTemplate = OUTPUT_TEMPLATE
+	syncCfg.ArchiveFile = filepath.Join(syncCfg.OutputDir, ARCHIVE_FILE_NAME)
+
+	return &Syncer{
+		config:  &syncCfg,
+		options: opts,
+	}
+}
+
+// Sync lists the channel's uploads, downloads the ones that are neither in
+// the download archive nor present locally and, if requested, prunes local
+// files of videos no longer on the channel. If some channel tabs could not be
+// listed, the uploads of the others are downloaded but nothing is pruned.
+func (s *Syncer) Sync() (*Summary, error) {
+	if s.options.Prune && s.config.Latest > 0 {
+		return nil, fmt.Errorf("cannot prune when only the latest uploads are listed")
+	}
+
+	entries, listErr := s.downloader().ListEntries()
+	if listErr != nil && !errors.Is(listErr, downloader.ErrIncompleteListing) {
+		return nil, fmt.Errorf("failed to list channel uploads: %w", listErr)
+	}
+
+	summary, dlErr := s.SyncEntries(entries)
+	if dlErr != nil && !errors.Is(dlErr, downloader.ErrPartialFailure) {
+		return summary, dlErr
+	}
+
+	if listErr != nil && s.options.Prune {
+		return summary, errors.Join(dlErr, fmt.Errorf("refusing to prune: %w", listErr))
+	}
+
+	if s.options.Prune {
+		removed, err := s.prune(entries)
+		summary.Removed = removed
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, dlErr
+}
+
+// SyncEntries downloads the given channel entries that are neither in the
+// download archive nor present locally. It is used when the entries come
+// from another source than a full channel listing, such as the channel's
+// feed, and never prunes.
+func (s *Syncer) SyncEntries(entries []playlist.Entry) (*Summary, error) {
+	archived, err := readArchive(s.config.ArchiveFile)
+	if err != nil {
+		return nil, err
+	}
+	local, err := scanLocalFiles(s.config.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	known := func(id string) bool { return archived[id] || len(local[id]) > 0 }
+	summary := &Summary{Added: []downloader.Result{}, Removed: []string{}}
+	for _, e := range entries {
+		if known(e.ID) {
+			summary.Existing++
+		}
+	}
+
+	// Selection and filters apply to all entries so that options such as
+	// --max-items refer to the channel's uploads, not just the new ones.
+	dl := s.downloader()
+	selected, skipped, err := dl.SelectEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	selected = slices.DeleteFunc(selected, func(e playlist.Entry) bool { return known(e.ID) })
+	skipped = slices.DeleteFunc(skipped, func(e playlist.Skipped) bool { return known(e.ID) })
+
+	report, dlErr := dl.DownloadEntries(selected, skipped)
+	if report != nil {
+		summary.Report = report
+		for _, res := range report.Results {
+			if res.Status == downloader.STATUS_DOWNLOADED {
+				summary.Added = append(summary.Added, res)
+			}
+		}
+	}
+	return summary, dlErr
+}
+
+// downloader returns a downloader for the channel that stops with the
+// sync's context.
+func (s *Syncer) downloader() *downloader.Downloader {
+	dl := downloader.New(s.config)
+	if s.options.Context != nil {
+		dl.SetContext(s.options.Context)
+	}
+	dl.AfterDownload(s.options.AfterDownload)
+	return dl
+}
+
+// prune removes the local files of videos recorded in the download archive
+// that are not among the channel entries, and drops those IDs from the
+// archive. Files of videos that were not downloaded by a sync are kept.
+func (s *Syncer) prune(entries []playlist.Entry) ([]string, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("refusing to prune: the channel listing is empty")
+	}
+	archived, err := readArchive(s.config.ArchiveFile)
+	if err != nil {
+		return nil, err
+	}
+	local, err := scanLocalFiles(s.config.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	onChannel := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		onChannel[e.ID] = true
+	}
+
+	removed := []string{}
+	gone := make(map[string]bool)
+	for id, paths := range local {
+		if onChannel[id] || !archived[id] {
+			continue
+		}
+		gone[id] = true
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil {
+				return removed, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+
+	if err := removeFromArchive(s.config.ArchiveFile, gone); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// Continue combines the summary of an interrupted sync with that of the sync
+// that continued it, which counts the videos the interrupted one downloaded
+// as already present. Either summary may be nil if its sync failed before
+// downloading.
+func (s *Summary) Continue(next *Summary) *Summary {
+	if s == nil {
+		return next
+	}
+	if next == nil {
+		return s
+	}
+
+	merged := *next
+	merged.Added = append(slices.Clone(s.Added), next.Added...)
+	merged.Removed = append(slices.Clone(s.Removed), next.Removed...)
+	if s.Report == nil || next.Report == nil {
+		return &merged
+	}
+
+	// Videos the continuing sync attempted again keep their new result.
+	attempted := make(map[string]bool, len(next.Report.Results))
+	for _, res := range next.Report.Results {
+		attempted[res.ID] = true
+	}
+	earlier := []downloader.Result{}
+	for _, res := range s.Report.Results {
+		if (res.Status == downloader.STATUS_DOWNLOADED || res.Status == downloader.STATUS_FAILED) && !attempted[res.ID] {
+			earlier = append(earlier, res)
+		}
+	}
+	merged.Existing = max(0, next.Existing-len(earlier))
+
+	report := *next.Report
+	report.StartedAt = s.Report.StartedAt
+	report.Results = append(earlier, next.Report.Results...)
+	merged.Report = &report
+	return &merged
+}
+
+// Print writes the summary of a sync.
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintf(w, "sync: %d added, %d removed, %d already present\n", len(s.Added), len(s.Removed), s.Existing)
+	for _, res := range s.Added {
+		fmt.Fprintf(w, "  added: [%s] %s\n", res.ID, res.Title)
+	}
+	for _, path := range s.Removed {
+		fmt.Fprintf(w, "  removed: %s\n", path)
+	}
+}
@@ -0,0 +1,258 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+// fakeYtDlp installs a shell script named yt-dlp at the front of PATH.
+func fakeYtDlp(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake yt-dlp: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+const fakeChannelScript = `
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*--dump-single-json*)
+	cat <<'JSON'
+{"_type": "playlist", "id": "UC1", "entries": [
+	{"id": "aaaaaaaaaaa", "title": "Archived", "url": "https://www.youtube.com/watch?v=aaaaaaaaaaa"},
+	{"id": "bbbbbbbbbbb", "title": "Local", "url": "https://www.youtube.com/watch?v=bbbbbbbbbbb"},
+	{"id": "ccccccccccc", "title": "New", "url": "https://www.youtube.com/watch?v=ccccccccccc"}
+]}
+JSON
+	;;
+*)
+	for arg in "$@"; do
+		case "$arg" in
+		*watch?v=*)
+			echo "[youtube] Extracting URL: $arg"
+			echo "[download] 100% of 1.00MiB"
+			echo "$arg" >> "$FAKE_DOWNLOADS"
+			;;
+		esac
+	done
+	;;
+esac
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	fakeYtDlp(t, fakeChannelScript)
+	dir := t.TempDir()
+	downloads := filepath.Join(t.TempDir(), "downloads")
+	t.Setenv("FAKE_DOWNLOADS", downloads)
+
+	writeFile(t, filepath.Join(dir, ARCHIVE_FILE_NAME), "youtube aaaaaaaaaaa\nyoutube zzzzzzzzzzz\n")
+	writeFile(t, filepath.Join(dir, "Local [bbbbbbbbbbb].mp4"), "")
+	writeFile(t, filepath.Join(dir, "Gone [zzzzzzzzzzz].mp4"), "")
+	// Files that were not downloaded by a sync are never pruned.
+	writeFile(t, filepath.Join(dir, "Mine [yyyyyyyyyyy].mp4"), "")
+	writeFile(t, filepath.Join(dir, "notes [draft].txt"), "")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "")
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/@example/videos"
+	cfg.OutputDir = dir
+
+	summary, err := New(cfg, Options{Prune: true}).Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(summary.Added) != 1 || summary.Added[0].ID != "ccccccccccc" {
+		t.Errorf("Sync() added = %+v, want only ccccccccccc", summary.Added)
+	}
+	if summary.Existing != 2 {
+		t.Errorf("Sync() existing = %d, want 2", summary.Existing)
+	}
+	if want := []string{filepath.Join(dir, "Gone [zzzzzzzzzzz].mp4")}; !reflect.DeepEqual(summary.Removed, want) {
+		t.Errorf("Sync() removed = %v, want %v", summary.Removed, want)
+	}
+
+	data, err := os.ReadFile(downloads)
+	if err != nil {
+		t.Fatalf("nothing was downloaded: %v", err)
+	}
+	if string(data) != "https://www.youtube.com/watch?v=ccccccccccc\n" {
+		t.Errorf("downloaded %q, want only the new video", data)
+	}
+
+	archived, err := readArchive(filepath.Join(dir, ARCHIVE_FILE_NAME))
+	if err != nil {
+		t.Fatalf("readArchive() error = %v", err)
+	}
+	if archived["zzzzzzzzzzz"] || !archived["aaaaaaaaaaa"] {
+		t.Errorf("archive = %v, want zzzzzzzzzzz pruned and aaaaaaaaaaa kept", archived)
+	}
+	for _, name := range []string{"Mine [yyyyyyyyyyy].mp4", "notes [draft].txt", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("unrelated file was removed: %v", err)
+		}
+	}
+}
+
+func TestSyncer_Sync_IncompleteListing(t *testing.T) {
+	fakeYtDlp(t, `
+case "$*" in
+*--dump-single-json*/videos*)
+	echo '{"_type": "playlist", "id": "UC1", "entries": [{"id": "aaaaaaaaaaa", "title": "Archived"}]}'
+	;;
+*--dump-single-json*)
+	echo "ERROR: [youtube:tab] This channel does not have a tab" >&2
+	exit 1
+	;;
+esac
+`)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ARCHIVE_FILE_NAME), "youtube aaaaaaaaaaa\nyoutube sssssssssss\n")
+	writeFile(t, filepath.Join(dir, "Short [sssssssssss].mp4"), "")
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/@example"
+	cfg.OutputDir = dir
+	cfg.Tab = "all"
+
+	summary, err := New(cfg, Options{Prune: true}).Sync()
+	if !errors.Is(err, downloader.ErrIncompleteListing) {
+		t.Fatalf("Sync() error = %v, want ErrIncompleteListing", err)
+	}
+	if summary == nil || len(summary.Removed) != 0 {
+		t.Errorf("Sync() removed files of an incomplete listing: %+v", summary)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Short [sssssssssss].mp4")); err != nil {
+		t.Errorf("file of an unlisted tab was removed: %v", err)
+	}
+
+	if _, err := New(cfg, Options{}).Sync(); err != nil {
+		t.Errorf("Sync() without pruning error = %v", err)
+	}
+}
+
+func TestSyncer_Sync_ChannelHome(t *testing.T) {
+	fakeYtDlp(t, `
+case "$*" in
+*--dump-single-json*/videos*)
+	echo '{"_type": "playlist", "id": "UC1", "entries": [{"id": "aaaaaaaaaaa", "title": "Archived"}]}'
+	;;
+*--dump-single-json*)
+	echo '{"_type": "playlist", "id": "UC1", "entries": [{"_type": "url", "id": "UC1", "title": "Example - Videos", "url": "https://www.youtube.com/@example/videos"}]}'
+	;;
+esac
+`)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ARCHIVE_FILE_NAME), "youtube aaaaaaaaaaa\n")
+	writeFile(t, filepath.Join(dir, "Archived [aaaaaaaaaaa].mp4"), "")
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/@example"
+	cfg.OutputDir = dir
+
+	summary, err := New(cfg, Options{Prune: true}).Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if summary.Existing != 1 || len(summary.Removed) != 0 {
+		t.Errorf("Sync() of the channel home = %+v, want the videos tab listed", summary)
+	}
+}
+
+func TestSummary_Continue(t *testing.T) {
+	first := &Summary{
+		Added:    []downloader.Result{{ID: "aaaaaaaaaaa", Status: downloader.STATUS_DOWNLOADED}},
+		Removed:  []string{},
+		Existing: 1,
+		Report: &downloader.Report{StartedAt: time.Unix(100, 0), Results: []downloader.Result{
+			{ID: "aaaaaaaaaaa", Status: downloader.STATUS_DOWNLOADED},
+			{ID: "bbbbbbbbbbb", Status: downloader.STATUS_FAILED, Reason: "interrupted", Transient: true},
+		}},
+	}
+	next := &Summary{
+		Added:    []downloader.Result{{ID: "bbbbbbbbbbb", Status: downloader.STATUS_DOWNLOADED}},
+		Removed:  []string{"Gone [zzzzzzzzzzz].mp4"},
+		Existing: 2,
+		Report: &downloader.Report{StartedAt: time.Unix(200, 0), Results: []downloader.Result{
+			{ID: "bbbbbbbbbbb", Status: downloader.STATUS_DOWNLOADED},
+		}},
+	}
+
+	merged := first.Continue(next)
+	var ids []string
+	for _, res := range merged.Report.Results {
+		ids = append(ids, res.ID+" "+string(res.Status))
+	}
+	if want := []string{"aaaaaaaaaaa downloaded", "bbbbbbbbbbb downloaded"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Continue() results = %v, want %v", ids, want)
+	}
+	if len(merged.Added) != 2 || merged.Existing != 1 || len(merged.Removed) != 1 {
+		t.Errorf("Continue() = %d added, %d existing, %d removed, want 2, 1, 1", len(merged.Added), merged.Existing, len(merged.Removed))
+	}
+	if !merged.Report.StartedAt.Equal(time.Unix(100, 0)) {
+		t.Errorf("Continue() started at %v, want the start of the interrupted sync", merged.Report.StartedAt)
+	}
+
+	if got := (*Summary)(nil).Continue(next); got != next {
+		t.Errorf("Continue() of no earlier summary = %+v, want the next one", got)
+	}
+	if got := first.Continue(nil); got != first {
+		t.Errorf("Continue() with no next summary = %+v, want the earlier one", got)
+	}
+}
+
+func TestScanLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"A [abc-123_XYZ].mp4", "A [abc-123_XYZ].f137.mp4.part", "B [defghijklmn].webm", "C [draft].txt", "plain.mp4"} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+
+	local, err := scanLocalFiles(dir)
+	if err != nil {
+		t.Fatalf("scanLocalFiles() error = %v", err)
+	}
+
+	ids := []string{}
+	for id := range local {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"abc-123_XYZ", "defghijklmn"}) {
+		t.Errorf("scanLocalFiles() ids = %v", ids)
+	}
+	if len(local["abc-123_XYZ"]) != 2 {
+		t.Errorf("scanLocalFiles() files for abc-123_XYZ = %v, want 2", local["abc-123_XYZ"])
+	}
+}
+
+func TestReadArchive_Missing(t *testing.T) {
+	ids, err := readArchive(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(ids) != 0 {
+		t.Errorf("readArchive() = %v, %v, want empty archive", ids, err)
+	}
+}
@@ -0,0 +1,326 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TLS_STARTTLS upgrades the connection with STARTTLS and fails if the
+	// server does not support it.
+	TLS_STARTTLS = "starttls"
+	// TLS_IMPLICIT connects with TLS, usually to port 465.
+	TLS_IMPLICIT = "tls"
+	// TLS_NONE sends unencrypted, for relays on the local machine or
+	// network. Authentication is only allowed to localhost.
+	TLS_NONE = "none"
+)
+
+// defaultEmailEvents are the events sent by email unless configured: the
+// ones with a summary.
+var defaultEmailEvents = []string{EVENT_JOB_FINISHED, EVENT_JOB_FAILED, EVENT_RUN_FINISHED}
+
+// tlsRootCAs are the certificate authorities trusted for SMTP servers, the
+// system's if nil.
+var tlsRootCAs *x509.CertPool
+
+// Email sends notifications through an SMTP server.
+type Email struct {
+	Host string `json:"host"`
+	// Port is 587 for TLS_STARTTLS, 465 for TLS_IMPLICIT and 25 for TLS_NONE
+	// unless set.
+	Port int `json:"port,omitempty"`
+	// TLS is TLS_STARTTLS unless set.
+	TLS string `json:"tls,omitempty"`
+	// Username and Password authenticate with PLAIN authentication if set.
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Events are the events sent by email, job.finished, job.failed and
+	// run.finished unless set.
+	Events []string `json:"events,omitempty"`
+	// Timeout is a duration such as "30s" bounding the whole delivery. It is
+	// DEFAULT_TIMEOUT unless set.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Validate checks the server, addresses, events and timeout.
+func (e Email) Validate() error {
+	if e.Host == "" {
+		return fmt.Errorf("email host is required")
+	}
+	if e.Port < 0 || e.Port > 65535 {
+		return fmt.Errorf("email: invalid port %d", e.Port)
+	}
+	switch e.TLS {
+	case "", TLS_STARTTLS, TLS_IMPLICIT, TLS_NONE:
+	default:
+		return fmt.Errorf("email: invalid tls %q: must be %s, %s or %s", e.TLS, TLS_STARTTLS, TLS_IMPLICIT, TLS_NONE)
+	}
+	if e.Password != "" && e.Username == "" {
+		return fmt.Errorf("email: password is set without a username")
+	}
+	if _, err := mail.ParseAddress(e.From); err != nil {
+		return fmt.Errorf("email: invalid from address %q: %w", e.From, err)
+	}
+	if len(e.To) == 0 {
+		return fmt.Errorf("email: at least one to address is required")
+	}
+	for _, to := range e.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("email: invalid to address %q: %w", to, err)
+		}
+	}
+	for _, ev := range e.Events {
+		if !slices.Contains(events, ev) {
+			return fmt.Errorf("email: unknown event %q", ev)
+		}
+	}
+	if e.Timeout != "" {
+		if d, err := time.ParseDuration(e.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("email: invalid timeout %q", e.Timeout)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the event is sent by email.
+func (e Email) Wants(event string) bool {
+	if len(e.Events) == 0 {
+		return slices.Contains(defaultEmailEvents, event)
+	}
+	return slices.Contains(e.Events, event)
+}
+
+// String names the email target in log messages.
+func (e Email) String() string {
+	return "email to " + strings.Join(e.To, ", ")
+}
+
+// tlsMode returns the TLS setting.
+func (e Email) tlsMode() string {
+	if e.TLS == "" {
+		return TLS_STARTTLS
+	}
+	return e.TLS
+}
+
+// addr returns the server's host and port.
+func (e Email) addr() string {
+	port := e.Port
+	if port == 0 {
+		switch e.tlsMode() {
+		case TLS_IMPLICIT:
+			port = 465
+		case TLS_NONE:
+			port = 25
+		default:
+			port = 587
+		}
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(port))
+}
+
+// timeout returns how long a delivery may take.
+func (e Email) timeout() time.Duration {
+	if d, err := time.ParseDuration(e.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DEFAULT_TIMEOUT
+}
+
+// Send delivers the message as an email with a plain text and an HTML part.
+func (e Email) Send(m Message) error {
+	msg, err := e.Compose(m)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{ServerName: e.Host, RootCAs: tlsRootCAs}
+	dialer := &net.Dialer{Timeout: e.timeout()}
+	var conn net.Conn
+	if e.tlsMode() == TLS_IMPLICIT {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.addr(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", e.addr())
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(e.timeout()))
+
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if e.tlsMode() == TLS_STARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", e.addr())
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(e.From)
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := c.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", addr.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Compose returns the email of the message: a multipart/alternative message
+// with the summary as plain text and HTML.
+func (e Email) Compose(m Message) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		write       func(io.Writer) error
+	}{
+		{"text/plain; charset=utf-8", func(w io.Writer) error { return writeText(w, m) }},
+		{"text/html; charset=utf-8", func(w io.Writer) error { return htmlTemplate.Execute(w, m) }},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if err := p.write(qw); err != nil {
+			return nil, fmt.Errorf("failed to write email: %w", err)
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&msg, "%s: %s\r\n", name, value) }
+	header("From", formatAddress(e.From))
+	to := make([]string, len(e.To))
+	for i, addr := range e.To {
+		to[i] = formatAddress(addr)
+	}
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Title()))
+	header("Date", m.Time.Format(time.RFC1123Z))
+	header("Message-ID", messageID(e.Host))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// formatAddress formats a validated address for a header, encoding
+// non-ASCII names.
+func formatAddress(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return a.String()
+}
+
+// messageID returns a unique Message-ID header value.
+func messageID(host string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + host + ">"
+}
+
+// writeText writes the plain text body: the title, the counts and every
+// failed video with its reason.
+func writeText(w io.Writer, m Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\r\n", m.Title())
+	if s := m.Summary; s != nil {
+		fmt.Fprintf(&b, "\r\n%s\r\n", s.Counts())
+		if s.Error != "" {
+			fmt.Fprintf(&b, "error: %s\r\n", s.Error)
+		}
+		if len(s.Failures) > 0 {
+			b.WriteString("\r\nFailed videos:\r\n")
+			for _, r := range s.Failures {
+				fmt.Fprintf(&b, "- %s", describe(r.Title, r.ID, r.URL))
+				if r.URL != "" {
+					fmt.Fprintf(&b, " <%s>", r.URL)
+				}
+				fmt.Fprintf(&b, ": %s\r\n", r.Reason)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// htmlTemplate renders the HTML body with the same content as writeText.
+var htmlTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"bytes":    FormatBytes,
+	"describe": describe,
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+{{with .Summary}}<table cellpadding="4">
+<tr><th align="left">Downloaded</th><td>{{.Downloaded}} ({{bytes .TotalBytes}})</td></tr>
+<tr><th align="left">Skipped</th><td>{{.Skipped}}</td></tr>
+<tr><th align="left">Failed</th><td>{{.Failed}}</td></tr>
+<tr><th align="left">Aborted</th><td>{{.Aborted}}</td></tr>
+</table>
+{{if .Error}}<p><strong>Error:</strong> {{.Error}}</p>
+{{end}}{{if .Failures}}<h3>Failed videos</h3>
+<ul>
+{{range .Failures}}<li>{{if .URL}}<a href="{{.URL}}">{{describe .Title .ID .URL}}</a>{{else}}{{describe .Title .ID .URL}}{{end}}: {{.Reason}}</li>
+{{end}}</ul>
+{{end}}{{end}}</body>
+</html>
+`))
@@ -0,0 +1,387 @@
+package notify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+// smtpServer is a minimal SMTP server standing in for a mail server.
+type smtpServer struct {
+	listener net.Listener
+	// starttls offers STARTTLS with this configuration if set.
+	starttls *tls.Config
+
+	mu         sync.Mutex
+	auth       string
+	from       string
+	recipients []string
+	data       string
+	tls        bool
+}
+
+// startSMTPServer serves SMTP connections on a local port until the test
+// ends. With implicit set, connections are TLS from the start.
+func startSMTPServer(t *testing.T, starttls, implicit *tls.Config) *smtpServer {
+	t.Helper()
+	var l net.Listener
+	var err error
+	if implicit != nil {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", implicit)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: l, starttls: starttls, tls: implicit != nil}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// port returns the port the server listens on.
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	secure := s.tls
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"localhost"}
+			if s.starttls != nil && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			lines = append(lines, "AUTH PLAIN", "8BITMIME")
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.starttls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			secure = true
+			s.mu.Lock()
+			s.tls = true
+			s.mu.Unlock()
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, arg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// received returns the delivered message.
+func (s *smtpServer) received() (auth, from string, recipients []string, data string, secure bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth, s.from, s.recipients, s.data, s.tls
+}
+
+// testCertificate creates a self-signed certificate for 127.0.0.1 and
+// trusts it for the test.
+func testCertificate(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	previous := tlsRootCAs
+	tlsRootCAs = pool
+	t.Cleanup(func() { tlsRootCAs = previous })
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// summaryMessage returns a finished run with a failure whose title needs
+// escaping in HTML.
+func summaryMessage() Message {
+	return Message{
+		Event: EVENT_RUN_FINISHED,
+		Time:  time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		Summary: &Summary{
+			Name:       "subscriptions sync",
+			Downloaded: 3,
+			Skipped:    1,
+			Failed:     1,
+			TotalBytes: 5 << 30,
+			Failures: []downloader.Result{{
+				ID: "b", Title: "Tom & Jerry <live>", URL: "https://www.youtube.com/watch?v=b",
+				Status: downloader.STATUS_FAILED, Reason: "Private video",
+			}},
+			Error: "1 of 5 videos failed",
+		},
+	}
+}
+
+// readEmail parses a delivered email into its subject and its decoded
+// plain text and HTML parts.
+func readEmail(t *testing.T, data string) (subject, text, html string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid email: %v\n%s", err, data)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+	return subject, text, html
+}
+
+func TestEmail_Send(t *testing.T) {
+	cert := testCertificate(t)
+	tests := []struct {
+		name      string
+		tlsMode   string
+		starttls  *tls.Config
+		implicit  *tls.Config
+		username  string
+		wantTLS   bool
+		wantError string
+	}{
+		{"unencrypted with auth", TLS_NONE, nil, nil, "archiver", false, ""},
+		{"starttls", "", cert, nil, "archiver", true, ""},
+		{"implicit tls", TLS_IMPLICIT, nil, cert, "", true, ""},
+		{"starttls unsupported", TLS_STARTTLS, nil, nil, "", false, "does not support STARTTLS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startSMTPServer(t, tt.starttls, tt.implicit)
+			e := Email{
+				Host:     "127.0.0.1",
+				Port:     srv.port(),
+				TLS:      tt.tlsMode,
+				Username: tt.username,
+				From:     "drop-tube <archive@example.com>",
+				To:       []string{"alice@example.com", "Bob <bob@example.com>"},
+				Timeout:  "5s",
+			}
+			if e.Username != "" {
+				e.Password = "hunter2"
+			}
+			if err := e.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			err := e.Send(summaryMessage())
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Send() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			auth, from, recipients, data, secure := srv.received()
+			if secure != tt.wantTLS {
+				t.Errorf("connection encrypted = %v, want %v", secure, tt.wantTLS)
+			}
+			if wantAuth := "\x00archiver\x00hunter2"; tt.username != "" && auth != wantAuth {
+				t.Errorf("AUTH = %q, want %q", auth, wantAuth)
+			}
+			if !strings.HasPrefix(from, "FROM:<archive@example.com>") {
+				t.Errorf("MAIL %s, want the from address", from)
+			}
+			if strings.Join(recipients, ",") != "TO:<alice@example.com>,TO:<bob@example.com>" {
+				t.Errorf("RCPT %v, want both recipients", recipients)
+			}
+
+			subject, text, html := readEmail(t, data)
+			if subject != "drop-tube run finished with failures: subscriptions sync" {
+				t.Errorf("Subject = %q", subject)
+			}
+			for _, want := range []string{"3 downloaded (5.0 GiB), 1 skipped, 1 failed", "error: 1 of 5 videos failed", "- Tom & Jerry <live> <https://www.youtube.com/watch?v=b>: Private video"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("text part does not contain %q:\n%s", want, text)
+				}
+			}
+			for _, want := range []string{"<td>3 (5.0 GiB)</td>", `<a href="https://www.youtube.com/watch?v=b">Tom &amp; Jerry &lt;live&gt;</a>: Private video`} {
+				if !strings.Contains(html, want) {
+					t.Errorf("HTML part does not contain %q:\n%s", want, html)
+				}
+			}
+		})
+	}
+}
+
+func TestEmail_Validate(t *testing.T) {
+	valid := Email{Host: "smtp.example.com", From: "archive@example.com", To: []string{"alice@example.com"}}
+	tests := []struct {
+		name    string
+		modify  func(e *Email)
+		wantErr bool
+	}{
+		{"valid", func(e *Email) {}, false},
+		{"full", func(e *Email) {
+			e.Port, e.TLS, e.Username, e.Password, e.Events, e.Timeout = 465, TLS_IMPLICIT, "u", "p", []string{EVENT_JOB_FAILED}, "30s"
+		}, false},
+		{"missing host", func(e *Email) { e.Host = "" }, true},
+		{"invalid port", func(e *Email) { e.Port = 70000 }, true},
+		{"invalid tls", func(e *Email) { e.TLS = "ssl" }, true},
+		{"password without username", func(e *Email) { e.Password = "p" }, true},
+		{"invalid from", func(e *Email) { e.From = "archive" }, true},
+		{"no recipients", func(e *Email) { e.To = nil }, true},
+		{"invalid recipient", func(e *Email) { e.To = []string{"alice@example.com", "bob"} }, true},
+		{"unknown event", func(e *Email) { e.Events = []string{"run.started"} }, true},
+		{"invalid timeout", func(e *Email) { e.Timeout = "-1s" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := valid
+			tt.modify(&e)
+			if err := e.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmail_Wants(t *testing.T) {
+	e := Email{}
+	for event, want := range map[string]bool{EVENT_JOB_STARTED: false, EVENT_JOB_FINISHED: true, EVENT_JOB_FAILED: true, EVENT_RUN_FINISHED: true} {
+		if got := e.Wants(event); got != want {
+			t.Errorf("Wants(%s) = %v, want %v", event, got, want)
+		}
+	}
+	e.Events = []string{EVENT_JOB_STARTED}
+	if !e.Wants(EVENT_JOB_STARTED) || e.Wants(EVENT_RUN_FINISHED) {
+		t.Error("email should only want its events")
+	}
+}
+
+func TestEmail_Addr(t *testing.T) {
+	tests := []struct {
+		email Email
+		want  int
+	}{
+		{Email{Host: "mail"}, 587},
+		{Email{Host: "mail", TLS: TLS_IMPLICIT}, 465},
+		{Email{Host: "mail", TLS: TLS_NONE}, 25},
+		{Email{Host: "mail", Port: 2525}, 2525},
+	}
+	for _, tt := range tests {
+		if got := tt.email.addr(); got != "mail:"+strconv.Itoa(tt.want) {
+			t.Errorf("addr() = %q, want port %d", got, tt.want)
+		}
+	}
+}
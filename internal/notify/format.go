@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxListedFailures is how many failed videos a text message lists.
+const maxListedFailures = 10
+
+// Title returns a one-line description of the message.
+func (m Message) Title() string {
+	switch m.Event {
+	case EVENT_JOB_STARTED:
+		return fmt.Sprintf("drop-tube job %s started: %s", m.Job.ID, m.Job.URL)
+	case EVENT_JOB_FINISHED:
+		return fmt.Sprintf("drop-tube job %s finished: %s", m.Job.ID, m.Job.URL)
+	case EVENT_JOB_FAILED:
+		return fmt.Sprintf("drop-tube job %s failed: %s", m.Job.ID, m.Job.URL)
+	case EVENT_RUN_FINISHED:
+		if m.Summary.Error != "" || m.Summary.Failed > 0 {
+			return fmt.Sprintf("drop-tube run finished with failures: %s", m.Summary.Name)
+		}
+		return fmt.Sprintf("drop-tube run finished: %s", m.Summary.Name)
+	}
+	return "drop-tube " + m.Event
+}
+
+// Text returns the message as plain text for chat services: its title and,
+// for finished jobs and runs, the counts and the failed videos.
+func (m Message) Text() string {
+	var b strings.Builder
+	b.WriteString(m.Title())
+	if s := m.Summary; s != nil {
+		fmt.Fprintf(&b, "\n%s", s.Counts())
+		if s.Error != "" {
+			fmt.Fprintf(&b, "\nerror: %s", s.Error)
+		}
+		for i, r := range s.Failures {
+			if i == maxListedFailures {
+				fmt.Fprintf(&b, "\n• and %d more", len(s.Failures)-i)
+				break
+			}
+			fmt.Fprintf(&b, "\n• %s: %s", describe(r.Title, r.ID, r.URL), r.Reason)
+		}
+	}
+	return b.String()
+}
+
+// Counts returns the counts of the summary and the downloaded size.
+func (s *Summary) Counts() string {
+	return fmt.Sprintf("%d downloaded (%s), %d skipped, %d failed, %d aborted",
+		s.Downloaded, FormatBytes(s.TotalBytes), s.Skipped, s.Failed, s.Aborted)
+}
+
+// describe names a video by the first of its title, ID and URL that is set.
+func describe(names ...string) string {
+	for _, name := range names {
+		if name != "" {
+			return name
+		}
+	}
+	return "unknown video"
+}
+
+// FormatBytes formats a size with binary units, such as "1.5 GiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
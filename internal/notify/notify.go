@@ -0,0 +1,315 @@
+// Package notify tells webhooks and email recipients when daemon jobs
+// start, finish or fail and when runs finish. Notification targets are
+// defined in a JSON file in drop-tube's data directory, not in a job's
+// configuration, so that their secrets never end up in queued jobs or run
+// reports.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+const (
+	FILE_NAME = "notify.json"
+
+	EVENT_JOB_STARTED  = "job.started"
+	EVENT_JOB_FINISHED = "job.finished"
+	EVENT_JOB_FAILED   = "job.failed"
+	// EVENT_RUN_FINISHED is sent when a download, retry, sync or
+	// subscription sync run outside the daemon's queue finishes.
+	EVENT_RUN_FINISHED = "run.finished"
+)
+
+// events lists the valid event names.
+var events = []string{EVENT_JOB_STARTED, EVENT_JOB_FINISHED, EVENT_JOB_FAILED, EVENT_RUN_FINISHED}
+
+// deliveryBacklog is how many messages may wait for a target before new
+// ones are dropped, so that a slow target never holds up downloads.
+const deliveryBacklog = 100
+
+// File is the stored list of notification targets.
+type File struct {
+	Webhooks []Webhook `json:"webhooks"`
+	// Email sends summaries by email if set.
+	Email *Email `json:"email,omitempty"`
+}
+
+// DefaultPath returns the location of the notification file in the data
+// directory.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FILE_NAME), nil
+}
+
+// Load reads and validates the notification file at path. A missing file
+// has no targets.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{Webhooks: []Webhook{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notifications %s: %w", path, err)
+	}
+
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse notifications %s: %w", path, err)
+	}
+	if f.Webhooks == nil {
+		f.Webhooks = []Webhook{}
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid notifications %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks every target.
+func (f *File) Validate() error {
+	for _, w := range f.Webhooks {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.Email != nil {
+		return f.Email.Validate()
+	}
+	return nil
+}
+
+// sender is a notification target.
+type sender interface {
+	// Wants reports whether the target receives the event.
+	Wants(event string) bool
+	// Send delivers a message.
+	Send(m Message) error
+	// String names the target in log messages.
+	String() string
+}
+
+// senders returns the targets of the file.
+func (f *File) senders() []sender {
+	var senders []sender
+	for _, w := range f.Webhooks {
+		senders = append(senders, w)
+	}
+	if f.Email != nil {
+		senders = append(senders, *f.Email)
+	}
+	return senders
+}
+
+// Message is the JSON payload of a notification.
+type Message struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Job is set for job events.
+	Job *JobInfo `json:"job,omitempty"`
+	// Summary is set when a job or run finished.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// JobInfo describes the job of a job event.
+type JobInfo struct {
+	ID       string      `json:"id"`
+	URL      string      `json:"url"`
+	State    queue.State `json:"state"`
+	Owner    string      `json:"owner,omitempty"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Summary counts the outcomes of the videos of a finished job or run.
+type Summary struct {
+	// Name is what ran, such as the URL of a download or a subscription
+	// sync.
+	Name       string `json:"name"`
+	Downloaded int    `json:"downloaded"`
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	Aborted    int    `json:"aborted"`
+	// TotalBytes is the size of the downloaded files that still exist.
+	TotalBytes int64 `json:"total_bytes"`
+	// Failures are the failed videos with their reasons.
+	Failures []downloader.Result `json:"failures,omitempty"`
+	// Error is the error the run ended with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// NewSummary summarizes the reports of a run. Missing reports, such as
+// those of runs that failed before downloading, are skipped.
+func NewSummary(name string, reports []*downloader.Report, runErr error) *Summary {
+	var results []downloader.Result
+	for _, r := range reports {
+		if r != nil {
+			results = append(results, r.Results...)
+		}
+	}
+	s := summarize(name, results)
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+	return s
+}
+
+// summarize counts the results.
+func summarize(name string, results []downloader.Result) *Summary {
+	s := &Summary{Name: name}
+	for _, r := range results {
+		switch r.Status {
+		case downloader.STATUS_DOWNLOADED:
+			s.Downloaded++
+			if info, err := os.Stat(r.Path); err == nil && r.Path != "" {
+				s.TotalBytes += info.Size()
+			}
+		case downloader.STATUS_SKIPPED:
+			s.Skipped++
+		case downloader.STATUS_FAILED:
+			s.Failed++
+			s.Failures = append(s.Failures, r)
+		case downloader.STATUS_ABORTED:
+			s.Aborted++
+		}
+	}
+	return s
+}
+
+// jobMessage returns the message for a job's state change, or false if the
+// state is not notified.
+func jobMessage(job queue.Job) (Message, bool) {
+	m := Message{
+		Time: time.Now(),
+		Job: &JobInfo{
+			ID:       job.ID,
+			URL:      job.Config.URL,
+			State:    job.State,
+			Owner:    job.Owner,
+			Attempts: job.Attempts,
+			Error:    job.Error,
+		},
+	}
+	switch job.State {
+	case queue.STATE_RUNNING:
+		m.Event = EVENT_JOB_STARTED
+	case queue.STATE_DONE:
+		m.Event = EVENT_JOB_FINISHED
+	case queue.STATE_FAILED:
+		m.Event = EVENT_JOB_FAILED
+	default:
+		return Message{}, false
+	}
+	if job.Finished() {
+		m.Summary = summarize(job.Config.URL, job.Results)
+		m.Summary.Error = job.Error
+	}
+	return m, true
+}
+
+// Notifier delivers messages to the targets of a notification file in the
+// background. A nil Notifier sends nothing.
+type Notifier struct {
+	mu      sync.Mutex
+	closed  bool
+	targets []*target
+	wg      sync.WaitGroup
+}
+
+// target is a notification target and the messages waiting for it.
+type target struct {
+	sender  sender
+	pending chan Message
+}
+
+// New starts delivering to the targets of f. It returns nil if f has no
+// targets.
+func New(f *File) *Notifier {
+	senders := f.senders()
+	if len(senders) == 0 {
+		return nil
+	}
+	n := &Notifier{}
+	for _, s := range senders {
+		t := &target{sender: s, pending: make(chan Message, deliveryBacklog)}
+		n.targets = append(n.targets, t)
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			for m := range t.pending {
+				if err := t.sender.Send(m); err != nil {
+					log.Printf("%s: failed to deliver %s: %v", t.sender, m.Event, err)
+				}
+			}
+		}()
+	}
+	return n
+}
+
+// Job notifies about a job's state change. It can be registered with
+// queue.Queue.Observe; it does not block.
+func (n *Notifier) Job(job queue.Job) {
+	if m, ok := jobMessage(job); ok {
+		n.Send(m)
+	}
+}
+
+// RunFinished notifies about a finished run.
+func (n *Notifier) RunFinished(s *Summary) {
+	n.Send(Message{Event: EVENT_RUN_FINISHED, Time: time.Now(), Summary: s})
+}
+
+// Send queues a message for the targets that want its event. Messages for
+// targets that fall too far behind are dropped.
+func (n *Notifier) Send(m Message) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	for _, t := range n.targets {
+		if !t.sender.Wants(m.Event) {
+			continue
+		}
+		select {
+		case t.pending <- m:
+		default:
+			log.Printf("%s: too many pending notifications, dropping %s", t.sender, m.Event)
+		}
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones are
+// delivered or given up on.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, t := range n.targets {
+			close(t.pending)
+		}
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"webhooks", `{"webhooks": [{"name": "ci", "url": "https://example.com/hook", "secret": "s"}, {"name": "chat", "url": "https://hooks.slack.com/services/x", "format": "slack", "events": ["job.failed", "run.finished"]}]}`, 2, false},
+		{"empty", `{}`, 0, false},
+		{"email", `{"email": {"host": "smtp.example.com", "username": "u", "password": "p", "from": "archive@example.com", "to": ["alice@example.com"]}}`, 0, false},
+		{"invalid email", `{"email": {"host": "smtp.example.com", "from": "archive@example.com"}}`, 0, true},
+		{"invalid webhook", `{"webhooks": [{"name": "ci", "url": "not a url"}]}`, 0, true},
+		{"unknown field", `{"webhooks": [], "pager": {}}`, 0, true},
+		{"malformed", `{"webhooks": [`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FILE_NAME)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(f.Webhooks) != tt.want {
+				t.Errorf("Load() = %d webhooks, want %d", len(f.Webhooks), tt.want)
+			}
+		})
+	}
+
+	f, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || New(f) != nil {
+		t.Errorf("Load() of a missing file = %+v, %v, want no targets", f, err)
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "a.mp4")
+	if err := os.WriteFile(video, make([]byte, 1500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reports := []*downloader.Report{
+		{Results: []downloader.Result{
+			{ID: "a", Status: downloader.STATUS_DOWNLOADED, Path: video},
+			{ID: "b", Status: downloader.STATUS_FAILED, Reason: "Private video"},
+		}},
+		nil,
+		{Results: []downloader.Result{
+			{ID: "c", Status: downloader.STATUS_DOWNLOADED, Path: filepath.Join(dir, "moved.mp4")},
+			{ID: "d", Status: downloader.STATUS_SKIPPED},
+			{ID: "e", Status: downloader.STATUS_ABORTED},
+		}},
+	}
+
+	s := NewSummary("subscriptions sync", reports, errors.New("1 of 5 videos failed"))
+	want := Summary{Name: "subscriptions sync", Downloaded: 2, Skipped: 1, Failed: 1, Aborted: 1, TotalBytes: 1500, Error: "1 of 5 videos failed"}
+	got := *s
+	got.Failures = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewSummary() = %+v, want %+v", got, want)
+	}
+	if len(s.Failures) != 1 || s.Failures[0].ID != "b" {
+		t.Errorf("NewSummary() failures = %+v, want b", s.Failures)
+	}
+}
+
+func TestJobMessage(t *testing.T) {
+	job := queue.Job{ID: "j1", Config: config.Config{URL: "https://www.youtube.com/watch?v=a"}, Attempts: 1}
+	tests := []struct {
+		state       queue.State
+		want        string
+		wantSummary bool
+	}{
+		{queue.STATE_QUEUED, "", false},
+		{queue.STATE_RUNNING, EVENT_JOB_STARTED, false},
+		{queue.STATE_PAUSED, "", false},
+		{queue.STATE_DONE, EVENT_JOB_FINISHED, true},
+		{queue.STATE_FAILED, EVENT_JOB_FAILED, true},
+		{queue.STATE_CANCELLED, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			job.State = tt.state
+			m, ok := jobMessage(job)
+			if ok != (tt.want != "") || m.Event != tt.want {
+				t.Fatalf("jobMessage() = %q, %v, want %q", m.Event, ok, tt.want)
+			}
+			if ok && (m.Job.ID != "j1" || m.Job.URL != job.Config.URL) {
+				t.Errorf("jobMessage() job = %+v, want the job", m.Job)
+			}
+			if (m.Summary != nil) != tt.wantSummary {
+				t.Errorf("jobMessage() summary = %+v, want summary %v", m.Summary, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	fastRetries(t)
+	all := &recorder{}
+	failures := &recorder{statuses: []int{500}}
+	allSrv := httptest.NewServer(all)
+	defer allSrv.Close()
+	failuresSrv := httptest.NewServer(failures)
+	defer failuresSrv.Close()
+
+	n := New(&File{Webhooks: []Webhook{
+		{Name: "all", URL: allSrv.URL},
+		{Name: "failures", URL: failuresSrv.URL, Format: FORMAT_SLACK, Events: []string{EVENT_JOB_FAILED}},
+	}})
+	job := queue.Job{ID: "j1", Config: config.Config{URL: "https://www.youtube.com/watch?v=a"}}
+	for _, state := range []queue.State{queue.STATE_QUEUED, queue.STATE_RUNNING, queue.STATE_FAILED} {
+		job.State = state
+		n.Job(job)
+	}
+	n.RunFinished(NewSummary("https://www.youtube.com/watch?v=b", nil, nil))
+	n.Close()
+	n.Close()
+	n.RunFinished(NewSummary("after close", nil, nil))
+
+	var events []string
+	for _, req := range all.received() {
+		var m Message
+		json.Unmarshal(req.body, &m)
+		events = append(events, m.Event)
+	}
+	if want := []string{EVENT_JOB_STARTED, EVENT_JOB_FAILED, EVENT_RUN_FINISHED}; strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("all received %v, want %v", events, want)
+	}
+
+	reqs := failures.received()
+	if len(reqs) != 2 || !strings.Contains(string(reqs[1].body), "job j1 failed") {
+		t.Errorf("failures received %d requests, want the failed job retried once", len(reqs))
+	}
+
+	var nilNotifier *Notifier
+	nilNotifier.Job(job)
+	nilNotifier.Close()
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{3 << 20, "3.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// FORMAT_JSON posts the Message itself.
+	FORMAT_JSON = "json"
+	// FORMAT_SLACK posts a Slack incoming webhook message.
+	FORMAT_SLACK = "slack"
+	// FORMAT_DISCORD posts a Discord webhook message.
+	FORMAT_DISCORD = "discord"
+
+	DEFAULT_ATTEMPTS = 4
+	DEFAULT_TIMEOUT  = 10 * time.Second
+
+	// SIGNATURE_HEADER carries "sha256=" and the hex HMAC-SHA256 of the
+	// request body, keyed with the webhook's secret.
+	SIGNATURE_HEADER = "X-Drop-Tube-Signature"
+	// EVENT_HEADER carries the event of the message.
+	EVENT_HEADER = "X-Drop-Tube-Event"
+)
+
+const (
+	// discordLimit is the maximum length of a Discord message.
+	discordLimit = 2000
+	// maxRetryDelay bounds the wait requested by a Retry-After header.
+	maxRetryDelay = time.Minute
+)
+
+// retryDelay is the wait before the first retry; it doubles with every
+// further attempt.
+var retryDelay = time.Second
+
+// Webhook is a URL that receives notifications as HTTP POST requests.
+type Webhook struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret signs the request body in SIGNATURE_HEADER if set.
+	Secret string `json:"secret,omitempty"`
+	// Format is FORMAT_JSON unless set.
+	Format string `json:"format,omitempty"`
+	// Events are the events sent to the webhook, all of them unless set.
+	Events []string `json:"events,omitempty"`
+	// Attempts is how often a delivery is tried before it is given up,
+	// DEFAULT_ATTEMPTS unless set. Server errors, rate limiting and network
+	// errors are retried; other client errors are not.
+	Attempts int `json:"attempts,omitempty"`
+	// Timeout is a duration such as "30s". It is DEFAULT_TIMEOUT unless set.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Validate checks the name, URL, format, events, attempts and timeout of
+// the webhook.
+func (w Webhook) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("webhook name is required")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %q: invalid URL %q: must be an http or https URL", w.Name, w.URL)
+	}
+	switch w.Format {
+	case "", FORMAT_JSON, FORMAT_SLACK, FORMAT_DISCORD:
+	default:
+		return fmt.Errorf("webhook %q: invalid format %q: must be %s, %s or %s", w.Name, w.Format, FORMAT_JSON, FORMAT_SLACK, FORMAT_DISCORD)
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(events, e) {
+			return fmt.Errorf("webhook %q: unknown event %q", w.Name, e)
+		}
+	}
+	if w.Attempts < 0 {
+		return fmt.Errorf("webhook %q: attempts must not be negative", w.Name)
+	}
+	if w.Timeout != "" {
+		if d, err := time.ParseDuration(w.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("webhook %q: invalid timeout %q", w.Name, w.Timeout)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the webhook receives the event.
+func (w Webhook) Wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// String names the webhook in log messages.
+func (w Webhook) String() string {
+	return "webhook " + w.Name
+}
+
+// attempts returns how often a delivery is tried.
+func (w Webhook) attempts() int {
+	if w.Attempts > 0 {
+		return w.Attempts
+	}
+	return DEFAULT_ATTEMPTS
+}
+
+// timeout returns how long a single request may take.
+func (w Webhook) timeout() time.Duration {
+	if d, err := time.ParseDuration(w.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DEFAULT_TIMEOUT
+}
+
+// Body returns the request body of the message in the webhook's format.
+func (w Webhook) Body(m Message) ([]byte, error) {
+	switch w.Format {
+	case FORMAT_SLACK:
+		return json.Marshal(map[string]string{"text": m.Text()})
+	case FORMAT_DISCORD:
+		text := []rune(m.Text())
+		if len(text) > discordLimit {
+			text = append(text[:discordLimit-1], '…')
+		}
+		return json.Marshal(map[string]string{"content": string(text)})
+	default:
+		return json.Marshal(m)
+	}
+}
+
+// Sign returns the value of SIGNATURE_HEADER for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send delivers the message, retrying with increasing delays.
+func (w Webhook) Send(m Message) error {
+	body, err := w.Body(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	client := &http.Client{Timeout: w.timeout()}
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		wait, err := w.post(client, m.Event, body)
+		if err == nil {
+			return nil
+		}
+		if wait < 0 || attempt >= w.attempts() {
+			return err
+		}
+		if wait == 0 {
+			wait = delay
+			delay *= 2
+		}
+		time.Sleep(wait)
+	}
+}
+
+// post makes a single delivery attempt. On failure it returns how long to
+// wait before retrying: 0 for the default delay, or a negative duration if
+// the request must not be retried.
+func (w Webhook) post(client *http.Client, event string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "drop-tube")
+	req.Header.Set(EVENT_HEADER, event)
+	if w.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(w.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("server responded %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("server responded %s", resp.Status)
+	}
+}
+
+// retryAfter parses the seconds of a Retry-After header, bounded by
+// maxRetryDelay. It returns 0 if the header is missing or not in seconds.
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+}
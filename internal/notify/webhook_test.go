@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+// request is a request received by a test server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// recorder is a webhook endpoint that answers with the given status codes
+// in turn, and then with 204.
+type recorder struct {
+	mu       sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request{header: req.Header.Clone(), body: body})
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *recorder) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]request(nil), r.requests...)
+}
+
+// fastRetries shortens the delay between delivery attempts for the test.
+func fastRetries(t *testing.T) {
+	t.Helper()
+	previous := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = previous })
+}
+
+func finishedMessage() Message {
+	return Message{
+		Event: EVENT_RUN_FINISHED,
+		Time:  time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		Summary: &Summary{
+			Name:       "https://www.youtube.com/@example/videos",
+			Downloaded: 2,
+			Failed:     1,
+			TotalBytes: 3 << 20,
+			Failures:   []downloader.Result{{ID: "b", Title: "Private", Status: downloader.STATUS_FAILED, Reason: "Private video"}},
+		},
+	}
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook Webhook
+		wantErr bool
+	}{
+		{"minimal", Webhook{Name: "ci", URL: "https://example.com/hook"}, false},
+		{"full", Webhook{Name: "chat", URL: "http://localhost:8080/", Secret: "s", Format: FORMAT_SLACK, Events: []string{EVENT_JOB_FAILED}, Attempts: 2, Timeout: "5s"}, false},
+		{"missing name", Webhook{URL: "https://example.com/hook"}, true},
+		{"invalid URL", Webhook{Name: "x", URL: "example.com/hook"}, true},
+		{"unsupported scheme", Webhook{Name: "x", URL: "ftp://example.com/hook"}, true},
+		{"invalid format", Webhook{Name: "x", URL: "https://example.com/", Format: "teams"}, true},
+		{"unknown event", Webhook{Name: "x", URL: "https://example.com/", Events: []string{"job.paused"}}, true},
+		{"negative attempts", Webhook{Name: "x", URL: "https://example.com/", Attempts: -1}, true},
+		{"invalid timeout", Webhook{Name: "x", URL: "https://example.com/", Timeout: "soon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.webhook.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhook_Send(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	m := finishedMessage()
+	w := Webhook{Name: "ci", URL: srv.URL, Secret: "topsecret"}
+	if err := w.Send(m); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	reqs := rec.received()
+	if len(reqs) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if got := req.header.Get(EVENT_HEADER); got != EVENT_RUN_FINISHED {
+		t.Errorf("%s = %q, want %q", EVENT_HEADER, got, EVENT_RUN_FINISHED)
+	}
+	if got, want := req.header.Get(SIGNATURE_HEADER), Sign("topsecret", req.body); got != want {
+		t.Errorf("%s = %q, want %q", SIGNATURE_HEADER, got, want)
+	}
+	if !strings.HasPrefix(req.header.Get(SIGNATURE_HEADER), "sha256=") || Sign("other", req.body) == Sign("topsecret", req.body) {
+		t.Error("signature does not depend on the secret")
+	}
+
+	var got Message
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("body is not a message: %v", err)
+	}
+	if got.Event != m.Event || got.Summary == nil || got.Summary.Downloaded != 2 || len(got.Summary.Failures) != 1 {
+		t.Errorf("body = %s, want the message", req.body)
+	}
+
+	// Without a secret, requests are not signed.
+	w.Secret = ""
+	if err := w.Send(m); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if reqs := rec.received(); reqs[1].header.Get(SIGNATURE_HEADER) != "" {
+		t.Error("unsigned webhook sent a signature")
+	}
+}
+
+func TestWebhook_SendRetries(t *testing.T) {
+	fastRetries(t)
+	tests := []struct {
+		name         string
+		statuses     []int
+		attempts     int
+		wantRequests int
+		wantErr      bool
+	}{
+		{"server errors", []int{500, 502}, 0, 3, false},
+		{"rate limited", []int{429}, 0, 2, false},
+		{"gives up", []int{500, 500, 500, 500, 500}, 0, DEFAULT_ATTEMPTS, true},
+		{"configured attempts", []int{503, 503}, 2, 2, true},
+		{"client error", []int{404}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{statuses: tt.statuses}
+			srv := httptest.NewServer(rec)
+			defer srv.Close()
+
+			w := Webhook{Name: "ci", URL: srv.URL, Attempts: tt.attempts}
+			err := w.Send(finishedMessage())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(rec.received()); got != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWebhook_Body(t *testing.T) {
+	m := finishedMessage()
+	tests := []struct {
+		format string
+		field  string
+	}{
+		{FORMAT_SLACK, "text"},
+		{FORMAT_DISCORD, "content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			body, err := Webhook{Format: tt.format}.Body(m)
+			if err != nil {
+				t.Fatalf("Body() error = %v", err)
+			}
+			var payload map[string]string
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("Body() = %s: %v", body, err)
+			}
+			text := payload[tt.field]
+			for _, want := range []string{"run finished with failures", "2 downloaded (3.0 MiB)", "1 failed", "Private: Private video"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("%s = %q, want it to contain %q", tt.field, text, want)
+				}
+			}
+		})
+	}
+
+	long := finishedMessage()
+	for range 100 {
+		long.Summary.Failures = append(long.Summary.Failures, downloader.Result{Title: strings.Repeat("x", 100), Reason: "error"})
+	}
+	long.Summary.Name = strings.Repeat("y", 3000)
+	body, _ := Webhook{Format: FORMAT_DISCORD}.Body(long)
+	var payload map[string]string
+	json.Unmarshal(body, &payload)
+	if n := len([]rune(payload["content"])); n > discordLimit {
+		t.Errorf("Discord message has %d characters, want at most %d", n, discordLimit)
+	}
+}
+
+func TestWebhook_Wants(t *testing.T) {
+	all := Webhook{}
+	failures := Webhook{Events: []string{EVENT_JOB_FAILED}}
+	if !all.Wants(EVENT_JOB_STARTED) || !all.Wants(EVENT_RUN_FINISHED) {
+		t.Error("webhook without events should want all of them")
+	}
+	if failures.Wants(EVENT_JOB_STARTED) || !failures.Wants(EVENT_JOB_FAILED) {
+		t.Error("webhook should only want its events")
+	}
+}
@@ -0,0 +1,83 @@
+package playlist
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateLayout is the yt-dlp upload date format.
+const dateLayout = "20060102"
+
+// Filter decides which entries to skip based on their metadata.
+// Zero values disable the corresponding check, and checks against metadata
+// that yt-dlp did not report are passed.
+type Filter struct {
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	// DateAfter and DateBefore are inclusive bounds in YYYYMMDD form.
+	DateAfter   string
+	DateBefore  string
+	MatchTitle  *regexp.Regexp
+	RejectTitle *regexp.Regexp
+	MinViews    int64
+}
+
+// Skipped is an entry that was not downloaded, with the reason why.
+type Skipped struct {
+	Entry
+	Reason string `json:"reason"`
+}
+
+// NeedsUploadDate reports whether the filter checks upload dates, which are
+// missing from flat playlist listings.
+func (f *Filter) NeedsUploadDate() bool {
+	return f != nil && (f.DateAfter != "" || f.DateBefore != "")
+}
+
+// Check returns the reason the entry should be skipped, or an empty string
+// if it passes the filter.
+func (f *Filter) Check(e *Entry) string {
+	if f == nil {
+		return ""
+	}
+
+	duration := time.Duration(e.Duration * float64(time.Second))
+	if e.Duration > 0 && f.MinDuration > 0 && duration < f.MinDuration {
+		return fmt.Sprintf("duration %s is shorter than %s", duration, f.MinDuration)
+	}
+	if e.Duration > 0 && f.MaxDuration > 0 && duration > f.MaxDuration {
+		return fmt.Sprintf("duration %s is longer than %s", duration, f.MaxDuration)
+	}
+
+	if e.UploadDate != "" && f.DateAfter != "" && e.UploadDate < f.DateAfter {
+		return fmt.Sprintf("uploaded on %s, before %s", e.UploadDate, f.DateAfter)
+	}
+	if e.UploadDate != "" && f.DateBefore != "" && e.UploadDate > f.DateBefore {
+		return fmt.Sprintf("uploaded on %s, after %s", e.UploadDate, f.DateBefore)
+	}
+
+	if f.MatchTitle != nil && !f.MatchTitle.MatchString(e.Title) {
+		return fmt.Sprintf("title does not match %q", f.MatchTitle)
+	}
+	if f.RejectTitle != nil && f.RejectTitle.MatchString(e.Title) {
+		return fmt.Sprintf("title matches %q", f.RejectTitle)
+	}
+
+	if e.ViewCount != nil && f.MinViews > 0 && *e.ViewCount < f.MinViews {
+		return fmt.Sprintf("%d views, fewer than %d", *e.ViewCount, f.MinViews)
+	}
+
+	return ""
+}
+
+// ParseDate parses a date given as YYYYMMDD or YYYY-MM-DD and returns it in
+// yt-dlp's YYYYMMDD form.
+func ParseDate(s string) (string, error) {
+	t, err := time.Parse(dateLayout, strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q, expected YYYYMMDD or YYYY-MM-DD", s)
+	}
+	return t.Format(dateLayout), nil
+}
@@ -0,0 +1,68 @@
+package playlist
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFilter_Check(t *testing.T) {
+	views := int64(500)
+
+	tests := []struct {
+		name     string
+		filter   *Filter
+		entry    Entry
+		wantSkip bool
+	}{
+		{"nil filter", nil, Entry{Duration: 10}, false},
+		{"short video", &Filter{MinDuration: time.Minute}, Entry{Duration: 45}, true},
+		{"long enough", &Filter{MinDuration: time.Minute}, Entry{Duration: 90}, false},
+		{"unknown duration", &Filter{MinDuration: time.Minute}, Entry{}, false},
+		{"too long", &Filter{MaxDuration: 3 * time.Hour}, Entry{Duration: 4 * 3600}, true},
+		{"too old", &Filter{DateAfter: "20240101"}, Entry{UploadDate: "20231231"}, true},
+		{"on date after", &Filter{DateAfter: "20240101"}, Entry{UploadDate: "20240101"}, false},
+		{"too new", &Filter{DateBefore: "20240101"}, Entry{UploadDate: "20240102"}, true},
+		{"title mismatch", &Filter{MatchTitle: regexp.MustCompile(`(?i)episode`)}, Entry{Title: "Trailer"}, true},
+		{"title match", &Filter{MatchTitle: regexp.MustCompile(`(?i)episode`)}, Entry{Title: "Episode 3"}, false},
+		{"title rejected", &Filter{RejectTitle: regexp.MustCompile(`#shorts`)}, Entry{Title: "clip #shorts"}, true},
+		{"few views", &Filter{MinViews: 1000}, Entry{ViewCount: &views}, true},
+		{"unknown views", &Filter{MinViews: 1000}, Entry{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.filter.Check(&tt.entry)
+			if (reason != "") != tt.wantSkip {
+				t.Errorf("Check() = %q, wantSkip %v", reason, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		date    string
+		want    string
+		wantErr bool
+	}{
+		{"compact", "20240131", "20240131", false},
+		{"dashed", "2024-01-31", "20240131", false},
+		{"invalid month", "2024-13-01", "", true},
+		{"garbage", "yesterday", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDate(tt.date)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package playlist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ItemRange is a 1-based inclusive range of playlist positions.
+// Negative positions count from the end of the playlist (-1 is the last item)
+// and a zero End means the end of the playlist.
+type ItemRange struct {
+	Start int
+	End   int
+}
+
+// ParseItems parses an item specification such as "1-10,15,-3".
+// Supported forms are "N", "-N", "A-B", "A:B", "A:" and ":B".
+func ParseItems(spec string) ([]ItemRange, error) {
+	ranges := []ItemRange{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseItemRange(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid playlist item %q: %w", part, err)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("empty playlist item specification")
+	}
+	return ranges, nil
+}
+
+// parseItemRange parses a single comma-separated part of an item specification.
+func parseItemRange(part string) (ItemRange, error) {
+	var startStr, endStr string
+	if before, after, found := strings.Cut(part, ":"); found {
+		startStr, endStr = before, after
+	} else if i := strings.Index(part[1:], "-"); i >= 0 {
+		startStr, endStr = part[:i+1], part[i+2:]
+	} else {
+		n, err := parsePosition(part)
+		if err != nil {
+			return ItemRange{}, err
+		}
+		return ItemRange{Start: n, End: n}, nil
+	}
+
+	r := ItemRange{Start: 1}
+	var err error
+	if startStr != "" {
+		if r.Start, err = parsePosition(startStr); err != nil {
+			return ItemRange{}, err
+		}
+	}
+	if endStr != "" {
+		if r.End, err = parsePosition(endStr); err != nil {
+			return ItemRange{}, err
+		}
+	}
+	return r, nil
+}
+
+// parsePosition parses a non-zero playlist position.
+func parsePosition(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("not a number: %s", s)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("positions start at 1")
+	}
+	return n, nil
+}
+
+// Indexes returns the 1-based positions covered by the range in a playlist of
+// the given length. Positions outside the playlist are dropped.
+func (r ItemRange) Indexes(length int) []int {
+	start := resolvePosition(r.Start, length)
+	end := length
+	if r.End != 0 {
+		end = resolvePosition(r.End, length)
+	}
+
+	indexes := []int{}
+	for i := max(start, 1); i <= min(end, length); i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// resolvePosition converts a negative position into one counted from the start.
+func resolvePosition(pos, length int) int {
+	if pos < 0 {
+		return length + pos + 1
+	}
+	return pos
+}
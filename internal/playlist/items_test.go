@@ -0,0 +1,65 @@
+package playlist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []ItemRange
+		wantErr bool
+	}{
+		{"single item", "15", []ItemRange{{15, 15}}, false},
+		{"from end", "-3", []ItemRange{{-3, -3}}, false},
+		{"dash range", "1-10", []ItemRange{{1, 10}}, false},
+		{"colon range", "2:4", []ItemRange{{2, 4}}, false},
+		{"open end", "5:", []ItemRange{{5, 0}}, false},
+		{"open start", ":3", []ItemRange{{1, 3}}, false},
+		{"negative dash range", "-5--2", []ItemRange{{-5, -2}}, false},
+		{"combined", "1-10,15,-3", []ItemRange{{1, 10}, {15, 15}, {-3, -3}}, false},
+		{"zero", "0", nil, true},
+		{"not a number", "abc", nil, true},
+		{"empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseItems(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseItems() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemRange_Indexes(t *testing.T) {
+	tests := []struct {
+		name   string
+		r      ItemRange
+		length int
+		want   []int
+	}{
+		{"single", ItemRange{2, 2}, 5, []int{2}},
+		{"range", ItemRange{2, 4}, 5, []int{2, 3, 4}},
+		{"from end", ItemRange{-2, -2}, 5, []int{4}},
+		{"to end", ItemRange{4, 0}, 5, []int{4, 5}},
+		{"clipped", ItemRange{4, 10}, 5, []int{4, 5}},
+		{"out of range", ItemRange{8, 8}, 5, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.Indexes(tt.length)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Indexes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package playlist provides playlist entry parsing and item selection for DropTube.
+package playlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+)
+
+// Entry represents a single video in a playlist as reported by yt-dlp.
+type Entry struct {
+	Index      int     `json:"index"`
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	WebpageURL string  `json:"webpage_url,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+	UploadDate string  `json:"upload_date,omitempty"`
+	ViewCount  *int64  `json:"view_count,omitempty"`
+}
+
+// info is the subset of the "yt-dlp -J" document needed to list entries.
+type info struct {
+	Entry
+	Type    string   `json:"_type"`
+	Entries []*Entry `json:"entries"`
+}
+
+// VideoURL returns the URL that should be passed to yt-dlp to download the entry.
+func (e *Entry) VideoURL() string {
+	switch {
+	case e.WebpageURL != "":
+		return e.WebpageURL
+	case e.URL != "":
+		return e.URL
+	default:
+		return "https://www.youtube.com/watch?v=" + e.ID
+	}
+}
+
+// Parse parses the JSON document printed by "yt-dlp -J".
+// A playlist yields its entries in order, a single video yields itself.
+func Parse(data []byte) ([]Entry, error) {
+	var doc info
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp metadata: %w", err)
+	}
+
+	if doc.Type != "playlist" {
+		doc.Entry.Index = 1
+		return []Entry{doc.Entry}, nil
+	}
+
+	entries := make([]Entry, 0, len(doc.Entries))
+	for _, e := range doc.Entries {
+		if e == nil {
+			continue
+		}
+		entry := *e
+		entry.Index = len(entries) + 1
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Selection describes which playlist entries to download and in what order.
+type Selection struct {
+	Items      string
+	Reverse    bool
+	Random     bool
+	MaxItems   int
+	StartAfter string
+	Filter     *Filter
+}
+
+// Select applies the selection to the entries and returns the entries to
+// download and the entries skipped by the filter.
+// Items and StartAfter refer to the original playlist order; the filter,
+// ordering and MaxItems are applied afterwards, so MaxItems counts only
+// entries that pass the filter.
+func Select(entries []Entry, sel Selection) ([]Entry, []Skipped, error) {
+	selected := entries
+	if sel.Items != "" {
+		indexes, err := ParseItems(sel.Items)
+		if err != nil {
+			return nil, nil, err
+		}
+		selected = pick(entries, indexes)
+	}
+
+	if sel.StartAfter != "" {
+		pos := slices.IndexFunc(entries, func(e Entry) bool { return e.ID == sel.StartAfter })
+		if pos < 0 {
+			return nil, nil, fmt.Errorf("video %s not found in playlist", sel.StartAfter)
+		}
+		after := entries[pos].Index
+		selected = slices.DeleteFunc(slices.Clone(selected), func(e Entry) bool { return e.Index <= after })
+	}
+
+	kept := []Entry{}
+	skipped := []Skipped{}
+	for _, e := range selected {
+		if reason := sel.Filter.Check(&e); reason != "" {
+			skipped = append(skipped, Skipped{Entry: e, Reason: reason})
+			continue
+		}
+		kept = append(kept, e)
+	}
+	selected = kept
+
+	switch {
+	case sel.Reverse:
+		slices.Reverse(selected)
+	case sel.Random:
+		rand.Shuffle(len(selected), func(i, j int) {
+			selected[i], selected[j] = selected[j], selected[i]
+		})
+	}
+
+	if sel.MaxItems > 0 && len(selected) > sel.MaxItems {
+		selected = selected[:sel.MaxItems]
+	}
+	return selected, skipped, nil
+}
+
+// pick returns the entries at the given item specs, skipping duplicates.
+func pick(entries []Entry, specs []ItemRange) []Entry {
+	seen := make(map[int]bool)
+	picked := []Entry{}
+	for _, spec := range specs {
+		for _, i := range spec.Indexes(len(entries)) {
+			if !seen[i] {
+				seen[i] = true
+				picked = append(picked, entries[i-1])
+			}
+		}
+	}
+	return picked
+}
@@ -0,0 +1,169 @@
+package playlist
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testEntries(ids ...string) []Entry {
+	entries := make([]Entry, 0, len(ids))
+	for i, id := range ids {
+		entries = append(entries, Entry{Index: i + 1, ID: id})
+	}
+	return entries
+}
+
+func entryIDs(entries []Entry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "playlist",
+			data: `{"_type": "playlist", "id": "PL1", "entries": [
+				{"_type": "url", "id": "a", "title": "A", "url": "https://www.youtube.com/watch?v=a"},
+				{"_type": "url", "id": "b", "title": "B", "url": "https://www.youtube.com/watch?v=b", "view_count": 10}
+			]}`,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "single video",
+			data: `{"id": "v", "title": "V", "webpage_url": "https://www.youtube.com/watch?v=v"}`,
+			want: []string{"v"},
+		},
+		{
+			name:    "invalid json",
+			data:    `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if ids := entryIDs(got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Parse() ids = %v, want %v", ids, tt.want)
+			}
+			for i, e := range got {
+				if e.Index != i+1 {
+					t.Errorf("Parse() entry %s index = %d, want %d", e.ID, e.Index, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestEntry_VideoURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"webpage url", Entry{ID: "a", URL: "https://cdn/a", WebpageURL: "https://www.youtube.com/watch?v=a"}, "https://www.youtube.com/watch?v=a"},
+		{"flat url", Entry{ID: "a", URL: "https://www.youtube.com/watch?v=a"}, "https://www.youtube.com/watch?v=a"},
+		{"id only", Entry{ID: "a"}, "https://www.youtube.com/watch?v=a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.VideoURL(); got != tt.want {
+				t.Errorf("VideoURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	entries := testEntries("a", "b", "c", "d", "e")
+
+	tests := []struct {
+		name    string
+		sel     Selection
+		want    []string
+		wantErr bool
+	}{
+		{"no selection", Selection{}, []string{"a", "b", "c", "d", "e"}, false},
+		{"items", Selection{Items: "1-2,-1"}, []string{"a", "b", "e"}, false},
+		{"duplicate items", Selection{Items: "1-3,2"}, []string{"a", "b", "c"}, false},
+		{"reverse", Selection{Reverse: true}, []string{"e", "d", "c", "b", "a"}, false},
+		{"max items", Selection{MaxItems: 2}, []string{"a", "b"}, false},
+		{"newest first", Selection{Reverse: true, MaxItems: 2}, []string{"e", "d"}, false},
+		{"start after", Selection{StartAfter: "c"}, []string{"d", "e"}, false},
+		{"start after with items", Selection{Items: "1-4", StartAfter: "b"}, []string{"c", "d"}, false},
+		{"start after unknown", Selection{StartAfter: "x"}, nil, true},
+		{"invalid items", Selection{Items: "x"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Select(entries, tt.sel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Select() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(entryIDs(got), tt.want) {
+				t.Errorf("Select() = %v, want %v", entryIDs(got), tt.want)
+			}
+		})
+	}
+
+	if ids := entryIDs(entries); !reflect.DeepEqual(ids, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("Select() modified its input: %v", ids)
+	}
+}
+
+func TestSelect_Random(t *testing.T) {
+	entries := testEntries("a", "b", "c", "d", "e")
+
+	got, _, err := Select(entries, Selection{Random: true})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	ids := entryIDs(got)
+	slices.Sort(ids)
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("Select() random = %v, want a permutation of the input", entryIDs(got))
+	}
+}
+
+func TestSelect_Filter(t *testing.T) {
+	entries := []Entry{
+		{Index: 1, ID: "a", Duration: 30},
+		{Index: 2, ID: "b", Duration: 600},
+		{Index: 3, ID: "c", Duration: 20},
+		{Index: 4, ID: "d", Duration: 900},
+		{Index: 5, ID: "e", Duration: 1200},
+	}
+
+	got, skipped, err := Select(entries, Selection{MaxItems: 2, Filter: &Filter{MinDuration: time.Minute}})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	if ids := entryIDs(got); !reflect.DeepEqual(ids, []string{"b", "d"}) {
+		t.Errorf("Select() = %v, want [b d]", ids)
+	}
+	if len(skipped) != 2 || skipped[0].ID != "a" || skipped[1].ID != "c" || skipped[0].Reason == "" {
+		t.Errorf("Select() skipped = %+v, want a and c with reasons", skipped)
+	}
+}
@@ -0,0 +1,606 @@
+// Package queue provides the persistent job queue of the drop-tube daemon.
+// Every job is stored as a JSON file in the queue directory, so the queue
+// survives restarts and other processes can submit jobs by adding files.
+// The daemon owning the queue is the only writer of existing job files.
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+const DIR_NAME = "queue"
+
+// jobFileExt is the extension of job files; files being written use a
+// different extension until they are complete.
+const jobFileExt = ".json"
+
+// State is the lifecycle state of a job.
+type State string
+
+const (
+	STATE_QUEUED    State = "queued"
+	STATE_RUNNING   State = "running"
+	STATE_PAUSED    State = "paused"
+	STATE_DONE      State = "done"
+	STATE_FAILED    State = "failed"
+	STATE_CANCELLED State = "cancelled"
+)
+
+// Priority orders queued jobs: jobs with a higher priority are started
+// first, and jobs with the same priority in submission order.
+type Priority int
+
+const (
+	PRIORITY_LOW    Priority = -1
+	PRIORITY_NORMAL Priority = 0
+	PRIORITY_HIGH   Priority = 1
+	PRIORITY_URGENT Priority = 2
+)
+
+var priorityNames = map[Priority]string{
+	PRIORITY_LOW:    "low",
+	PRIORITY_NORMAL: "normal",
+	PRIORITY_HIGH:   "high",
+	PRIORITY_URGENT: "urgent",
+}
+
+// ParsePriority parses a priority name (low, normal, high or urgent) or
+// number.
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if s == name {
+			return p, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q: must be low, normal, high, urgent or a number", s)
+	}
+	return Priority(n), nil
+}
+
+// String returns the name of the priority, or its number if it has none.
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+var (
+	// ErrNotFound is returned for unknown job IDs.
+	ErrNotFound = errors.New("job not found")
+	// ErrQuotaExceeded is returned when an owner has too many unfinished jobs.
+	ErrQuotaExceeded = errors.New("job quota exceeded")
+)
+
+// Job is a download submitted to the queue.
+type Job struct {
+	ID     string        `json:"id"`
+	Config config.Config `json:"config"`
+	State  State         `json:"state"`
+	// Owner names who submitted the job, such as an API token.
+	Owner    string   `json:"owner,omitempty"`
+	Priority Priority `json:"priority,omitempty"`
+	// Attempts counts how often the job was started, including restarts
+	// after the daemon was interrupted.
+	Attempts   int                 `json:"attempts"`
+	CreatedAt  time.Time           `json:"created_at"`
+	StartedAt  time.Time           `json:"started_at,omitzero"`
+	FinishedAt time.Time           `json:"finished_at,omitzero"`
+	Error      string              `json:"error,omitempty"`
+	Results    []downloader.Result `json:"results,omitempty"`
+}
+
+// Finished reports whether the job reached a final state.
+func (j *Job) Finished() bool {
+	return j.State == STATE_DONE || j.State == STATE_FAILED || j.State == STATE_CANCELLED
+}
+
+// DefaultDir returns the queue directory in the data directory.
+func DefaultDir() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, DIR_NAME), nil
+}
+
+// Queue is the set of jobs stored in a queue directory.
+type Queue struct {
+	dir       string
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	wake      chan struct{}
+	observers []func(Job)
+}
+
+// Open loads the jobs stored in dir, creating the directory if needed.
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory %s: %w", dir, err)
+	}
+
+	q := &Queue{
+		dir:  dir,
+		jobs: make(map[string]*Job),
+		wake: make(chan struct{}, 1),
+	}
+	if err := q.Reload(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Reload adds jobs submitted by other processes since the queue was opened.
+// Jobs already known are not re-read, and unreadable job files are skipped
+// and reported in the error. Job files whose configuration is invalid or
+// whose ID does not match the file name are skipped and logged.
+func (q *Queue) Reload() error {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read queue directory %s: %w", q.dir, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	added := false
+	var errs []error
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), jobFileExt)
+		if !ok || f.IsDir() || q.jobs[id] != nil {
+			continue
+		}
+		path := filepath.Join(q.dir, f.Name())
+		job, err := readJob(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := checkJob(id, job); err != nil {
+			log.Printf("skipping job file %s: %v", path, err)
+			continue
+		}
+		q.jobs[id] = job
+		q.changed(job)
+		added = added || job.State == STATE_QUEUED
+	}
+	if added {
+		q.notify()
+	}
+	return errors.Join(errs...)
+}
+
+// Recover puts jobs left running by an interrupted daemon back in the
+// queue so that they are resumed. It returns the recovered job IDs.
+func (q *Queue) Recover() ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	recovered := []string{}
+	for _, running := range q.sorted() {
+		if running.State != STATE_RUNNING {
+			continue
+		}
+		job := *running
+		job.State = STATE_QUEUED
+		if _, err := q.update(job); err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, job.ID)
+	}
+	if len(recovered) > 0 {
+		q.notify()
+	}
+	return recovered, nil
+}
+
+// AddOptions describes who submits a job and how urgent it is.
+type AddOptions struct {
+	// Owner names who submits the job, such as an API token.
+	Owner string
+	// MaxActive limits the owner's unfinished jobs if it is positive.
+	MaxActive int
+	Priority  Priority
+}
+
+// Add validates the configuration and appends a new queued job.
+func (q *Queue) Add(cfg config.Config) (Job, error) {
+	return q.AddWith(cfg, AddOptions{})
+}
+
+// AddWith is like Add with the given owner and priority. If opts.MaxActive
+// is positive and the owner already has that many unfinished jobs,
+// ErrQuotaExceeded is returned.
+func (q *Queue) AddWith(cfg config.Config, opts AddOptions) (Job, error) {
+	job, err := newJob(cfg, opts.Priority)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Owner = opts.Owner
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if opts.MaxActive > 0 {
+		active := 0
+		for _, j := range q.jobs {
+			if j.Owner == opts.Owner && !j.Finished() {
+				active++
+			}
+		}
+		if active >= opts.MaxActive {
+			return Job{}, fmt.Errorf("%s has %d unfinished jobs: %w", opts.Owner, active, ErrQuotaExceeded)
+		}
+	}
+	if err := q.save(job); err != nil {
+		return Job{}, err
+	}
+	q.jobs[job.ID] = job
+	q.notify()
+	return *job, nil
+}
+
+// Get returns a copy of the job with the given ID.
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	return *job, nil
+}
+
+// List returns copies of all jobs in submission order.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := []Job{}
+	for _, job := range q.sorted() {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// Claim marks the queued job with the highest priority as running and
+// returns it, the oldest one among jobs with the same priority. It returns
+// false if no job is queued.
+func (q *Queue) Claim() (Job, bool, error) {
+	return q.ClaimFunc(nil)
+}
+
+// ClaimFunc is like Claim, but skips jobs for which allow returns false,
+// e.g. because too many downloads from the same site are running. allow is
+// called with the queue locked and must not call back into the queue.
+func (q *Queue) ClaimFunc(allow func(Job) bool) (Job, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := q.sorted()
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Priority > jobs[j].Priority })
+	for _, queued := range jobs {
+		if queued.State != STATE_QUEUED || (allow != nil && !allow(*queued)) {
+			continue
+		}
+		job := *queued
+		job.State = STATE_RUNNING
+		job.Attempts++
+		job.StartedAt = time.Now()
+		job.Error = ""
+		if _, err := q.update(job); err != nil {
+			return Job{}, false, err
+		}
+		return job, true, nil
+	}
+	return Job{}, false, nil
+}
+
+// Complete records the outcome of a running job: done if runErr is nil,
+// failed otherwise.
+func (q *Queue) Complete(id string, results []downloader.Result, runErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	running, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	job := *running
+	job.State = STATE_DONE
+	job.Error = ""
+	if runErr != nil {
+		job.State = STATE_FAILED
+		job.Error = runErr.Error()
+	}
+	job.Results = results
+	job.FinishedAt = time.Now()
+	_, err := q.update(job)
+	return err
+}
+
+// Stop records that a running job was stopped before it finished, either
+// put back in the queue (e.g. when the daemon stops), paused to be resumed
+// later or cancelled. The results of the interrupted run are kept.
+func (q *Queue) Stop(id string, state State, results []downloader.Result) error {
+	if state != STATE_QUEUED && state != STATE_PAUSED && state != STATE_CANCELLED {
+		return fmt.Errorf("a running job cannot be stopped as %s", state)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.transition(id, "stopped", STATE_RUNNING)
+	if err != nil {
+		return err
+	}
+	job.State = state
+	job.Error = ""
+	job.Results = results
+	if state == STATE_CANCELLED {
+		job.FinishedAt = time.Now()
+	}
+	if _, err := q.update(job); err != nil {
+		return err
+	}
+	if state == STATE_QUEUED {
+		q.notify()
+	}
+	return nil
+}
+
+// Requeue puts a paused or finished job back in the queue to run again.
+// Queued and running jobs are rejected; a running job interrupted by the
+// daemon is put back with Stop.
+func (q *Queue) Requeue(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.transition(id, "requeued", STATE_PAUSED, STATE_DONE, STATE_FAILED, STATE_CANCELLED)
+	if err != nil {
+		return Job{}, err
+	}
+	job.State = STATE_QUEUED
+	job.Error = ""
+	job.Results = nil
+	job.FinishedAt = time.Time{}
+	if job, err = q.update(job); err != nil {
+		return Job{}, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// Cancel cancels a queued or paused job. Running jobs are cancelled through
+// the daemon running them; finished jobs cannot be cancelled.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.transition(id, "cancelled", STATE_QUEUED, STATE_PAUSED)
+	if err != nil {
+		return Job{}, err
+	}
+	job.State = STATE_CANCELLED
+	job.FinishedAt = time.Now()
+	return q.update(job)
+}
+
+// Pause holds a queued job so that the daemon does not start it until it is
+// resumed. Running jobs are paused through the daemon running them.
+func (q *Queue) Pause(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.transition(id, "paused", STATE_QUEUED)
+	if err != nil {
+		return Job{}, err
+	}
+	job.State = STATE_PAUSED
+	return q.update(job)
+}
+
+// Resume puts a paused job back in the queue.
+func (q *Queue) Resume(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.transition(id, "resumed", STATE_PAUSED)
+	if err != nil {
+		return Job{}, err
+	}
+	job.State = STATE_QUEUED
+	if job, err = q.update(job); err != nil {
+		return Job{}, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// transition returns a copy of the job if it is in one of the given states,
+// for an operation described by verb. The caller holds q.mu.
+func (q *Queue) transition(id, verb string, from ...State) (Job, error) {
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if !slices.Contains(from, job.State) {
+		return Job{}, fmt.Errorf("job %s is %s and cannot be %s", id, job.State, verb)
+	}
+	return *job, nil
+}
+
+// Observe registers fn to be called with a copy of every job that is added
+// or changes state. fn is called with the queue locked and must not call
+// back into the queue.
+func (q *Queue) Observe(fn func(Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.observers = append(q.observers, fn)
+}
+
+// Wake returns a channel that receives a value when a job is queued.
+func (q *Queue) Wake() <-chan struct{} {
+	return q.wake
+}
+
+// notify signals a waiting worker without blocking. The caller holds q.mu.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sorted returns the jobs in submission order. The caller holds q.mu.
+func (q *Queue) sorted() []*Job {
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// save writes the job file and reports the change to the observers. The
+// caller holds q.mu.
+func (q *Queue) save(job *Job) error {
+	if err := writeJob(q.dir, job); err != nil {
+		return err
+	}
+	q.changed(job)
+	return nil
+}
+
+// update saves a changed copy of a job and then replaces the job with it,
+// so that a job whose file cannot be written keeps its previous state. The
+// caller holds q.mu.
+func (q *Queue) update(job Job) (Job, error) {
+	if err := q.save(&job); err != nil {
+		return Job{}, err
+	}
+	q.jobs[job.ID] = &job
+	return job, nil
+}
+
+// changed reports the job to the observers. The caller holds q.mu.
+func (q *Queue) changed(job *Job) {
+	for _, fn := range q.observers {
+		fn(*job)
+	}
+}
+
+// Submit adds a job to the queue directory without opening the queue, for
+// processes other than the daemon. The daemon picks it up on its next reload.
+// opts.MaxActive is not enforced.
+func Submit(dir string, cfg config.Config, opts AddOptions) (Job, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Job{}, fmt.Errorf("failed to create queue directory %s: %w", dir, err)
+	}
+	job, err := newJob(cfg, opts.Priority)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Owner = opts.Owner
+	return *job, writeJob(dir, job)
+}
+
+// newJob creates a queued job for the configuration.
+func newJob(cfg config.Config, priority Priority) (*Job, error) {
+	if cfg.DryRun {
+		return nil, fmt.Errorf("dry runs cannot be queued")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		ID:        id,
+		Config:    cfg,
+		State:     STATE_QUEUED,
+		Priority:  priority,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// newID returns a job ID that sorts by creation time.
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// readJob reads a job file.
+func readJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", path, err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %w", path, err)
+	}
+	return &job, nil
+}
+
+// checkJob checks a job read from the file of the job with the given ID.
+func checkJob(id string, job *Job) error {
+	if job.ID != id {
+		return fmt.Errorf("job ID %q does not match the file name", job.ID)
+	}
+	cfg := job.Config
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("invalid job configuration: %w", err)
+	}
+	return nil
+}
+
+// writeJob replaces the job file atomically.
+func writeJob(dir string, job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+
+	path := filepath.Join(dir, job.ID+jobFileExt)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+)
+
+func testConfig(t *testing.T, url string) config.Config {
+	t.Helper()
+	cfg := config.NewConfig()
+	cfg.URL = url
+	cfg.OutputDir = t.TempDir()
+	return *cfg
+}
+
+func TestQueue_Lifecycle(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	first, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=first"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	second, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=second"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	job, ok, err := q.Claim()
+	if err != nil || !ok || job.ID != first.ID || job.State != STATE_RUNNING || job.Attempts != 1 {
+		t.Fatalf("Claim() = %+v, %v, %v, want the first job running", job, ok, err)
+	}
+
+	if _, err := q.Cancel(first.ID); err == nil {
+		t.Error("Cancel() of a running job should fail")
+	}
+	if job, err := q.Cancel(second.ID); err != nil || job.State != STATE_CANCELLED {
+		t.Errorf("Cancel() = %+v, %v, want a cancelled job", job, err)
+	}
+	if _, ok, _ := q.Claim(); ok {
+		t.Error("Claim() returned a job although none is queued")
+	}
+
+	results := []downloader.Result{{ID: "first", Status: downloader.STATUS_FAILED, Reason: "Private video"}}
+	if err := q.Complete(first.ID, results, errors.New("1 of 1 videos failed")); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	// Reopening reads the states back from disk.
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	jobs := reopened.List()
+	if len(jobs) != 2 {
+		t.Fatalf("List() returned %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].State != STATE_FAILED || jobs[0].Error == "" || len(jobs[0].Results) != 1 || !jobs[0].Finished() {
+		t.Errorf("first job = %+v, want failed with results", jobs[0])
+	}
+	if jobs[1].State != STATE_CANCELLED {
+		t.Errorf("second job state = %s, want cancelled", jobs[1].State)
+	}
+
+	if _, err := reopened.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an unknown job error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestQueue_Recover(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new daemon finds the job still running and puts it back in the queue.
+	restarted, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := restarted.Recover()
+	if err != nil || len(recovered) != 1 {
+		t.Fatalf("Recover() = %v, %v, want one job", recovered, err)
+	}
+	job, ok, err := restarted.Claim()
+	if err != nil || !ok || job.Attempts != 2 {
+		t.Errorf("Claim() after recovery = %+v, %v, %v, want the second attempt", job, ok, err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := Submit(dir, testConfig(t, "https://www.youtube.com/watch?v=a"), AddOptions{Owner: "cron", Priority: PRIORITY_HIGH})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if err := q.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	select {
+	case <-q.Wake():
+	default:
+		t.Error("Reload() did not signal the submitted job")
+	}
+	if got, err := q.Get(job.ID); err != nil || got.State != STATE_QUEUED || got.Priority != PRIORITY_HIGH || got.Owner != "cron" {
+		t.Errorf("Get() = %+v, %v, want the submitted job queued with its owner and priority", got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Reload(); err == nil {
+		t.Error("Reload() should report unreadable job files")
+	}
+	if len(q.List()) != 1 {
+		t.Errorf("List() = %v, want the readable job only", q.List())
+	}
+}
+
+func TestSubmit_Invalid(t *testing.T) {
+	cfg := testConfig(t, "")
+	if _, err := Submit(t.TempDir(), cfg, AddOptions{}); err == nil {
+		t.Error("Submit() without a URL should fail")
+	}
+
+	cfg = testConfig(t, "https://www.youtube.com/watch?v=a")
+	cfg.DryRun = true
+	if _, err := Submit(t.TempDir(), cfg, AddOptions{}); err == nil {
+		t.Error("Submit() of a dry run should fail")
+	}
+}
+
+func TestQueue_Observe(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var states []State
+	q.Observe(func(job Job) { states = append(states, job.State) })
+
+	job, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Complete(job.ID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []State{STATE_QUEUED, STATE_RUNNING, STATE_DONE}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("observed states %v, want %v", states, want)
+	}
+}
+
+func TestQueue_AddWith(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	first, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=first"), AddOptions{Owner: "alice", MaxActive: 1})
+	if err != nil || first.Owner != "alice" {
+		t.Fatalf("AddWith() = %+v, %v, want a job owned by alice", first, err)
+	}
+	if _, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=second"), AddOptions{Owner: "alice", MaxActive: 1}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("AddWith() over the quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=second"), AddOptions{Owner: "bob", MaxActive: 1}); err != nil {
+		t.Errorf("AddWith() of another owner error = %v", err)
+	}
+
+	// Finished jobs do not count against the quota.
+	if _, err := q.Cancel(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=third"), AddOptions{Owner: "alice", MaxActive: 1}); err != nil {
+		t.Errorf("AddWith() after the job finished error = %v", err)
+	}
+}
+
+func TestQueue_ClaimPriority(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	var ids []string
+	for _, p := range []Priority{PRIORITY_NORMAL, PRIORITY_LOW, PRIORITY_URGENT, PRIORITY_NORMAL, PRIORITY_URGENT} {
+		job, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=a"), AddOptions{Priority: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	// Urgent jobs first, then normal ones, each in submission order.
+	want := []string{ids[2], ids[4], ids[0], ids[3], ids[1]}
+	var claimed []string
+	for {
+		job, ok, err := q.Claim()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		claimed = append(claimed, job.ID)
+	}
+	if !reflect.DeepEqual(claimed, want) {
+		t.Errorf("claimed %v, want %v", claimed, want)
+	}
+}
+
+func TestQueue_ClaimFunc(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := q.AddWith(testConfig(t, "https://www.youtube.com/watch?v=a"), AddOptions{Priority: PRIORITY_HIGH}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := q.Add(testConfig(t, "https://vimeo.com/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, ok, err := q.ClaimFunc(func(job Job) bool { return job.Config.URL != "https://www.youtube.com/watch?v=a" })
+	if err != nil || !ok || job.ID != other.ID {
+		t.Errorf("ClaimFunc() = %+v, %v, %v, want the job that is allowed", job, ok, err)
+	}
+	if _, ok, _ := q.ClaimFunc(func(Job) bool { return false }); ok {
+		t.Error("ClaimFunc() returned a job that is not allowed")
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Priority
+		wantErr bool
+	}{
+		{"low", PRIORITY_LOW, false},
+		{"normal", PRIORITY_NORMAL, false},
+		{"urgent", PRIORITY_URGENT, false},
+		{"5", 5, false},
+		{"-3", -3, false},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePriority(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParsePriority(%q) = %v, %v, want %v (error: %v)", tt.input, got, err, tt.want, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.input {
+				t.Errorf("String() = %q, want %q", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestQueue_PauseResume(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	job, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if paused, err := q.Pause(job.ID); err != nil || paused.State != STATE_PAUSED {
+		t.Fatalf("Pause() = %+v, %v, want a paused job", paused, err)
+	}
+	if _, ok, _ := q.Claim(); ok {
+		t.Error("Claim() returned a paused job")
+	}
+	if _, err := q.Pause(job.ID); err == nil {
+		t.Error("Pause() of a paused job should fail")
+	}
+
+	if resumed, err := q.Resume(job.ID); err != nil || resumed.State != STATE_QUEUED {
+		t.Fatalf("Resume() = %+v, %v, want a queued job", resumed, err)
+	}
+	if _, err := q.Resume(job.ID); err == nil {
+		t.Error("Resume() of a queued job should fail")
+	}
+	if _, err := q.Pause("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Pause() of an unknown job error = %v, want ErrNotFound", err)
+	}
+
+	// Paused jobs can be cancelled.
+	if _, err := q.Pause(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err := q.Cancel(job.ID); err != nil || cancelled.State != STATE_CANCELLED {
+		t.Errorf("Cancel() of a paused job = %+v, %v", cancelled, err)
+	}
+}
+
+func TestQueue_Stop(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	job, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []downloader.Result{{ID: "a", Status: downloader.STATUS_ABORTED, Path: "a.mp4"}}
+	if err := q.Stop(job.ID, STATE_PAUSED, results); err == nil {
+		t.Error("Stop() of a queued job should fail")
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Stop(job.ID, STATE_DONE, nil); err == nil {
+		t.Error("Stop() as done should fail")
+	}
+
+	if err := q.Stop(job.ID, STATE_PAUSED, results); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	paused, _ := q.Get(job.ID)
+	if paused.State != STATE_PAUSED || !reflect.DeepEqual(paused.Results, results) || paused.Finished() {
+		t.Errorf("stopped job = %+v, want paused with the results of the run", paused)
+	}
+
+	// A resumed job runs again and can be stopped for good.
+	if _, err := q.Resume(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _, _ := q.Claim(); claimed.Attempts != 2 {
+		t.Errorf("resumed job attempts = %d, want 2", claimed.Attempts)
+	}
+	if err := q.Stop(job.ID, STATE_CANCELLED, nil); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if cancelled, _ := q.Get(job.ID); cancelled.State != STATE_CANCELLED || cancelled.FinishedAt.IsZero() {
+		t.Errorf("cancelled job = %+v", cancelled)
+	}
+}
+
+func TestQueue_StopQueued(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	job, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+	<-q.Wake()
+
+	// A job interrupted by the daemon goes back in the queue.
+	if err := q.Stop(job.ID, STATE_QUEUED, nil); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	select {
+	case <-q.Wake():
+	default:
+		t.Error("Stop() did not signal the requeued job")
+	}
+	if claimed, ok, _ := q.Claim(); !ok || claimed.ID != job.ID || claimed.Attempts != 2 {
+		t.Errorf("Claim() = %+v, %v, want the interrupted job again", claimed, ok)
+	}
+}
+
+func TestQueue_Requeue(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	job, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.Requeue(job.ID); err == nil {
+		t.Error("Requeue() of a queued job should fail")
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Requeue(job.ID); err == nil {
+		t.Error("Requeue() of a running job should fail")
+	}
+	if got, _ := q.Get(job.ID); got.State != STATE_RUNNING {
+		t.Errorf("rejected Requeue() changed the job to %s", got.State)
+	}
+
+	results := []downloader.Result{{ID: "a", Status: downloader.STATUS_FAILED}}
+	if err := q.Complete(job.ID, results, errors.New("download failed")); err != nil {
+		t.Fatal(err)
+	}
+	requeued, err := q.Requeue(job.ID)
+	if err != nil {
+		t.Fatalf("Requeue() error = %v", err)
+	}
+	if requeued.State != STATE_QUEUED || requeued.Error != "" || requeued.Results != nil || !requeued.FinishedAt.IsZero() {
+		t.Errorf("Requeue() = %+v, want the failed job queued again", requeued)
+	}
+	if _, err := q.Requeue("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Requeue() of an unknown job error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestQueue_ReloadSkipsInvalidJobs(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "missing")
+	for name, content := range map[string]string{
+		"renamed.json":    `{"id": "other", "state": "queued", "config": {"url": "https://www.youtube.com/watch?v=a"}}`,
+		"no-url.json":     `{"id": "no-url", "state": "queued", "config": {}}`,
+		"denied-arg.json": `{"id": "denied-arg", "state": "queued", "config": {"url": "https://www.youtube.com/watch?v=a", "extra_args": ["--exec", "rm -rf ~"]}}`,
+		"valid.json":      `{"id": "valid", "state": "queued", "config": {"url": "https://www.youtube.com/watch?v=a", "output_dir": "` + outputDir + `"}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].ID != "valid" {
+		t.Errorf("List() = %+v, want the valid job only", jobs)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Reload() created the output directory of a job: %v", err)
+	}
+}
+
+func TestQueue_SaveFailureKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	queued, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, err := q.Add(testConfig(t, "https://www.youtube.com/watch?v=b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Pause(paused.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in place of the temporary job files makes saving fail.
+	for _, job := range []Job{queued, paused} {
+		if err := os.Mkdir(filepath.Join(dir, job.ID+jobFileExt+".tmp"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		op   func(id string) (Job, error)
+		want State
+	}{
+		{"pause", queued.ID, q.Pause, STATE_QUEUED},
+		{"cancel", queued.ID, q.Cancel, STATE_QUEUED},
+		{"resume", paused.ID, q.Resume, STATE_PAUSED},
+		{"requeue", paused.ID, q.Requeue, STATE_PAUSED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.op(tt.id); err == nil {
+				t.Fatal("expected an error when the job file cannot be written")
+			}
+			if got, _ := q.Get(tt.id); got.State != tt.want {
+				t.Errorf("job is %s after the failed save, want %s", got.State, tt.want)
+			}
+		})
+	}
+	select {
+	case <-q.Wake():
+		// Drained the wake-up of the jobs added above.
+	default:
+	}
+	if _, err := q.Resume(paused.ID); err == nil {
+		t.Fatal("expected an error when the job file cannot be written")
+	}
+	select {
+	case <-q.Wake():
+		t.Error("a failed Resume() woke the workers")
+	default:
+	}
+}
@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+// ErrNotRunning is returned when no daemon listens on the socket.
+var ErrNotRunning = errors.New("daemon is not running")
+
+// baseURL is the URL requests are made to; the host is ignored since every
+// connection goes to the socket.
+const baseURL = "http://drop-tube"
+
+// Client controls a running daemon through its socket.
+type Client struct {
+	socketPath string
+	http       *http.Client
+}
+
+// NewClient creates a Client for the daemon listening on socketPath.
+func NewClient(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{socketPath: socketPath, http: &http.Client{Transport: transport}}
+}
+
+// Add queues a download with the given priority. Only the download options
+// of cfg are sent (see config.DownloadOptions).
+func (c *Client) Add(cfg config.Config, priority queue.Priority) (queue.Job, error) {
+	var job queue.Job
+	return job, c.do(http.MethodPost, "/jobs?priority="+url.QueryEscape(priority.String()), config.NewDownloadOptions(&cfg), &job)
+}
+
+// List returns the jobs in submission order.
+func (c *Client) List() ([]queue.Job, error) {
+	var jobs []queue.Job
+	return jobs, c.do(http.MethodGet, "/jobs", nil, &jobs)
+}
+
+// Get returns a job.
+func (c *Client) Get(id string) (queue.Job, error) {
+	var job queue.Job
+	return job, c.do(http.MethodGet, jobPath(id), nil, &job)
+}
+
+// Cancel cancels a job.
+func (c *Client) Cancel(id string) (queue.Job, error) {
+	var job queue.Job
+	return job, c.do(http.MethodDelete, jobPath(id), nil, &job)
+}
+
+// Pause pauses a job.
+func (c *Client) Pause(id string) (queue.Job, error) {
+	var job queue.Job
+	return job, c.do(http.MethodPost, jobPath(id)+"/pause", nil, &job)
+}
+
+// Resume resumes a paused job.
+func (c *Client) Resume(id string) (queue.Job, error) {
+	var job queue.Job
+	return job, c.do(http.MethodPost, jobPath(id)+"/resume", nil, &job)
+}
+
+func jobPath(id string) string {
+	return "/jobs/" + url.PathEscape(id)
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// v. Error responses are returned as errors; unknown jobs wrap
+// queue.ErrNotFound.
+func (c *Client) do(method, path string, body, v any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("%w (no daemon listening on %s)", ErrNotRunning, c.socketPath)
+		}
+		return fmt.Errorf("failed to reach the daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			e.Error = resp.Status
+		}
+		return &apiError{status: resp.StatusCode, message: e.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// apiError is an error response of the daemon.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// Is makes errors for unknown jobs match queue.ErrNotFound.
+func (e *apiError) Is(target error) bool {
+	return target == queue.ErrNotFound && e.status == http.StatusNotFound
+}
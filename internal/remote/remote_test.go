@@ -0,0 +1,121 @@
+package remote
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/server"
+)
+
+// startDaemon serves the API of a new queue on a socket like the daemon.
+func startDaemon(t *testing.T) (string, *queue.Queue) {
+	t.Helper()
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), SOCKET_FILE_NAME)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	srv := &http.Server{Handler: server.New(q, server.Options{BaseDir: t.TempDir()}).Handler()}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return path, q
+}
+
+func TestListen(t *testing.T) {
+	path, _ := startDaemon(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != socketMode {
+		t.Errorf("socket mode = %v, want a socket with %o", info.Mode(), socketMode)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Error("Listen() on the socket of a running daemon should fail")
+	}
+}
+
+func TestListen_StaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SOCKET_FILE_NAME)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a daemon that died without removing its socket.
+	l.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() over a stale socket error = %v", err)
+	}
+	l.Close()
+}
+
+func TestListen_NotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SOCKET_FILE_NAME)
+	if err := os.WriteFile(path, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err := Listen(path); err == nil {
+		l.Close()
+		t.Fatal("Listen() over a regular file should fail")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep me" {
+		t.Errorf("Listen() changed the file: %q, %v", data, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	path, q := startDaemon(t)
+	c := NewClient(path)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/watch?v=a"
+	cfg.OutputDir = "videos"
+	job, err := c.Add(*cfg, queue.PRIORITY_URGENT)
+	if err != nil || job.State != queue.STATE_QUEUED || job.Config.URL != cfg.URL || job.Priority != queue.PRIORITY_URGENT {
+		t.Fatalf("Add() = %+v, %v, want a queued job", job, err)
+	}
+	if jobs, err := c.List(); err != nil || len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("List() = %+v, %v, want the added job", jobs, err)
+	}
+
+	if paused, err := c.Pause(job.ID); err != nil || paused.State != queue.STATE_PAUSED {
+		t.Errorf("Pause() = %+v, %v", paused, err)
+	}
+	if resumed, err := c.Resume(job.ID); err != nil || resumed.State != queue.STATE_QUEUED {
+		t.Errorf("Resume() = %+v, %v", resumed, err)
+	}
+	if cancelled, err := c.Cancel(job.ID); err != nil || cancelled.State != queue.STATE_CANCELLED {
+		t.Errorf("Cancel() = %+v, %v", cancelled, err)
+	}
+	if got, _ := q.Get(job.ID); got.State != queue.STATE_CANCELLED {
+		t.Errorf("queued job state = %s, want cancelled", got.State)
+	}
+
+	if _, err := c.Get("missing"); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("Get() of an unknown job error = %v, want ErrNotFound", err)
+	}
+	if _, err := c.Resume(job.ID); err == nil || errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("Resume() of a cancelled job error = %v, want a conflict", err)
+	}
+}
+
+func TestClient_NotRunning(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), SOCKET_FILE_NAME))
+	if _, err := c.List(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("List() without a daemon error = %v, want ErrNotRunning", err)
+	}
+}
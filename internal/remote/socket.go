@@ -0,0 +1,70 @@
+// Package remote provides the Unix socket control interface of the drop-tube
+// daemon and a client for it. The daemon serves the same HTTP API as the
+// serve command on the socket; access is controlled by the socket's file
+// permissions instead of API tokens.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+const SOCKET_FILE_NAME = "daemon.sock"
+
+// socketMode restricts the socket to the user running the daemon.
+const socketMode = 0600
+
+// DefaultSocketPath returns the location of the daemon's socket in the data
+// directory.
+func DefaultSocketPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SOCKET_FILE_NAME), nil
+}
+
+// Listen creates the daemon's socket at path, accessible only to the current
+// user. A socket left behind by a daemon that did not shut down cleanly is
+// replaced; a socket a daemon is listening on, or a file that is not a
+// socket, is an error.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another daemon is listening on %s", path)
+	} else if errors.Is(err, syscall.ECONNREFUSED) {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check stale socket %s: %w", path, err)
+		}
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	// The socket is created without permissions for others so that it is
+	// never accessible to them, even before the chmod.
+	oldMask := syscall.Umask(0077)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return l, nil
+}
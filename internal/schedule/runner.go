@@ -0,0 +1,312 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
+)
+
+// lateAfter is how long after its scheduled time a run still counts as on
+// time rather than missed.
+const lateAfter = 2 * time.Minute
+
+// Owner returns the owner recorded on jobs queued by the named schedule.
+func Owner(name string) string {
+	return "schedule:" + name
+}
+
+// AddFunc queues a job, such as Queue.AddWith.
+type AddFunc func(cfg config.Config, opts queue.AddOptions) (queue.Job, error)
+
+// Options controls how schedules are run.
+type Options struct {
+	// BaseDir resolves relative output directories of jobs and
+	// subscription syncs.
+	BaseDir string
+	// SubscriptionsFile is the subscription list synced by schedules.
+	SubscriptionsFile string
+	// Config is the base configuration of subscription syncs, such as the
+	// daemon's rate limit. It is the default configuration if nil.
+	Config *config.Config
+	// Share runs every subscription sync at a share of the bandwidth if
+	// set, so that the daemon's bandwidth limit covers syncs like jobs.
+	Share subscriptions.ShareFunc
+	// Output receives the progress of subscription syncs. It is the log's
+	// writer if nil.
+	Output io.Writer
+	// AfterDownload is run for every video downloaded by subscription syncs
+	// if set.
+	AfterDownload downloader.Hook
+	// OnSynced receives the reports of a schedule's subscription sync and
+	// its error when it finishes, if set.
+	OnSynced func(schedule string, reports []*downloader.Report, err error)
+}
+
+// Runner runs the schedules of a schedule file.
+type Runner struct {
+	path    string
+	add     AddFunc
+	options Options
+
+	file    *File
+	modTime time.Time
+	size    int64
+
+	mu      sync.Mutex
+	syncing map[string]bool
+	// syncs tracks the subscription syncs running in the background.
+	syncs sync.WaitGroup
+}
+
+// NewRunner creates a Runner for the schedule file at path that queues jobs
+// with add.
+func NewRunner(path string, add AddFunc, opts Options) *Runner {
+	if opts.Output == nil {
+		opts.Output = log.Writer()
+	}
+	return &Runner{path: path, add: add, options: opts, syncing: make(map[string]bool)}
+}
+
+// Run runs the schedules when they are due until ctx is cancelled. The
+// schedule file is reloaded when it changes. Subscription syncs run in the
+// background; a schedule whose previous sync is still running is skipped.
+// The cancellation of ctx interrupts running syncs, and Run returns once
+// they stopped.
+func (r *Runner) Run(ctx context.Context) error {
+	statePath := StatePath(r.path)
+	state, err := LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	if err := r.reload(); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, s := range r.file.Schedules {
+		log.Printf("schedule %s: next run at %s", s.Name, FormatTime(s.Next(now), "never"))
+	}
+
+	for {
+		if err := r.reload(); err != nil {
+			log.Printf("failed to reload schedules, keeping the previous ones: %v", err)
+		}
+		if r.check(ctx, time.Now(), state) {
+			if err := state.Save(statePath); err != nil {
+				log.Printf("failed to save schedule state: %v", err)
+			}
+		}
+
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			r.syncs.Wait()
+			return nil
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+	}
+}
+
+// RunNow runs the named schedule immediately and waits for a subscription
+// sync to finish. It does not change when the schedule runs next.
+func (r *Runner) RunNow(name string) error {
+	if err := r.reload(); err != nil {
+		return err
+	}
+	s, err := r.file.Get(name)
+	if err != nil {
+		return err
+	}
+	if s.Subscriptions != nil {
+		return r.sync(context.Background(), s)
+	}
+	return r.queueJob(s)
+}
+
+// check runs the schedules that became due since their last run and
+// records the runs in state. It reports whether state changed.
+func (r *Runner) check(ctx context.Context, now time.Time, state *State) bool {
+	changed := false
+	for _, s := range r.file.Schedules {
+		checked, ok := state.Checked[s.Name]
+		if !ok {
+			// New schedules start now rather than catching up on the past.
+			state.Checked[s.Name] = now
+			changed = true
+			continue
+		}
+
+		due, missed := dueRuns(s, checked, now)
+		if due.IsZero() {
+			continue
+		}
+		state.Checked[s.Name] = due
+		changed = true
+
+		if now.Sub(due) > lateAfter {
+			if s.Policy() == CATCH_UP_SKIP {
+				log.Printf("schedule %s: skipped %d missed runs, next run at %s", s.Name, missed, FormatTime(s.Next(now), "never"))
+				continue
+			}
+			log.Printf("schedule %s: catching up on %d missed runs", s.Name, missed)
+		}
+		state.LastRun[s.Name] = now
+		r.start(ctx, s)
+	}
+	return changed
+}
+
+// dueRuns returns the latest scheduled time of s after last and up to now,
+// and how many scheduled times passed. The time is zero if none passed.
+func dueRuns(s Schedule, last, now time.Time) (time.Time, int) {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	var due time.Time
+	n := 0
+	for t := c.Next(last); !t.IsZero() && !t.After(now); t = c.Next(t) {
+		due = t
+		n++
+	}
+	return due, n
+}
+
+// start runs a due schedule: its job is queued, and its subscriptions are
+// synced in the background.
+func (r *Runner) start(ctx context.Context, s Schedule) {
+	if s.Subscriptions == nil {
+		if err := r.queueJob(s); err != nil {
+			log.Printf("schedule %s: %v", s.Name, err)
+		}
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.syncing[s.Name] {
+		log.Printf("schedule %s: previous sync still running, skipped", s.Name)
+		return
+	}
+	r.syncing[s.Name] = true
+	r.syncs.Add(1)
+	go func() {
+		defer r.syncs.Done()
+		if ctx.Err() == nil {
+			if err := r.sync(ctx, s); err != nil {
+				log.Printf("schedule %s: %v", s.Name, err)
+			}
+		}
+		r.mu.Lock()
+		delete(r.syncing, s.Name)
+		r.mu.Unlock()
+	}()
+}
+
+// queueJob queues the schedule's job.
+func (r *Runner) queueJob(s Schedule) error {
+	cfg, err := s.JobConfig(r.options.BaseDir)
+	if err != nil {
+		return err
+	}
+	job, err := r.add(*cfg, queue.AddOptions{Owner: Owner(s.Name), Priority: s.Priority})
+	if err != nil {
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+	log.Printf("schedule %s: queued job %s", s.Name, job.ID)
+	return nil
+}
+
+// sync mirrors the schedule's subscriptions until ctx is cancelled.
+func (r *Runner) sync(ctx context.Context, s Schedule) (err error) {
+	var reports []*downloader.Report
+	if r.options.OnSynced != nil {
+		defer func() { r.options.OnSynced(s.Name, reports, err) }()
+	}
+
+	list, err := subscriptions.Load(r.options.SubscriptionsFile)
+	if err != nil {
+		return err
+	}
+	subs := list.Subscriptions
+	if len(s.Subscriptions.Names) > 0 {
+		subs = nil
+		for _, name := range s.Subscriptions.Names {
+			sub, err := list.Get(name)
+			if err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+		}
+	}
+
+	dir := s.Subscriptions.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(r.options.BaseDir, dir)
+	}
+	log.Printf("schedule %s: syncing %d subscriptions into %s", s.Name, len(subs), dir)
+	opts := subscriptions.Options{
+		AfterDownload: r.options.AfterDownload,
+		Context:       ctx,
+		Share:         r.options.Share,
+		OnSynced: func(_ subscriptions.Subscription, summary *mirror.Summary, _ error) {
+			if summary != nil {
+				reports = append(reports, summary.Report)
+			}
+		},
+	}
+	return subscriptions.Sync(subs, r.baseConfig(), dir, opts, r.options.Output)
+}
+
+// baseConfig returns a copy of the base configuration of subscription syncs.
+func (r *Runner) baseConfig() *config.Config {
+	cfg := config.NewConfig()
+	if r.options.Config != nil {
+		*cfg = *r.options.Config
+	}
+	return cfg
+}
+
+// reload reads the schedule file if it changed since it was last read. A
+// file that fails to load keeps the previous schedules in effect.
+func (r *Runner) reload() error {
+	var modTime time.Time
+	var size int64
+	info, err := os.Stat(r.path)
+	switch {
+	case err == nil:
+		modTime, size = info.ModTime(), info.Size()
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read schedules %s: %w", r.path, err)
+	}
+	if r.file != nil && modTime.Equal(r.modTime) && size == r.size {
+		return nil
+	}
+
+	f, err := Load(r.path)
+	if err != nil {
+		// Remember the broken file so that its error is reported once.
+		r.modTime, r.size = modTime, size
+		return err
+	}
+	r.file, r.modTime, r.size = f, modTime, size
+	return nil
+}
+
+// FormatTime formats a run time in local time, or none for the zero time.
+func FormatTime(t time.Time, none string) string {
+	if t.IsZero() {
+		return none
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+	"github.com/hidekingerz/drop-tube/internal/subscriptions"
+)
+
+// recordAdd returns an AddFunc recording the queued jobs.
+func recordAdd(added *[]queue.AddOptions) AddFunc {
+	return func(cfg config.Config, opts queue.AddOptions) (queue.Job, error) {
+		*added = append(*added, opts)
+		return queue.Job{ID: cfg.URL}, nil
+	}
+}
+
+func TestRunner_Check(t *testing.T) {
+	path := writeSchedules(t, `{"schedules": [
+		{"name": "once", "cron": "0 3 * * *", "job": {"url": "https://www.youtube.com/watch?v=a"}},
+		{"name": "skip", "cron": "0 3 * * *", "catch_up": "skip", "job": {"url": "https://www.youtube.com/watch?v=b"}},
+		{"name": "new", "cron": "* * * * *", "job": {"url": "https://www.youtube.com/watch?v=c"}}
+	]}`)
+	var added []queue.AddOptions
+	r := NewRunner(path, recordAdd(&added), Options{BaseDir: t.TempDir(), Output: io.Discard})
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	state := &State{
+		Checked: map[string]time.Time{
+			"once": day.Add(-48 * time.Hour),
+			"skip": day.Add(-48 * time.Hour),
+		},
+		LastRun: map[string]time.Time{},
+	}
+
+	// Three days of runs were missed: "once" catches up with a single run,
+	// "skip" waits for the next one and "new" starts counting now.
+	now := day.Add(10 * time.Hour)
+	if !r.check(context.Background(), now, state) {
+		t.Error("check() did not change the state")
+	}
+	want := []queue.AddOptions{{Owner: Owner("once")}}
+	if !reflect.DeepEqual(added, want) {
+		t.Errorf("queued %+v after missed runs, want %+v", added, want)
+	}
+	wantChecked := map[string]time.Time{
+		"once": day.Add(3 * time.Hour),
+		"skip": day.Add(3 * time.Hour),
+		"new":  now,
+	}
+	if !reflect.DeepEqual(state.Checked, wantChecked) {
+		t.Errorf("checked = %v, want %v", state.Checked, wantChecked)
+	}
+	if wantRuns := map[string]time.Time{"once": now}; !reflect.DeepEqual(state.LastRun, wantRuns) {
+		t.Errorf("last runs = %v, want %v", state.LastRun, wantRuns)
+	}
+
+	// The daily schedules are not due again until the next day.
+	added = nil
+	r.check(context.Background(), day.Add(20*time.Hour), state)
+	if want := []queue.AddOptions{{Owner: Owner("new")}}; !reflect.DeepEqual(added, want) {
+		t.Errorf("queued %+v before the next scheduled time, want %+v", added, want)
+	}
+
+	// On time, every schedule runs.
+	added = nil
+	r.check(context.Background(), day.Add(27*time.Hour+30*time.Second), state)
+	if len(added) != 3 {
+		t.Errorf("queued %+v at the scheduled time, want all three schedules", added)
+	}
+}
+
+func TestRunner_RunNow(t *testing.T) {
+	path := writeSchedules(t, `{"schedules": [
+		{"name": "urgent", "cron": "@daily", "priority": 2, "job": {"url": "https://www.youtube.com/watch?v=a"}},
+		{"name": "sync", "cron": "@daily", "subscriptions": {"names": ["missing"]}}
+	]}`)
+	var added []queue.AddOptions
+	var synced []string
+	var syncErr error
+	r := NewRunner(path, recordAdd(&added), Options{
+		SubscriptionsFile: filepath.Join(t.TempDir(), subscriptions.FILE_NAME),
+		Output:            io.Discard,
+		OnSynced: func(schedule string, reports []*downloader.Report, err error) {
+			synced = append(synced, schedule)
+			syncErr = err
+		},
+	})
+
+	if err := r.RunNow("urgent"); err != nil {
+		t.Fatalf("RunNow() error = %v", err)
+	}
+	if want := []queue.AddOptions{{Owner: Owner("urgent"), Priority: queue.PRIORITY_URGENT}}; !reflect.DeepEqual(added, want) {
+		t.Errorf("queued %+v, want %+v", added, want)
+	}
+	if err := r.RunNow("sync"); !errors.Is(err, subscriptions.ErrNotFound) {
+		t.Errorf("RunNow() of an unknown subscription error = %v, want subscriptions.ErrNotFound", err)
+	}
+	if len(synced) != 1 || synced[0] != "sync" || !errors.Is(syncErr, subscriptions.ErrNotFound) {
+		t.Errorf("OnSynced() received %v, %v, want the failed sync", synced, syncErr)
+	}
+	if err := r.RunNow("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RunNow() of an unknown schedule error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRunner_BaseConfig(t *testing.T) {
+	base := config.NewConfig()
+	base.LimitRate = "1M"
+	r := NewRunner("", nil, Options{Config: base})
+
+	cfg := r.baseConfig()
+	if cfg.LimitRate != "1M" {
+		t.Errorf("baseConfig() limit = %q, want the daemon's", cfg.LimitRate)
+	}
+	cfg.LimitRate = "2M"
+	if base.LimitRate != "1M" {
+		t.Errorf("baseConfig() shares the daemon's configuration, limit changed to %q", base.LimitRate)
+	}
+}
@@ -0,0 +1,206 @@
+// Package schedule runs downloads and subscription syncs at times given by
+// cron expressions. Schedules are defined in a JSON file in drop-tube's data
+// directory and executed by the daemon, which records the time of each run
+// in a state file so that runs missed while it was stopped can be caught up.
+package schedule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+const (
+	FILE_NAME = "schedules.json"
+
+	// CATCH_UP_ONCE runs a schedule once after runs were missed, e.g. when
+	// the daemon was stopped at the scheduled time.
+	CATCH_UP_ONCE CatchUp = "once"
+	// CATCH_UP_SKIP drops missed runs and waits for the next scheduled time.
+	CATCH_UP_SKIP CatchUp = "skip"
+)
+
+// ErrNotFound is returned for unknown schedule names.
+var ErrNotFound = errors.New("schedule not found")
+
+// CatchUp is the policy for runs missed while the daemon was not running.
+type CatchUp string
+
+// Schedule runs a download or a subscription sync at the times given by its
+// cron expression, in the local time zone.
+type Schedule struct {
+	Name string `json:"name"`
+	Cron string `json:"cron"`
+	// CatchUp is CATCH_UP_ONCE unless set.
+	CatchUp CatchUp `json:"catch_up,omitempty"`
+
+	// Job is a download configuration with the fields of a run report's
+	// config, queued at every run. Omitted fields take their defaults.
+	Job json.RawMessage `json:"job,omitempty"`
+	// Priority is the priority of the queued job.
+	Priority queue.Priority `json:"priority,omitempty"`
+
+	// Subscriptions are synced at every run instead of queueing a job.
+	Subscriptions *SubscriptionSet `json:"subscriptions,omitempty"`
+}
+
+// SubscriptionSet selects subscribed channels to sync.
+type SubscriptionSet struct {
+	// Names are the names, URLs or channel IDs of the subscriptions to
+	// sync. All subscriptions are synced if it is empty.
+	Names []string `json:"names,omitempty"`
+	// Dir is the directory the channels are mirrored into.
+	Dir string `json:"dir,omitempty"`
+}
+
+// File is the stored list of schedules.
+type File struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// DefaultPath returns the location of the schedule file in the data directory.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FILE_NAME), nil
+}
+
+// Load reads and validates the schedule file at path. A missing file has no
+// schedules.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{Schedules: []Schedule{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules %s: %w", path, err)
+	}
+
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules %s: %w", path, err)
+	}
+	if f.Schedules == nil {
+		f.Schedules = []Schedule{}
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid schedules %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks every schedule and that the names are unique.
+func (f *File) Validate() error {
+	seen := make(map[string]bool)
+	for _, s := range f.Schedules {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("duplicate schedule %q", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// Get returns the schedule with the given name.
+func (f *File) Get(name string) (Schedule, error) {
+	for _, s := range f.Schedules {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Schedule{}, fmt.Errorf("%s: %w", name, ErrNotFound)
+}
+
+// Validate checks the name, cron expression, catch-up policy and action of
+// the schedule. Download options are validated when the job is queued.
+func (s Schedule) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return fmt.Errorf("schedule %q: %w", s.Name, err)
+	}
+	switch s.CatchUp {
+	case "", CATCH_UP_ONCE, CATCH_UP_SKIP:
+	default:
+		return fmt.Errorf("schedule %q: invalid catch-up policy %q: must be %s or %s", s.Name, s.CatchUp, CATCH_UP_ONCE, CATCH_UP_SKIP)
+	}
+
+	if (s.Job != nil) == (s.Subscriptions != nil) {
+		return fmt.Errorf("schedule %q: exactly one of job and subscriptions is required", s.Name)
+	}
+	if s.Job != nil {
+		cfg, err := s.JobConfig("")
+		if err != nil {
+			return fmt.Errorf("schedule %q: %w", s.Name, err)
+		}
+		if cfg.URL == "" {
+			return fmt.Errorf("schedule %q: the job has no URL", s.Name)
+		}
+	}
+	return nil
+}
+
+// Policy returns the catch-up policy, CATCH_UP_ONCE unless set.
+func (s Schedule) Policy() CatchUp {
+	if s.CatchUp == "" {
+		return CATCH_UP_ONCE
+	}
+	return s.CatchUp
+}
+
+// Next returns the first scheduled time after t, or the zero time if the
+// expression does not match within the next years.
+func (s Schedule) Next(t time.Time) time.Time {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(t)
+}
+
+// JobConfig returns the configuration of the schedule's job, with defaults
+// for omitted fields and a relative output directory resolved against
+// baseDir.
+func (s Schedule) JobConfig(baseDir string) (*config.Config, error) {
+	cfg := config.NewConfig()
+	dec := json.NewDecoder(bytes.NewReader(s.Job))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid job: %w", err)
+	}
+	if !filepath.IsAbs(cfg.OutputDir) {
+		cfg.OutputDir = filepath.Join(baseDir, cfg.OutputDir)
+	}
+	return cfg, nil
+}
+
+// Describe summarizes what the schedule does at every run.
+func (s Schedule) Describe() string {
+	if s.Subscriptions != nil {
+		if len(s.Subscriptions.Names) == 0 {
+			return "sync all subscriptions"
+		}
+		return "sync " + strings.Join(s.Subscriptions.Names, ", ")
+	}
+	cfg, err := s.JobConfig("")
+	if err != nil {
+		return "invalid job"
+	}
+	return "download " + cfg.URL
+}
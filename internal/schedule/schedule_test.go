@@ -0,0 +1,132 @@
+package schedule
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+func writeSchedules(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FILE_NAME)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeSchedules(t, `{"schedules": [
+		{"name": "nightly", "cron": "0 3 * * *", "subscriptions": {}},
+		{"name": "backfill", "cron": "0 1 * * sat,sun", "catch_up": "skip", "priority": -1,
+		 "job": {"url": "https://www.youtube.com/playlist?list=PL1", "playlist": true, "output_dir": "backfill"}}
+	]}`)
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(f.Schedules) != 2 {
+		t.Fatalf("Load() = %+v, want 2 schedules", f.Schedules)
+	}
+
+	nightly, err := f.Get("nightly")
+	if err != nil || nightly.Policy() != CATCH_UP_ONCE || nightly.Describe() != "sync all subscriptions" {
+		t.Errorf("nightly = %+v, %v, want a subscription sync caught up once", nightly, err)
+	}
+	backfill, _ := f.Get("backfill")
+	cfg, err := backfill.JobConfig("/media")
+	if err != nil {
+		t.Fatalf("JobConfig() error = %v", err)
+	}
+	if !cfg.Playlist || cfg.OutputDir != filepath.Join("/media", "backfill") || cfg.Quality != "best" ||
+		backfill.Priority != queue.PRIORITY_LOW || backfill.Policy() != CATCH_UP_SKIP {
+		t.Errorf("backfill = %+v with job %+v", backfill, cfg)
+	}
+	if _, err := f.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an unknown schedule error = %v, want ErrNotFound", err)
+	}
+
+	from := time.Date(2025, 1, 15, 12, 0, 0, 0, time.Local)
+	if next := backfill.Next(from); !next.Equal(time.Date(2025, 1, 18, 1, 0, 0, 0, time.Local)) {
+		t.Errorf("Next() = %v, want Saturday 01:00", next)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	f, err := Load(filepath.Join(t.TempDir(), FILE_NAME))
+	if err != nil || len(f.Schedules) != 0 {
+		t.Errorf("Load() of a missing file = %+v, %v, want no schedules", f, err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"malformed", `{`, "failed to parse"},
+		{"unknown field", `{"schedules": [{"name": "a", "cron": "@daily", "subscriptions": {}, "when": 1}]}`, "unknown field"},
+		{"missing name", `{"schedules": [{"cron": "@daily", "subscriptions": {}}]}`, "name is required"},
+		{"bad cron", `{"schedules": [{"name": "a", "cron": "daily", "subscriptions": {}}]}`, "cron expression"},
+		{"bad policy", `{"schedules": [{"name": "a", "cron": "@daily", "catch_up": "all", "subscriptions": {}}]}`, "catch-up policy"},
+		{"no action", `{"schedules": [{"name": "a", "cron": "@daily"}]}`, "exactly one of"},
+		{"two actions", `{"schedules": [{"name": "a", "cron": "@daily", "subscriptions": {}, "job": {"url": "u"}}]}`, "exactly one of"},
+		{"job without URL", `{"schedules": [{"name": "a", "cron": "@daily", "job": {"quality": "720p"}}]}`, "no URL"},
+		{"unknown job option", `{"schedules": [{"name": "a", "cron": "@daily", "job": {"url": "u", "speed": 1}}]}`, "invalid job"},
+		{"duplicate", `{"schedules": [{"name": "a", "cron": "@daily", "subscriptions": {}}, {"name": "a", "cron": "@hourly", "subscriptions": {}}]}`, "duplicate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeSchedules(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestState_SaveLoad(t *testing.T) {
+	path := StatePath(filepath.Join(t.TempDir(), FILE_NAME))
+	if filepath.Base(path) != "schedules.state.json" {
+		t.Errorf("StatePath() = %q, want schedules.state.json", path)
+	}
+
+	state, err := LoadState(path)
+	if err != nil || len(state.Checked) != 0 || len(state.LastRun) != 0 {
+		t.Fatalf("LoadState() of a missing file = %+v, %v", state, err)
+	}
+	run := time.Date(2025, 1, 15, 3, 0, 0, 0, time.UTC)
+	state.Checked["nightly"] = run
+	state.LastRun["nightly"] = run
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadState(path)
+	if err != nil || !loaded.Checked["nightly"].Equal(run) || !loaded.LastRun["nightly"].Equal(run) {
+		t.Errorf("LoadState() = %+v, %v, want the saved run", loaded, err)
+	}
+}
+
+func TestLoadState_MissingMaps(t *testing.T) {
+	for _, content := range []string{`{}`, `{"checked": null, "last_run": null}`} {
+		path := filepath.Join(t.TempDir(), "schedules.state.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		state, err := LoadState(path)
+		if err != nil {
+			t.Fatalf("LoadState(%s) error = %v", content, err)
+		}
+		if state.Checked == nil || state.LastRun == nil {
+			t.Errorf("LoadState(%s) = %+v, want empty maps", content, state)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// State records how far the runs of every schedule were handled.
+type State struct {
+	// Checked is the scheduled time up to which runs were started or
+	// skipped. Later scheduled times that have passed are missed runs.
+	Checked map[string]time.Time `json:"checked"`
+	// LastRun is when a schedule was last run by the daemon.
+	LastRun map[string]time.Time `json:"last_run"`
+}
+
+// StatePath returns the state file kept next to the schedule file at path.
+func StatePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".state.json"
+}
+
+// LoadState reads the state file at path. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{Checked: make(map[string]time.Time), LastRun: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule state %s: %w", path, err)
+	}
+	// A null or missing entry leaves its map nil.
+	if state.Checked == nil {
+		state.Checked = make(map[string]time.Time)
+	}
+	if state.LastRun == nil {
+		state.LastRun = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// Save writes the state file atomically, creating its directory if needed.
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write schedule state %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write schedule state %s: %w", path, err)
+	}
+	return nil
+}
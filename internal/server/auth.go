@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+)
+
+// tokenKey is the request context key of the authenticated token.
+type tokenKey struct{}
+
+// requireScope wraps a handler so that it only runs for requests with a
+// token that has the scope and is within its rate limit. Without a token
+// store the API is open and every request is allowed; with an empty one
+// every request is rejected.
+func (s *Server) requireScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return s.authorize(scope, false, next)
+}
+
+// requireStreamScope is like requireScope for the event streams, which
+// also accept the token in the "access_token" query parameter since
+// browsers cannot set headers on EventSource and WebSocket connections.
+func (s *Server) requireStreamScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return s.authorize(scope, true, next)
+}
+
+// authorize implements requireScope and requireStreamScope.
+func (s *Server) authorize(scope auth.Scope, queryToken bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.options.Tokens == nil {
+			next(w, r)
+			return
+		}
+
+		secret := bearerToken(r, queryToken)
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing API token"))
+			return
+		}
+		token, ok, err := s.options.Tokens.Authenticate(secret)
+		if err != nil {
+			log.Printf("failed to load tokens: %v", err)
+			writeError(w, http.StatusInternalServerError, errors.New("failed to load tokens"))
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid API token"))
+			return
+		}
+		if !token.Allows(scope) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("token %q lacks the %s scope", token.Name, scope))
+			return
+		}
+		if ok, wait := s.limiter.Allow(token); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit of %d requests per minute exceeded", token.RateLimit))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)))
+	}
+}
+
+// bearerToken returns the token of the Authorization header or, if
+// queryToken is set, of the "access_token" query parameter. Query strings
+// end up in access logs, so only the event streams accept them.
+func bearerToken(r *http.Request, queryToken bool) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if queryToken && r.Method == http.MethodGet {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// requestToken returns the token the request was authenticated with, if any.
+func requestToken(r *http.Request) (auth.Token, bool) {
+	token, ok := r.Context().Value(tokenKey{}).(auth.Token)
+	return token, ok
+}
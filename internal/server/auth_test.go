@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+// newAuthServer starts a server requiring tokens and returns the secrets of
+// the created tokens by name.
+func newAuthServer(t *testing.T, tokens ...auth.Token) (*httptest.Server, *queue.Queue, map[string]string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), auth.FILE_NAME)
+	list, _ := auth.Load(path)
+	secrets := make(map[string]string)
+	for _, token := range tokens {
+		_, secret, err := list.Create(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[token.Name] = secret
+	}
+	if err := list.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	store, err := auth.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(q, Options{BaseDir: t.TempDir(), Tokens: store}).Handler())
+	t.Cleanup(srv.Close)
+	return srv, q, secrets
+}
+
+func authRequest(t *testing.T, method, url, secret, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestServer_Auth(t *testing.T) {
+	srv, q, secrets := newAuthServer(t,
+		auth.Token{Name: "reader", Scopes: []auth.Scope{auth.SCOPE_READ}},
+		auth.Token{Name: "submitter", Scopes: []auth.Scope{auth.SCOPE_SUBMIT}},
+		auth.Token{Name: "admin", Scopes: []auth.Scope{auth.SCOPE_ADMIN}},
+	)
+	job := addJob(t, q)
+	const body = `{"url": "https://www.youtube.com/watch?v=a"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"no token", http.MethodGet, "/jobs", "", http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/jobs", auth.TOKEN_PREFIX + "wrong", http.StatusUnauthorized},
+		{"read", http.MethodGet, "/jobs", "reader", http.StatusOK},
+		{"read without scope", http.MethodGet, "/jobs", "submitter", http.StatusForbidden},
+		{"submit without scope", http.MethodPost, "/jobs", "reader", http.StatusForbidden},
+		{"submit", http.MethodPost, "/jobs", "submitter", http.StatusCreated},
+		{"cancel another token's job", http.MethodDelete, "/jobs/" + job.ID, "submitter", http.StatusForbidden},
+		{"admin reads", http.MethodGet, "/jobs/" + job.ID, "admin", http.StatusOK},
+		{"admin cancels any job", http.MethodDelete, "/jobs/" + job.ID, "admin", http.StatusOK},
+		{"query token for streams", http.MethodGet, "/jobs/nope/events?access_token=" + secrets["reader"], "", http.StatusNotFound},
+		{"query token elsewhere", http.MethodGet, "/jobs?access_token=" + secrets["reader"], "", http.StatusUnauthorized},
+		{"openapi is public", http.MethodGet, "/openapi.json", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, ok := secrets[tt.token]
+			if !ok {
+				secret = tt.token
+			}
+			resp := authRequest(t, tt.method, srv.URL+tt.path, secret, body)
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestServer_AuthWithoutTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), auth.FILE_NAME)
+	list, _ := auth.Load(path)
+	_, secret, err := list.Create(auth.Token{Name: "last", Scopes: []auth.Scope{auth.SCOPE_ADMIN}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	store, err := auth.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(q, Options{BaseDir: t.TempDir(), Tokens: store}).Handler())
+	defer srv.Close()
+
+	if resp := authRequest(t, http.MethodGet, srv.URL+"/jobs", secret, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /jobs status = %d, want 200", resp.StatusCode)
+	}
+
+	// Revoking the last token locks the API instead of opening it.
+	if _, err := list.Revoke("last"); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"", secret} {
+		if resp := authRequest(t, http.MethodGet, srv.URL+"/jobs", secret, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET /jobs without tokens status = %d, want 401", resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_AuthLimits(t *testing.T) {
+	srv, q, secrets := newAuthServer(t,
+		auth.Token{Name: "quota", Scopes: []auth.Scope{auth.SCOPE_SUBMIT}, MaxJobs: 1},
+		auth.Token{Name: "limited", Scopes: []auth.Scope{auth.SCOPE_READ}, RateLimit: 2},
+	)
+	const body = `{"url": "https://www.youtube.com/watch?v=a"}`
+
+	if resp := authRequest(t, http.MethodPost, srv.URL+"/jobs", secrets["quota"], body); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first job status = %d, want 201", resp.StatusCode)
+	}
+	if resp := authRequest(t, http.MethodPost, srv.URL+"/jobs", secrets["quota"], body); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("job over the quota status = %d, want 429", resp.StatusCode)
+	}
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].Owner != "quota" {
+		t.Errorf("jobs = %+v, want one job owned by the token", jobs)
+	}
+
+	// The owner may cancel its job, which frees the quota.
+	if resp := authRequest(t, http.MethodDelete, srv.URL+"/jobs/"+jobs[0].ID, secrets["quota"], ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("cancel own job status = %d, want 200", resp.StatusCode)
+	}
+	if resp := authRequest(t, http.MethodPost, srv.URL+"/jobs", secrets["quota"], body); resp.StatusCode != http.StatusCreated {
+		t.Errorf("job after cancelling status = %d, want 201", resp.StatusCode)
+	}
+
+	for range 2 {
+		authRequest(t, http.MethodGet, srv.URL+"/jobs", secrets["limited"], "")
+	}
+	resp := authRequest(t, http.MethodGet, srv.URL+"/jobs", secrets["limited"], "")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("request over the rate limit = %d, Retry-After %q, want 429 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
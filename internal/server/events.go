@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/events"
+)
+
+// heartbeatInterval is how often idle event streams send a keep-alive so
+// that proxies do not close them.
+const heartbeatInterval = 15 * time.Second
+
+// subscribe subscribes to the events of the job in the path, or of all jobs
+// on the global endpoints. Clients resume after the event given by the
+// Last-Event-ID header or the "last_event_id" query parameter.
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) (*events.Subscription, bool) {
+	jobID := r.PathValue("id")
+	if jobID != "" {
+		if _, err := s.queue.Get(jobID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return nil, false
+		}
+	}
+
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID uint64
+	if value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid last event ID %q", value))
+			return nil, false
+		}
+		lastEventID = id
+	}
+	return s.events.Subscribe(jobID, lastEventID), true
+}
+
+// handleEvents streams job state changes and progress as Server-Sent Events.
+// The stream ends when a client falls too far behind; it then reconnects
+// with the ID of the last event it received.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	sub, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer s.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
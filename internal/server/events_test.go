@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/events"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+func newEventServer(t *testing.T) (*httptest.Server, *Server, *queue.Queue) {
+	t.Helper()
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(q, Options{BaseDir: t.TempDir()})
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv, s, q
+}
+
+func addJob(t *testing.T, q *queue.Queue) queue.Job {
+	t.Helper()
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/watch?v=a"
+	job, err := q.Add(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// openEventStream connects to an SSE endpoint. The subscription exists once
+// it returns.
+func openEventStream(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %s: status = %d, Content-Type = %q", url, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readSSE reads the next event of a stream, skipping comments.
+func readSSE(t *testing.T, r *bufio.Reader) (id, event string, e events.Event) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, event, e
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatalf("invalid event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestServer_EventStream(t *testing.T) {
+	srv, s, q := newEventServer(t)
+	job := addJob(t, q)
+	other := addJob(t, q)
+
+	stream := openEventStream(t, srv.URL+"/jobs/"+job.ID+"/events", "")
+	s.Progress(other.ID, downloader.Progress{Item: 1, Total: 1, Percent: 10})
+	s.Progress(job.ID, downloader.Progress{Item: 1, Total: 2, Title: "First", Percent: 42})
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	id, event, e := readSSE(t, stream)
+	if id != "4" || event != events.EVENT_PROGRESS || e.JobID != job.ID || e.Progress == nil || e.Progress.Percent != 42 {
+		t.Errorf("first event = %s %s %+v, want progress 4 of job %s", id, event, e, job.ID)
+	}
+	id, event, e = readSSE(t, stream)
+	if id != "5" || event != events.EVENT_JOB || e.Job == nil || e.Job.State != queue.STATE_CANCELLED {
+		t.Errorf("second event = %s %s %+v, want the cancellation as event 5", id, event, e)
+	}
+
+	// A reconnecting client receives the events after the last one it saw.
+	stream = openEventStream(t, srv.URL+"/events", "3")
+	for _, want := range []string{"4", "5"} {
+		if id, _, _ := readSSE(t, stream); id != want {
+			t.Errorf("replayed event %s, want %s", id, want)
+		}
+	}
+}
+
+func TestServer_EventStreamErrors(t *testing.T) {
+	srv, _, _ := newEventServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"unknown job", "/jobs/nope/events", http.StatusNotFound},
+		{"unknown job over websocket", "/jobs/nope/ws", http.StatusNotFound},
+		{"invalid last event ID", "/events?last_event_id=x", http.StatusBadRequest},
+		{"websocket without handshake", "/ws", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := doRequest(t, http.MethodGet, srv.URL+tt.path, "", nil); resp.StatusCode != tt.want {
+				t.Errorf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// writeClientFrame sends a masked frame like a WebSocket client.
+func writeClientFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame reads an unmasked frame sent by the server.
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("failed to read frame payload: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestServer_WebSocket(t *testing.T) {
+	srv, s, q := newEventServer(t)
+	job := addJob(t, q)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET /jobs/"+job.ID+"/ws?last_event_id=1 HTTP/1.1\r\nHost: localhost\r\n"+
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: "+key+"\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("handshake response = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Only events after the last event ID are sent, so the job's creation is
+	// skipped.
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.Progress(job.ID, downloader.Progress{Item: 1, Total: 1, Percent: 100})
+
+	var e events.Event
+	opcode, payload := readServerFrame(t, r)
+	if err := json.Unmarshal(payload, &e); opcode != opText || err != nil || e.ID != 2 || e.Job.State != queue.STATE_CANCELLED {
+		t.Errorf("first message = %d %s, want the cancellation as event 2", opcode, payload)
+	}
+	opcode, payload = readServerFrame(t, r)
+	if err := json.Unmarshal(payload, &e); opcode != opText || err != nil || e.Type != events.EVENT_PROGRESS {
+		t.Errorf("second message = %d %s, want progress", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, opPing, []byte("hi"))
+	if opcode, payload := readServerFrame(t, r); opcode != opPong || string(payload) != "hi" {
+		t.Errorf("ping answered with %d %q, want a pong", opcode, payload)
+	}
+	writeClientFrame(t, conn, opClose, nil)
+	if opcode, _ := readServerFrame(t, r); opcode != opClose {
+		t.Errorf("close answered with %d, want a close frame", opcode)
+	}
+}
+
+func TestServer_WebSocketOrigin(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(q, Options{BaseDir: t.TempDir(), AllowedOrigins: []string{"https://dashboard.example.com"}}).Handler())
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{"no origin", "", http.StatusSwitchingProtocols},
+		{"same origin", srv.URL, http.StatusSwitchingProtocols},
+		{"allowed origin", "https://dashboard.example.com", http.StatusSwitchingProtocols},
+		{"other origin", "https://evil.example.com", http.StatusForbidden},
+		{"other port", "http://127.0.0.1:1", http.StatusForbidden},
+		{"null origin", "null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			request := "GET /ws HTTP/1.1\r\nHost: " + srv.Listener.Addr().String() + "\r\n" +
+				"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+			if tt.origin != "" {
+				request += "Origin: " + tt.origin + "\r\n"
+			}
+			io.WriteString(conn, request+"\r\n")
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("handshake from %q = %d, want %d", tt.origin, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
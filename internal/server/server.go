@@ -0,0 +1,252 @@
+// Package server provides the HTTP API and web dashboard for submitting and
+// monitoring downloads run by the daemon.
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/hidekingerz/drop-tube/internal/auth"
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/events"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+const DEFAULT_LISTEN_ADDR = "127.0.0.1:8080"
+
+// maxRequestSize bounds the size of request bodies.
+const maxRequestSize = 1 << 20
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Options controls the HTTP API.
+type Options struct {
+	// BaseDir is the directory relative output directories of submitted
+	// jobs are resolved against. Output directories outside of it are
+	// rejected.
+	BaseDir string
+	// Tokens are the API tokens requests must present. Without a store the
+	// API is open to anyone who can connect; with an empty one every request
+	// is rejected until a token is created.
+	Tokens *auth.Store
+	// Jobs pauses, resumes and cancels jobs. The daemon running the queue
+	// also stops running jobs; by default only jobs that are not running can
+	// be changed.
+	Jobs JobController
+	// AllowedExtraArgs restricts the yt-dlp options of submitted jobs to the
+	// listed ones when non-empty.
+	AllowedExtraArgs []string
+	// AllowedOrigins are the origins of web pages other than the server's
+	// own that may open WebSockets, such as "https://dashboard.example.com".
+	AllowedOrigins []string
+}
+
+// JobController changes the state of jobs. It is implemented by the queue
+// and by the daemon running it.
+type JobController interface {
+	Cancel(id string) (queue.Job, error)
+	Pause(id string) (queue.Job, error)
+	Resume(id string) (queue.Job, error)
+}
+
+// Server serves the job API backed by a queue.
+type Server struct {
+	queue   *queue.Queue
+	options Options
+	mux     *http.ServeMux
+	events  *events.Broker
+	limiter *auth.RateLimiter
+}
+
+// errorResponse is the body of error responses.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New creates a Server for the queue.
+func New(q *queue.Queue, opts Options) *Server {
+	if opts.BaseDir == "" {
+		opts.BaseDir = config.DEFAULT_OUTPUT_DIR
+	}
+	if opts.Jobs == nil {
+		opts.Jobs = q
+	}
+
+	s := &Server{
+		queue:   q,
+		options: opts,
+		mux:     http.NewServeMux(),
+		events:  events.NewBroker(0),
+		limiter: auth.NewRateLimiter(),
+	}
+	q.Observe(s.events.PublishJob)
+
+	s.mux.HandleFunc("POST /jobs", s.requireScope(auth.SCOPE_SUBMIT, s.handleCreateJob))
+	s.mux.HandleFunc("GET /jobs", s.requireScope(auth.SCOPE_READ, s.handleListJobs))
+	s.mux.HandleFunc("GET /jobs/{id}", s.requireScope(auth.SCOPE_READ, s.handleGetJob))
+	s.mux.HandleFunc("DELETE /jobs/{id}", s.requireScope(auth.SCOPE_SUBMIT, s.handleJobAction(opts.Jobs.Cancel)))
+	s.mux.HandleFunc("POST /jobs/{id}/pause", s.requireScope(auth.SCOPE_SUBMIT, s.handleJobAction(opts.Jobs.Pause)))
+	s.mux.HandleFunc("POST /jobs/{id}/resume", s.requireScope(auth.SCOPE_SUBMIT, s.handleJobAction(opts.Jobs.Resume)))
+	s.mux.HandleFunc("GET /events", s.requireStreamScope(auth.SCOPE_READ, s.handleEvents))
+	s.mux.HandleFunc("GET /jobs/{id}/events", s.requireStreamScope(auth.SCOPE_READ, s.handleEvents))
+	s.mux.HandleFunc("GET /ws", s.requireStreamScope(auth.SCOPE_READ, s.handleWebSocket))
+	s.mux.HandleFunc("GET /jobs/{id}/ws", s.requireStreamScope(auth.SCOPE_READ, s.handleWebSocket))
+	s.mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("GET /{$}", s.handleDashboard)
+	s.mux.Handle("GET /assets/", webHandler())
+	return s
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Progress publishes the download progress of a running job to the event
+// streams. It is meant to be passed to the daemon as its progress callback.
+func (s *Server) Progress(jobID string, p downloader.Progress) {
+	s.events.PublishProgress(jobID, p)
+}
+
+// handleCreateJob queues a download. The body holds the job's
+// config.DownloadOptions in JSON; omitted fields take their default values. The "priority" query parameter
+// sets the job's priority.
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	// Requiring JSON also keeps browsers from submitting jobs from other
+	// sites, which they can only do with form or plain text bodies.
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+		return
+	}
+
+	opts := queue.AddOptions{}
+	if p := r.URL.Query().Get("priority"); p != "" {
+		priority, err := queue.ParsePriority(p)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts.Priority = priority
+	}
+
+	req := config.NewDownloadOptions(config.NewConfig())
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+		return
+	}
+	outputDir, err := config.ResolveOutputDir(s.options.BaseDir, req.OutputDir)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg := config.NewConfig()
+	req.Apply(cfg)
+	cfg.OutputDir = outputDir
+	cfg.AllowedExtraArgs = s.options.AllowedExtraArgs
+
+	if token, ok := requestToken(r); ok {
+		opts.Owner, opts.MaxActive = token.Name, token.MaxJobs
+	}
+	job, err := s.queue.AddWith(*cfg, opts)
+	switch {
+	case errors.Is(err, queue.ErrQuotaExceeded):
+		writeError(w, http.StatusTooManyRequests, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusCreated, job)
+}
+
+// handleListJobs lists the jobs, optionally only those in the state given
+// by the "state" query parameter.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	state := queue.State(r.URL.Query().Get("state"))
+
+	jobs := []queue.Job{}
+	for _, job := range s.queue.List() {
+		if state == "" || job.State == state {
+			jobs = append(jobs, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleGetJob returns a single job.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleJobAction returns a handler applying a state change such as
+// cancelling or pausing to the job in the path. Tokens without the admin
+// scope may only change their own jobs.
+func (s *Server) handleJobAction(action func(id string) (queue.Job, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Actions have no body whose content type would keep browsers from
+		// sending them from other sites, so those pages are rejected.
+		if !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests from origin %s may not change jobs", r.Header.Get("Origin")))
+			return
+		}
+		id := r.PathValue("id")
+		if token, ok := requestToken(r); ok && !token.Allows(auth.SCOPE_ADMIN) {
+			job, err := s.queue.Get(id)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			if job.Owner != token.Name {
+				writeError(w, http.StatusForbidden, fmt.Errorf("job %s was not submitted by token %q", id, token.Name))
+				return
+			}
+		}
+
+		job, err := action(id)
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeJSON(w, http.StatusOK, job)
+		}
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document of the API.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *queue.Queue, string) {
+	t.Helper()
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseDir := t.TempDir()
+	srv := httptest.NewServer(New(q, Options{BaseDir: baseDir}).Handler())
+	t.Cleanup(srv.Close)
+	return srv, q, baseDir
+}
+
+func doRequest(t *testing.T, method, url, body string, v any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+func TestServer_Jobs(t *testing.T) {
+	srv, q, baseDir := newTestServer(t)
+
+	var created queue.Job
+	resp := doRequest(t, http.MethodPost, srv.URL+"/jobs",
+		`{"url": "https://www.youtube.com/watch?v=a", "output_dir": "videos", "quality": "720p"}`, &created)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /jobs status = %d, want 201", resp.StatusCode)
+	}
+	if resp.Header.Get("Location") != "/jobs/"+created.ID {
+		t.Errorf("Location = %q, want /jobs/%s", resp.Header.Get("Location"), created.ID)
+	}
+	if created.State != queue.STATE_QUEUED || created.Config.Quality != "720p" || created.Config.Format != config.DEFAULT_FORMAT {
+		t.Errorf("created job = %+v, want a queued job with defaults and the given options", created)
+	}
+	if !strings.HasPrefix(created.Config.OutputDir, baseDir) {
+		t.Errorf("output dir = %q, want it below the base directory %q", created.Config.OutputDir, baseDir)
+	}
+
+	var urgent queue.Job
+	doRequest(t, http.MethodPost, srv.URL+"/jobs?priority=urgent", `{"url": "https://www.youtube.com/watch?v=b"}`, &urgent)
+	if urgent.Priority != queue.PRIORITY_URGENT || created.Priority != queue.PRIORITY_NORMAL {
+		t.Errorf("priorities = %v and %v, want urgent and normal", urgent.Priority, created.Priority)
+	}
+	if _, err := q.Cancel(urgent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []queue.Job
+	doRequest(t, http.MethodGet, srv.URL+"/jobs?state=queued", "", &listed)
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		t.Errorf("GET /jobs?state=queued = %+v, want the created job", listed)
+	}
+	doRequest(t, http.MethodGet, srv.URL+"/jobs?state=done", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("GET /jobs?state=done = %+v, want none", listed)
+	}
+
+	var got queue.Job
+	if resp := doRequest(t, http.MethodGet, srv.URL+"/jobs/"+created.ID, "", &got); resp.StatusCode != http.StatusOK || got.ID != created.ID {
+		t.Errorf("GET /jobs/{id} = %d %+v", resp.StatusCode, got)
+	}
+
+	var cancelled queue.Job
+	if resp := doRequest(t, http.MethodDelete, srv.URL+"/jobs/"+created.ID, "", &cancelled); resp.StatusCode != http.StatusOK || cancelled.State != queue.STATE_CANCELLED {
+		t.Errorf("DELETE /jobs/{id} = %d %+v, want a cancelled job", resp.StatusCode, cancelled)
+	}
+	if job, _ := q.Get(created.ID); job.State != queue.STATE_CANCELLED {
+		t.Errorf("queued job state = %s, want cancelled", job.State)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"missing URL", http.MethodPost, "/jobs", `{}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "bogus": true}`, http.StatusBadRequest},
+		{"malformed body", http.MethodPost, "/jobs", `{`, http.StatusBadRequest},
+		{"denied extra argument", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "extra_args": ["--exec", "rm"]}`, http.StatusBadRequest},
+		{"dry run", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "dry_run": true}`, http.StatusBadRequest},
+		{"report file", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "report_file": "/etc/cron.d/x"}`, http.StatusBadRequest},
+		{"output template", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "output_template": "../../x"}`, http.StatusBadRequest},
+		{"absolute output dir outside the base", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "output_dir": "/tmp"}`, http.StatusBadRequest},
+		{"relative output dir outside the base", http.MethodPost, "/jobs", `{"url": "https://www.youtube.com/watch?v=a", "output_dir": "videos/../../x"}`, http.StatusBadRequest},
+		{"invalid priority", http.MethodPost, "/jobs?priority=soon", `{"url": "https://www.youtube.com/watch?v=a"}`, http.StatusBadRequest},
+		{"unknown job", http.MethodGet, "/jobs/missing", "", http.StatusNotFound},
+		{"cancel unknown job", http.MethodDelete, "/jobs/missing", "", http.StatusNotFound},
+		{"method not allowed", http.MethodPut, "/jobs", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, tt.method, srv.URL+tt.path, tt.body, nil)
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	// Browsers can send plain text bodies to other sites without asking.
+	resp, err := http.Post(srv.URL+"/jobs", "text/plain", strings.NewReader(`{"url": "https://www.youtube.com/watch?v=a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("POST /jobs as text/plain status = %d, want 415", resp.StatusCode)
+	}
+}
+
+func TestServer_CancelFinished(t *testing.T) {
+	srv, q, _ := newTestServer(t)
+
+	cfg := config.NewConfig()
+	cfg.URL = "https://www.youtube.com/watch?v=a"
+	cfg.OutputDir = t.TempDir()
+	job, err := q.Add(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Claim(); err != nil {
+		t.Fatal(err)
+	}
+
+	var body errorResponse
+	resp := doRequest(t, http.MethodDelete, srv.URL+"/jobs/"+job.ID, "", &body)
+	if resp.StatusCode != http.StatusConflict || body.Error == "" {
+		t.Errorf("DELETE of a running job = %d %+v, want 409 with an error", resp.StatusCode, body)
+	}
+}
+
+func TestServer_PauseResume(t *testing.T) {
+	srv, q, _ := newTestServer(t)
+	job := addJob(t, q)
+
+	var paused queue.Job
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/jobs/"+job.ID+"/pause", "", &paused); resp.StatusCode != http.StatusOK || paused.State != queue.STATE_PAUSED {
+		t.Errorf("pause = %d %+v, want a paused job", resp.StatusCode, paused)
+	}
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/jobs/"+job.ID+"/pause", "", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("pause of a paused job status = %d, want 409", resp.StatusCode)
+	}
+
+	var resumed queue.Job
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/jobs/"+job.ID+"/resume", "", &resumed); resp.StatusCode != http.StatusOK || resumed.State != queue.STATE_QUEUED {
+		t.Errorf("resume = %d %+v, want a queued job", resp.StatusCode, resumed)
+	}
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/jobs/missing/resume", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("resume of an unknown job status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestServer_JobActionOrigin(t *testing.T) {
+	srv, q, _ := newTestServer(t)
+	job := addJob(t, q)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		origin string
+		want   int
+	}{
+		{"pause from other origin", http.MethodPost, "/pause", "https://evil.example.com", http.StatusForbidden},
+		{"resume from other origin", http.MethodPost, "/resume", "https://evil.example.com", http.StatusForbidden},
+		{"cancel from other origin", http.MethodDelete, "", "null", http.StatusForbidden},
+		{"pause from same origin", http.MethodPost, "/pause", srv.URL, http.StatusOK},
+		{"resume without origin", http.MethodPost, "/resume", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+"/jobs/"+job.ID+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s from %q = %d, want %d", tt.method, tt.path, tt.origin, resp.StatusCode, tt.want)
+			}
+		})
+	}
+	if got, _ := q.Get(job.ID); got.State != queue.STATE_QUEUED {
+		t.Errorf("job is %s, want it changed only by the same-origin requests", got.State)
+	}
+}
+
+// recordingController records the job actions the server hands to it.
+type recordingController struct {
+	*queue.Queue
+	actions []string
+}
+
+func (c *recordingController) Cancel(id string) (queue.Job, error) {
+	c.actions = append(c.actions, "cancel "+id)
+	return c.Queue.Cancel(id)
+}
+
+func (c *recordingController) Pause(id string) (queue.Job, error) {
+	c.actions = append(c.actions, "pause "+id)
+	return c.Queue.Pause(id)
+}
+
+func (c *recordingController) Resume(id string) (queue.Job, error) {
+	c.actions = append(c.actions, "resume "+id)
+	return c.Queue.Resume(id)
+}
+
+func TestServer_JobController(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := &recordingController{Queue: q}
+	srv := httptest.NewServer(New(q, Options{BaseDir: t.TempDir(), Jobs: jobs}).Handler())
+	t.Cleanup(srv.Close)
+	job := addJob(t, q)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPost, "/pause"}, {http.MethodPost, "/resume"}, {http.MethodDelete, ""},
+	} {
+		if resp := doRequest(t, req.method, srv.URL+"/jobs/"+job.ID+req.path, "", nil); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s /jobs/{id}%s status = %d, want 200", req.method, req.path, resp.StatusCode)
+		}
+	}
+	want := []string{"pause " + job.ID, "resume " + job.ID, "cancel " + job.ID}
+	if !reflect.DeepEqual(jobs.actions, want) {
+		t.Errorf("controller actions = %v, want %v", jobs.actions, want)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	var doc struct {
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	resp := doRequest(t, http.MethodGet, srv.URL+"/openapi.json", "", &doc)
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", resp.Header.Get("Content-Type"))
+	}
+
+	for path, methods := range map[string][]string{
+		"/jobs": {"get", "post"}, "/jobs/{id}": {"get", "delete"},
+		"/jobs/{id}/pause": {"post"}, "/jobs/{id}/resume": {"post"},
+		"/events": {"get"}, "/jobs/{id}/events": {"get"}, "/ws": {"get"}, "/jobs/{id}/ws": {"get"},
+	} {
+		for _, method := range methods {
+			if doc.Paths[path][method] == nil {
+				t.Errorf("OpenAPI document does not describe %s %s", method, path)
+			}
+		}
+	}
+
+	// The Config and JobRequest schemas must stay in sync with their types.
+	for schema, typ := range map[string]reflect.Type{"Config": reflect.TypeOf(config.Config{}), "JobRequest": reflect.TypeOf(config.DownloadOptions{})} {
+		properties := doc.Components.Schemas[schema].Properties
+		fields := jsonFields(typ)
+		for _, name := range fields {
+			if properties[name] == nil {
+				t.Errorf("OpenAPI %s schema is missing %q", schema, name)
+			}
+		}
+		if len(properties) != len(fields) {
+			t.Errorf("OpenAPI %s schema has %d properties, %s has %d fields", schema, len(properties), typ, len(fields))
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of a struct type.
+func jsonFields(typ reflect.Type) []string {
+	var names []string
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFiles is the dashboard. It has no external assets so that it works
+// without internet access.
+//
+//go:embed web
+var webFiles embed.FS
+
+// webHandler serves the dashboard's assets.
+func webHandler() http.Handler {
+	assets, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/assets/", http.FileServerFS(assets))
+}
+
+// handleDashboard serves the dashboard page. The page itself is public; it
+// asks for an API token when the API requires one.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	http.ServeFileFS(w, r, webFiles, "web/index.html")
+}
@@ -0,0 +1,229 @@
+"use strict";
+
+// The dashboard talks to the same API as other clients: it loads the jobs
+// once, then follows /events to keep the tables and progress bars current.
+
+const TOKEN_KEY = "drop-tube-token";
+const PRIORITY_NAMES = { "-1": "low", 0: "normal", 1: "high", 2: "urgent" };
+const jobs = new Map();
+const progress = new Map();
+let lastEventID = 0;
+let source = null;
+
+const $ = (id) => document.getElementById(id);
+
+function token() {
+  return localStorage.getItem(TOKEN_KEY) || "";
+}
+
+async function api(method, path, body) {
+  const headers = {};
+  if (token()) headers["Authorization"] = "Bearer " + token();
+  if (body !== undefined) headers["Content-Type"] = "application/json";
+  const resp = await fetch(path, { method, headers, body: body === undefined ? undefined : JSON.stringify(body) });
+  if (resp.status === 401) {
+    askToken();
+    throw new Error("an API token is required");
+  }
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || resp.statusText);
+  return data;
+}
+
+function askToken() {
+  const dialog = $("token-dialog");
+  if (dialog.open) return;
+  $("token-input").value = token();
+  dialog.showModal();
+}
+
+$("token-button").addEventListener("click", askToken);
+$("token-dialog").addEventListener("close", () => {
+  if ($("token-dialog").returnValue !== "save") return;
+  localStorage.setItem(TOKEN_KEY, $("token-input").value.trim());
+  start();
+});
+
+// formConfig converts the form into a job configuration. Empty fields are
+// left out so that the server applies its defaults.
+function formConfig(form) {
+  const cfg = {};
+  for (const el of form.elements) {
+    if (!el.name) continue;
+    if (el.type === "checkbox") {
+      if (el.checked) cfg[el.name] = true;
+      continue;
+    }
+    const value = el.value.trim();
+    if (value === "") continue;
+    if (el.dataset.list) {
+      cfg[el.name] = value.split(/\s+/);
+    } else if (el.dataset.unit === "seconds") {
+      cfg[el.name] = Number(value) * 1e9; // durations are nanoseconds
+    } else if (el.type === "number") {
+      cfg[el.name] = Number(value);
+    } else {
+      cfg[el.name] = value;
+    }
+  }
+  return cfg;
+}
+
+$("submit-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const error = $("submit-error");
+  error.hidden = true;
+  try {
+    const job = await api("POST", "/jobs?priority=" + $("priority").value, formConfig(form));
+    jobs.set(job.id, job);
+    form.elements.url.value = "";
+    render();
+  } catch (err) {
+    error.textContent = err.message;
+    error.hidden = false;
+  }
+});
+
+async function act(method, id, action) {
+  try {
+    jobs.set(id, await api(method, "/jobs/" + encodeURIComponent(id) + action));
+    render();
+  } catch (err) {
+    alert(err.message);
+  }
+}
+
+function actionButton(td, label, method, id, action) {
+  const button = document.createElement("button");
+  button.textContent = label;
+  button.addEventListener("click", () => act(method, id, action));
+  td.append(button, " ");
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) td.className = className;
+  return td;
+}
+
+function stateCell(row, job) {
+  const span = document.createElement("span");
+  span.className = "state " + job.state;
+  span.textContent = job.state;
+  row.insertCell().append(span);
+}
+
+function when(time) {
+  return time ? new Date(time).toLocaleString() : "";
+}
+
+function progressCell(row, job) {
+  const td = row.insertCell();
+  const p = progress.get(job.id);
+  if (job.state !== "running" || !p) {
+    td.textContent = job.attempts > 1 ? "resumed, attempt " + job.attempts : "";
+    return;
+  }
+  const bar = document.createElement("progress");
+  bar.max = 100;
+  bar.value = p.percent;
+  const detail = document.createElement("div");
+  detail.className = "detail";
+  const item = p.total > 1 ? `${p.item}/${p.total} ` : "";
+  detail.textContent = `${item}${p.title || p.id || ""} ${p.percent.toFixed(1)}%`;
+  td.append(bar, detail);
+}
+
+function summary(job) {
+  const counts = {};
+  for (const r of job.results || []) counts[r.status] = (counts[r.status] || 0) + 1;
+  const parts = Object.entries(counts).map(([status, n]) => `${n} ${status}`);
+  if (job.error) parts.push(job.error);
+  return parts.join(", ");
+}
+
+function render() {
+  const all = [...jobs.values()].sort((a, b) => a.created_at.localeCompare(b.created_at) || a.id.localeCompare(b.id));
+  const finished = all.filter((j) => !["queued", "running", "paused"].includes(j.state)).reverse();
+  // Unfinished jobs are listed in the order they start: by priority, then by
+  // submission.
+  const active = all.filter((j) => !finished.includes(j)).sort((a, b) => (b.priority || 0) - (a.priority || 0));
+
+  const queue = $("queue");
+  queue.replaceChildren();
+  for (const job of active) {
+    const row = queue.insertRow();
+    stateCell(row, job);
+    cell(row, PRIORITY_NAMES[job.priority || 0] || String(job.priority));
+    cell(row, job.config.url, "url");
+    progressCell(row, job);
+    cell(row, when(job.created_at), "when");
+    const td = row.insertCell();
+    if (job.state === "paused") actionButton(td, "Resume", "POST", job.id, "/resume");
+    else actionButton(td, "Pause", "POST", job.id, "/pause");
+    actionButton(td, "Cancel", "DELETE", job.id, "");
+  }
+  $("queue-empty").hidden = active.length > 0;
+
+  const history = $("history");
+  history.replaceChildren();
+  for (const job of finished) {
+    const row = history.insertRow();
+    stateCell(row, job);
+    cell(row, job.config.url, "url");
+    cell(row, summary(job));
+    cell(row, when(job.finished_at), "when");
+  }
+  $("history-empty").hidden = finished.length > 0;
+}
+
+function setConnection(live) {
+  const status = $("connection");
+  status.textContent = live ? "live" : "offline";
+  status.classList.toggle("live", live);
+}
+
+function handleEvent(event) {
+  const e = JSON.parse(event.data);
+  lastEventID = e.id;
+  if (e.type === "job") {
+    jobs.set(e.job.id, e.job);
+    if (e.job.state !== "running") progress.delete(e.job.id);
+  } else if (e.type === "progress") {
+    progress.set(e.job_id, e.progress);
+  }
+  render();
+}
+
+// follow subscribes to the event stream, resuming after the last event seen
+// when the connection is re-established.
+function follow() {
+  if (source) source.close();
+  const params = new URLSearchParams();
+  if (token()) params.set("access_token", token());
+  if (lastEventID) params.set("last_event_id", lastEventID);
+  source = new EventSource("/events?" + params);
+  source.addEventListener("open", () => setConnection(true));
+  source.addEventListener("job", handleEvent);
+  source.addEventListener("progress", handleEvent);
+  source.addEventListener("error", () => {
+    setConnection(false);
+    if (source.readyState === EventSource.CLOSED) setTimeout(follow, 3000);
+  });
+}
+
+async function start() {
+  try {
+    jobs.clear();
+    for (const job of await api("GET", "/jobs")) jobs.set(job.id, job);
+    render();
+    follow();
+  } catch (err) {
+    setConnection(false);
+    console.error(err);
+  }
+}
+
+start();
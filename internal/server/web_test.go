@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+func TestServer_Dashboard(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/", "text/html"},
+		{"/assets/app.js", "text/javascript"},
+		{"/assets/style.css", "text/css"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), tt.contentType) {
+				t.Errorf("GET %s = %d %q, want 200 %s", tt.path, resp.StatusCode, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+		})
+	}
+
+	if resp := doRequest(t, http.MethodGet, srv.URL+"/nope", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /nope status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestDashboard_FormFields(t *testing.T) {
+	page, err := webFiles.ReadFile("web/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string]bool)
+	for _, name := range jsonFields(reflect.TypeOf(config.DownloadOptions{})) {
+		tags[name] = true
+	}
+
+	fields := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`<(?:input|select)[^>]* name="([a-z_]+)"`).FindAllStringSubmatch(string(page), -1) {
+		fields[m[1]] = true
+		if !tags[m[1]] {
+			t.Errorf("form field %q is not a job request option", m[1])
+		}
+	}
+	for name := range tags {
+		if !fields[name] {
+			t.Errorf("job request option %q is missing from the form", name)
+		}
+	}
+}
+
+func TestDashboard_NoExternalAssets(t *testing.T) {
+	for _, name := range []string{"web/index.html", "web/app.js", "web/style.css"} {
+		f, err := webFiles.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if m := regexp.MustCompile(`(src|href)="(https?:)?//`).Find(data); m != nil {
+			t.Errorf("%s loads an external asset: %s", name, m)
+		}
+	}
+}
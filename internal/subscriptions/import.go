@@ -0,0 +1,168 @@
+package subscriptions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+const (
+	FORMAT_OPML     = "opml"
+	FORMAT_NEWPIPE  = "newpipe"
+	FORMAT_FREETUBE = "freetube"
+)
+
+// newPipeYouTubeService is NewPipe's service ID for YouTube.
+const newPipeYouTubeService = 0
+
+// Import parses a subscription export in the given format. An empty format
+// detects it from the content.
+func Import(data []byte, format string) ([]Subscription, error) {
+	if format == "" {
+		format = DetectFormat(data)
+	}
+
+	switch format {
+	case FORMAT_OPML:
+		return parseOPML(data)
+	case FORMAT_NEWPIPE:
+		return parseNewPipe(data)
+	case FORMAT_FREETUBE:
+		return parseFreeTube(data)
+	case "":
+		return nil, fmt.Errorf("unrecognized subscription export format")
+	default:
+		return nil, fmt.Errorf("unknown import format %q, expected %s, %s or %s",
+			format, FORMAT_OPML, FORMAT_NEWPIPE, FORMAT_FREETUBE)
+	}
+}
+
+// DetectFormat guesses the format of a subscription export. OPML is XML,
+// NewPipe exports are a JSON object with the app version, and FreeTube
+// exports are one JSON profile per line. It returns "" if the content is
+// neither XML nor JSON.
+func DetectFormat(data []byte) string {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("<")):
+		return FORMAT_OPML
+	case !bytes.HasPrefix(data, []byte("{")):
+		return ""
+	}
+
+	var header struct {
+		AppVersion *json.RawMessage `json:"app_version"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&header); err == nil && header.AppVersion != nil {
+		return FORMAT_NEWPIPE
+	}
+	return FORMAT_FREETUBE
+}
+
+// opmlOutline is an outline element; feeds may be nested in folders.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// parseOPML reads the YouTube channel feeds of an OPML document. Outlines
+// that are not YouTube channels are ignored.
+func parseOPML(data []byte) ([]Subscription, error) {
+	var doc struct {
+		XMLName xml.Name      `xml:"opml"`
+		Body    []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+
+	subs := []Subscription{}
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			walk(o.Outlines)
+
+			name := o.Title
+			if name == "" {
+				name = o.Text
+			}
+			if id, ok := youtubeurl.ChannelID(o.XMLURL); ok {
+				subs = append(subs, Subscription{Name: name, URL: youtubeurl.ChannelURL(id), ChannelID: id})
+			} else if youtubeurl.IsChannel(o.HTMLURL) {
+				subs = append(subs, Subscription{Name: name, URL: o.HTMLURL})
+			}
+		}
+	}
+	walk(doc.Body)
+	return subs, nil
+}
+
+// parseNewPipe reads a NewPipe subscriptions export. Channels of services
+// other than YouTube are ignored.
+func parseNewPipe(data []byte) ([]Subscription, error) {
+	var export struct {
+		Subscriptions []struct {
+			ServiceID int    `json:"service_id"`
+			URL       string `json:"url"`
+			Name      string `json:"name"`
+		} `json:"subscriptions"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse NewPipe export: %w", err)
+	}
+
+	subs := []Subscription{}
+	for _, s := range export.Subscriptions {
+		if s.ServiceID != newPipeYouTubeService || !youtubeurl.IsChannel(s.URL) {
+			continue
+		}
+		subs = append(subs, Subscription{Name: s.Name, URL: s.URL})
+	}
+	return subs, nil
+}
+
+// parseFreeTube reads a FreeTube subscriptions export, which holds one
+// profile per line. Channels in several profiles are returned once.
+func parseFreeTube(data []byte) ([]Subscription, error) {
+	subs := []Subscription{}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var profile struct {
+			Subscriptions []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"subscriptions"`
+		}
+		if err := json.Unmarshal([]byte(text), &profile); err != nil {
+			return nil, fmt.Errorf("failed to parse FreeTube export line %d: %w", line, err)
+		}
+
+		for _, s := range profile.Subscriptions {
+			if s.ID == "" || seen[s.ID] {
+				continue
+			}
+			seen[s.ID] = true
+			subs = append(subs, Subscription{Name: s.Name, URL: youtubeurl.ChannelURL(s.ID), ChannelID: s.ID})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read FreeTube export: %w", err)
+	}
+	return subs, nil
+}
@@ -0,0 +1,90 @@
+package subscriptions
+
+import (
+	"reflect"
+	"testing"
+)
+
+const opmlExport = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.1">
+  <body>
+    <outline text="YouTube Subscriptions" title="YouTube Subscriptions">
+      <outline text="First" title="First Channel" type="rss" xmlUrl="https://www.youtube.com/feeds/videos.xml?channel_id=UC1"/>
+      <outline text="Second" type="rss" xmlUrl="https://example.com/feed" htmlUrl="https://www.youtube.com/@second"/>
+      <outline text="Blog" type="rss" xmlUrl="https://example.com/blog.xml"/>
+    </outline>
+  </body>
+</opml>`
+
+const newPipeExport = `{
+  "app_version": "0.27.0",
+  "app_version_int": 997,
+  "subscriptions": [
+    {"service_id": 0, "url": "https://www.youtube.com/channel/UC1", "name": "First"},
+    {"service_id": 1, "url": "https://soundcloud.com/someone", "name": "SoundCloud"}
+  ]
+}`
+
+const freeTubeExport = `{"name":"All Channels","bgColor":"#000000","textColor":"#FFFFFF","subscriptions":[{"id":"UC1","name":"First","thumbnail":""},{"id":"UC2","name":"Second","thumbnail":""}],"_id":"allChannels"}
+{"name":"Music","bgColor":"#FF0000","textColor":"#FFFFFF","subscriptions":[{"id":"UC2","name":"Second","thumbnail":""}],"_id":"music"}
+`
+
+func TestImport(t *testing.T) {
+	first := Subscription{Name: "First", URL: "https://www.youtube.com/channel/UC1", ChannelID: "UC1"}
+	second := Subscription{Name: "Second", URL: "https://www.youtube.com/channel/UC2", ChannelID: "UC2"}
+
+	tests := []struct {
+		name    string
+		data    string
+		format  string
+		want    []Subscription
+		wantErr bool
+	}{
+		{
+			name: "opml",
+			data: opmlExport,
+			want: []Subscription{
+				{Name: "First Channel", URL: "https://www.youtube.com/channel/UC1", ChannelID: "UC1"},
+				{Name: "Second", URL: "https://www.youtube.com/@second"},
+			},
+		},
+		{name: "newpipe", data: newPipeExport, want: []Subscription{{Name: "First", URL: "https://www.youtube.com/channel/UC1"}}},
+		{name: "freetube", data: freeTubeExport, want: []Subscription{first, second}},
+		{name: "explicit format", data: freeTubeExport, format: FORMAT_FREETUBE, want: []Subscription{first, second}},
+		{name: "wrong format", data: newPipeExport, format: FORMAT_OPML, wantErr: true},
+		{name: "unknown format", data: opmlExport, format: "csv", wantErr: true},
+		{name: "unrecognized content", data: "Channel Id,Channel Url", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Import([]byte(tt.data), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Import() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Import() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{opmlExport, FORMAT_OPML},
+		{newPipeExport, FORMAT_NEWPIPE},
+		{freeTubeExport, FORMAT_FREETUBE},
+		{"plain text", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := DetectFormat([]byte(tt.data)); got != tt.want {
+				t.Errorf("DetectFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/feed"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+	"github.com/hidekingerz/drop-tube/internal/playlist"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+// ResolveChannelIDs looks up the channel ID of every subscription that does
+// not have one yet, which is needed to poll its feed. It returns whether any
+// subscription changed; subscriptions that cannot be resolved are reported
+// in the error and left unchanged.
+func (l *List) ResolveChannelIDs(base *config.Config) (bool, error) {
+	changed := false
+	var errs []error
+	for i := range l.Subscriptions {
+		sub := &l.Subscriptions[i]
+		if sub.ChannelID != "" {
+			continue
+		}
+
+		cfg := *base
+		cfg.URL = sub.URL
+		id, err := downloader.New(&cfg).ChannelID()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Name, err))
+			continue
+		}
+		sub.ChannelID = id
+		changed = true
+	}
+	return changed, errors.Join(errs...)
+}
+
+// Poll checks the feed of every subscription and downloads the uploads that
+// were not seen before, like Sync but without listing the whole channel.
+// Uploads that were downloaded, skipped or failed permanently are marked as
+// seen; the others are returned again by the next poll. Subscriptions of
+// the streams or podcasts tab cannot be told apart in the feed and are
+// synced with a full listing instead. Like Sync, Poll stops when
+// opts.Context is cancelled.
+func Poll(subs []Subscription, base *config.Config, baseDir string, poller *feed.Poller, opts Options, w io.Writer) error {
+	var errs []error
+	for _, sub := range subs {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			errs = append(errs, fmt.Errorf("poll stopped: %w", opts.Context.Err()))
+			break
+		}
+		fmt.Fprintf(w, "== %s (%s)\n", sub.Name, sub.URL)
+
+		summary, err := pollSubscription(sub, base, baseDir, poller, opts)
+		opts.synced(sub, summary, err)
+		if summary != nil {
+			summary.Print(w)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pollSubscription polls the feed of a single subscription and downloads
+// its new uploads.
+func pollSubscription(sub Subscription, base *config.Config, baseDir string, poller *feed.Poller, opts Options) (*mirror.Summary, error) {
+	cfg := sub.Config(base, baseDir)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	syncer := mirror.New(cfg, mirror.Options{Prune: sub.Prune, AfterDownload: opts.AfterDownload, Context: opts.Context})
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if cfg.Tab == youtubeurl.TAB_STREAMS || cfg.Tab == youtubeurl.TAB_PODCASTS {
+		return syncer.Sync()
+	}
+	if sub.ChannelID == "" {
+		return nil, fmt.Errorf("channel ID is unknown, the feed cannot be polled")
+	}
+
+	entries, err := poller.Poll(ctx, sub.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries of other tabs are not downloaded and do not need to be seen again.
+	var wanted []playlist.Entry
+	var ignored []string
+	for _, e := range entries {
+		if inTab(e, cfg.Tab) {
+			wanted = append(wanted, e)
+		} else {
+			ignored = append(ignored, e.ID)
+		}
+	}
+	poller.MarkSeen(sub.ChannelID, ignored...)
+	if len(wanted) == 0 {
+		return &mirror.Summary{Added: []downloader.Result{}, Removed: []string{}}, nil
+	}
+
+	summary, err := syncer.SyncEntries(wanted)
+	if summary == nil {
+		return nil, err
+	}
+
+	retry := make(map[string]bool)
+	if summary.Report != nil {
+		for _, res := range summary.Report.Results {
+			if res.Status == downloader.STATUS_ABORTED || (res.Status == downloader.STATUS_FAILED && res.Transient) {
+				retry[res.ID] = true
+			}
+		}
+	}
+	var seen []string
+	for _, e := range wanted {
+		if !retry[e.ID] {
+			seen = append(seen, e.ID)
+		}
+	}
+	poller.MarkSeen(sub.ChannelID, seen...)
+
+	return summary, err
+}
+
+// inTab reports whether a feed entry belongs to the channel tab. Feeds only
+// tell Shorts apart from other uploads.
+func inTab(e playlist.Entry, tab string) bool {
+	switch tab {
+	case youtubeurl.TAB_VIDEOS:
+		return !youtubeurl.IsShort(e.VideoURL())
+	case youtubeurl.TAB_SHORTS:
+		return youtubeurl.IsShort(e.VideoURL())
+	default:
+		return true
+	}
+}
@@ -0,0 +1,120 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/feed"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns="http://www.w3.org/2005/Atom">
+ <yt:channelId>UC123</yt:channelId>
+ <title>Example</title>
+ <entry><yt:videoId>short1</yt:videoId><title>Short</title><link rel="alternate" href="https://www.youtube.com/shorts/short1"/></entry>
+ <entry><yt:videoId>newvideo001</yt:videoId><title>New</title><link rel="alternate" href="https://www.youtube.com/watch?v=newvideo001"/></entry>
+ <entry><yt:videoId>oldvideo001</yt:videoId><title>Old</title><link rel="alternate" href="https://www.youtube.com/watch?v=oldvideo001"/></entry>
+</feed>`
+
+const fakeDownloadScript = `#!/bin/sh
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*)
+	for arg in "$@"; do
+		case "$arg" in
+		*watch?v=*)
+			echo "[youtube] Extracting URL: $arg"
+			echo "[download] 100% of 1.00MiB"
+			echo "$arg" >> "$FAKE_DOWNLOADS"
+			;;
+		esac
+	done
+	;;
+esac
+`
+
+func TestPoll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp requires a POSIX shell")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(fakeDownloadScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	downloads := filepath.Join(t.TempDir(), "downloads")
+	t.Setenv("FAKE_DOWNLOADS", downloads)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testFeed))
+	}))
+	defer srv.Close()
+	poller := feed.NewPoller(&feed.State{Channels: make(map[string]*feed.ChannelState)})
+	poller.Client = srv.Client()
+	poller.FeedURL = srv.URL
+
+	baseDir := t.TempDir()
+	sub := Subscription{Name: "Example", URL: "https://www.youtube.com/channel/UC123", ChannelID: "UC123", Tab: "videos"}
+	if err := os.MkdirAll(filepath.Join(baseDir, "Example"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "Example", "Old [oldvideo001].mp4"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := Poll([]Subscription{sub}, config.NewConfig(), baseDir, poller, Options{}, &out); err != nil {
+		t.Fatalf("Poll() error = %v\n%s", err, out.String())
+	}
+
+	data, err := os.ReadFile(downloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); !reflect.DeepEqual(got, []string{"https://www.youtube.com/watch?v=newvideo001"}) {
+		t.Errorf("downloaded %v, want only the new video", got)
+	}
+
+	cs := poller.State.Channels["UC123"]
+	if len(cs.Pending) != 0 {
+		t.Errorf("pending entries after poll = %+v, want none", cs.Pending)
+	}
+	if !strings.Contains(out.String(), "1 added") {
+		t.Errorf("Poll() output = %q, want the sync summary", out.String())
+	}
+}
+
+func TestPoll_Cancelled(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Write([]byte(testFeed))
+	}))
+	defer srv.Close()
+	poller := feed.NewPoller(&feed.State{Channels: make(map[string]*feed.ChannelState)})
+	poller.Client = srv.Client()
+	poller.FeedURL = srv.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sub := Subscription{Name: "Example", URL: "https://www.youtube.com/channel/UC123", ChannelID: "UC123", Tab: "videos"}
+	var out strings.Builder
+	err := Poll([]Subscription{sub}, config.NewConfig(), t.TempDir(), poller, Options{Context: ctx}, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Poll() error = %v, want context.Canceled", err)
+	}
+	if requested {
+		t.Error("Poll() requested a feed after the context was cancelled")
+	}
+}
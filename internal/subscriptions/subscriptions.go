@@ -0,0 +1,239 @@
+// Package subscriptions manages the list of channels drop-tube keeps in sync.
+// The list is stored as JSON in drop-tube's data directory and can be
+// imported from OPML, NewPipe and FreeTube exports.
+package subscriptions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/youtubeurl"
+)
+
+const FILE_NAME = "subscriptions.json"
+
+// ErrNotFound is returned when no subscription matches a name or URL.
+var ErrNotFound = errors.New("subscription not found")
+
+// Subscription is a channel to mirror together with its per-channel settings.
+// Zero-valued settings fall back to the options given on the command line.
+type Subscription struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	ChannelID string `json:"channel_id,omitempty"`
+
+	// Dir is the directory to mirror the channel into. Relative paths are
+	// resolved against the sync directory; the default is the channel name.
+	Dir string `json:"dir,omitempty"`
+	// Prune removes local files of videos that are no longer on the channel.
+	Prune bool `json:"prune,omitempty"`
+
+	Tab         string        `json:"tab,omitempty"`
+	Latest      int           `json:"latest,omitempty"`
+	AudioOnly   bool          `json:"audio_only,omitempty"`
+	Format      string        `json:"format,omitempty"`
+	Quality     string        `json:"quality,omitempty"`
+	MinDuration time.Duration `json:"min_duration,omitempty"`
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	MatchTitle  string        `json:"match_title,omitempty"`
+	RejectTitle string        `json:"reject_title,omitempty"`
+}
+
+// List is the stored subscription list.
+type List struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// DefaultPath returns the location of the subscription list in the data directory.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FILE_NAME), nil
+}
+
+// Load reads the subscription list at path. A missing file is an empty list.
+func Load(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &List{Subscriptions: []Subscription{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions %s: %w", path, err)
+	}
+
+	var list List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions %s: %w", path, err)
+	}
+	if list.Subscriptions == nil {
+		list.Subscriptions = []Subscription{}
+	}
+	return &list, nil
+}
+
+// Save writes the subscription list to path, creating its directory if needed.
+// The file is replaced atomically so that an interrupted write cannot lose
+// the list.
+func (l *List) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode subscriptions: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write subscriptions %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write subscriptions %s: %w", path, err)
+	}
+	return nil
+}
+
+// Add validates sub, fills in its channel ID and name where they can be
+// derived from the URL, and appends it to the list. A channel that is
+// already subscribed is an error.
+func (l *List) Add(sub Subscription) error {
+	sub, err := normalize(sub)
+	if err != nil {
+		return err
+	}
+	if existing := l.find(sub); existing != nil {
+		return fmt.Errorf("already subscribed to %s as %q", sub.URL, existing.Name)
+	}
+	for _, s := range l.Subscriptions {
+		if strings.EqualFold(s.Name, sub.Name) {
+			return fmt.Errorf("a subscription named %q already exists", sub.Name)
+		}
+	}
+
+	l.Subscriptions = append(l.Subscriptions, sub)
+	return nil
+}
+
+// Merge adds the subscriptions that are not in the list yet and returns how
+// many were added. Subscriptions whose name is taken get a numbered name.
+func (l *List) Merge(subs []Subscription) (int, error) {
+	added := 0
+	for _, sub := range subs {
+		sub, err := normalize(sub)
+		if err != nil {
+			return added, err
+		}
+		if l.find(sub) != nil {
+			continue
+		}
+		sub.Name = l.uniqueName(sub.Name)
+		l.Subscriptions = append(l.Subscriptions, sub)
+		added++
+	}
+	return added, nil
+}
+
+// Remove removes the subscription with the given name, URL or channel ID.
+func (l *List) Remove(key string) (Subscription, error) {
+	for i, s := range l.Subscriptions {
+		if s.matches(key) {
+			l.Subscriptions = append(l.Subscriptions[:i], l.Subscriptions[i+1:]...)
+			return s, nil
+		}
+	}
+	return Subscription{}, fmt.Errorf("%q: %w", key, ErrNotFound)
+}
+
+// Get returns the subscription with the given name, URL or channel ID.
+func (l *List) Get(key string) (Subscription, error) {
+	for _, s := range l.Subscriptions {
+		if s.matches(key) {
+			return s, nil
+		}
+	}
+	return Subscription{}, fmt.Errorf("%q: %w", key, ErrNotFound)
+}
+
+// find returns the subscription for the same channel as sub, if any.
+func (l *List) find(sub Subscription) *Subscription {
+	for i := range l.Subscriptions {
+		s := &l.Subscriptions[i]
+		if s.URL == sub.URL || (s.ChannelID != "" && s.ChannelID == sub.ChannelID) {
+			return s
+		}
+	}
+	return nil
+}
+
+// uniqueName returns name, or name with a numeric suffix if it is taken.
+func (l *List) uniqueName(name string) string {
+	taken := func(n string) bool {
+		for _, s := range l.Subscriptions {
+			if strings.EqualFold(s.Name, n) {
+				return true
+			}
+		}
+		return false
+	}
+
+	unique := name
+	for i := 2; taken(unique); i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return unique
+}
+
+// matches reports whether key is the subscription's name, URL or channel ID.
+func (s Subscription) matches(key string) bool {
+	return strings.EqualFold(s.Name, key) || s.URL == strings.TrimSuffix(key, "/") ||
+		(s.ChannelID != "" && s.ChannelID == key)
+}
+
+// normalize checks that the subscription points to a channel and derives
+// its channel ID and a default name from the URL.
+func normalize(sub Subscription) (Subscription, error) {
+	sub.URL = strings.TrimSuffix(strings.TrimSpace(sub.URL), "/")
+	if !youtubeurl.IsChannel(sub.URL) {
+		return sub, fmt.Errorf("not a YouTube channel URL: %s", sub.URL)
+	}
+	if sub.Tab != "" && !youtubeurl.ValidTab(sub.Tab) {
+		return sub, fmt.Errorf("invalid channel tab %q", sub.Tab)
+	}
+	if sub.Latest < 0 {
+		return sub, fmt.Errorf("latest must not be negative: %d", sub.Latest)
+	}
+
+	if sub.ChannelID == "" {
+		sub.ChannelID, _ = youtubeurl.ChannelID(sub.URL)
+	}
+	sub.Name = strings.TrimSpace(sub.Name)
+	if sub.Name == "" {
+		sub.Name = defaultName(sub.URL)
+	}
+	return sub, nil
+}
+
+// defaultName derives a name from a channel URL: the handle, custom name or
+// channel ID.
+func defaultName(channelURL string) string {
+	segments := strings.Split(strings.TrimSuffix(channelURL, "/"), "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "@") {
+			return seg
+		}
+		if (seg == "channel" || seg == "c" || seg == "user") && i+1 < len(segments) {
+			return segments[i+1]
+		}
+	}
+	return channelURL
+}
@@ -0,0 +1,140 @@
+package subscriptions
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+)
+
+func TestList_Add(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     Subscription
+		want    Subscription
+		wantErr bool
+	}{
+		{
+			name: "handle",
+			sub:  Subscription{URL: "https://www.youtube.com/@example/"},
+			want: Subscription{Name: "@example", URL: "https://www.youtube.com/@example"},
+		},
+		{
+			name: "channel ID",
+			sub:  Subscription{Name: "Example", URL: "https://www.youtube.com/channel/UC123", Tab: "streams"},
+			want: Subscription{Name: "Example", URL: "https://www.youtube.com/channel/UC123", ChannelID: "UC123", Tab: "streams"},
+		},
+		{name: "not a channel", sub: Subscription{URL: "https://www.youtube.com/watch?v=abc"}, wantErr: true},
+		{name: "invalid tab", sub: Subscription{URL: "https://www.youtube.com/@example", Tab: "community"}, wantErr: true},
+		{name: "duplicate", sub: Subscription{URL: "https://www.youtube.com/@existing"}, wantErr: true},
+		{name: "duplicate name", sub: Subscription{Name: "EXISTING", URL: "https://www.youtube.com/@other"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := &List{Subscriptions: []Subscription{{Name: "existing", URL: "https://www.youtube.com/@existing"}}}
+			err := list.Add(tt.sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := list.Subscriptions[1]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Add() stored %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_Remove(t *testing.T) {
+	list := &List{Subscriptions: []Subscription{
+		{Name: "one", URL: "https://www.youtube.com/@one"},
+		{Name: "two", URL: "https://www.youtube.com/channel/UC2", ChannelID: "UC2"},
+	}}
+
+	if _, err := list.Remove("UC2"); err != nil {
+		t.Fatalf("Remove() by channel ID error = %v", err)
+	}
+	if _, err := list.Remove("https://www.youtube.com/@one/"); err != nil {
+		t.Fatalf("Remove() by URL error = %v", err)
+	}
+	if len(list.Subscriptions) != 0 {
+		t.Errorf("Remove() left %v", list.Subscriptions)
+	}
+	if _, err := list.Remove("one"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove() of a missing subscription error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestList_Merge(t *testing.T) {
+	list := &List{Subscriptions: []Subscription{{Name: "Example", URL: "https://www.youtube.com/channel/UC1", ChannelID: "UC1"}}}
+
+	added, err := list.Merge([]Subscription{
+		{Name: "Example", URL: "https://www.youtube.com/channel/UC1"},
+		{Name: "Example", URL: "https://www.youtube.com/channel/UC2"},
+	})
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if added != 1 {
+		t.Errorf("Merge() added %d, want 1", added)
+	}
+	if got := list.Subscriptions[1].Name; got != "Example (2)" {
+		t.Errorf("Merge() named the new subscription %q, want %q", got, "Example (2)")
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", FILE_NAME)
+
+	list, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+	if len(list.Subscriptions) != 0 {
+		t.Fatalf("Load() of a missing file = %v, want empty", list.Subscriptions)
+	}
+
+	if err := list.Add(Subscription{URL: "https://www.youtube.com/@example", Latest: 5, MinDuration: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, list) {
+		t.Errorf("Load() = %+v, want %+v", loaded, list)
+	}
+}
+
+func TestSubscription_Config(t *testing.T) {
+	base := config.NewConfig()
+	base.Quality = "720p"
+	base.Latest = 10
+
+	sub := Subscription{Name: "a/b", URL: "https://www.youtube.com/@example", Tab: "streams", AudioOnly: true}
+	cfg := sub.Config(base, "/videos")
+
+	if cfg.OutputDir != "/videos/a_b" {
+		t.Errorf("OutputDir = %q, want /videos/a_b", cfg.OutputDir)
+	}
+	if !cfg.Playlist || cfg.Tab != "streams" || !cfg.AudioOnly || cfg.Quality != "720p" || cfg.Latest != 10 {
+		t.Errorf("Config() = %+v, want subscription settings over the base", cfg)
+	}
+	if base.Tab != "" || base.AudioOnly {
+		t.Error("Config() modified the base configuration")
+	}
+
+	sub.Dir = "/srv/example"
+	if cfg := sub.Config(base, "/videos"); cfg.OutputDir != "/srv/example" {
+		t.Errorf("OutputDir = %q, want the absolute subscription directory", cfg.OutputDir)
+	}
+}
@@ -0,0 +1,168 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/downloader"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+)
+
+// Config returns the configuration to mirror the subscription with: base
+// overridden by the subscription's settings, with the output directory
+// resolved against baseDir.
+func (s Subscription) Config(base *config.Config, baseDir string) *config.Config {
+	cfg := *base
+	cfg.URL = s.URL
+	cfg.Playlist = true
+	cfg.OutputDir = filepath.Join(baseDir, s.dirName())
+	if filepath.IsAbs(s.Dir) {
+		cfg.OutputDir = s.Dir
+	}
+
+	if s.Tab != "" {
+		cfg.Tab = s.Tab
+	}
+	if s.Latest > 0 {
+		cfg.Latest = s.Latest
+	}
+	if s.AudioOnly {
+		cfg.AudioOnly = true
+	}
+	if s.Format != "" {
+		cfg.Format = s.Format
+	}
+	if s.Quality != "" {
+		cfg.Quality = s.Quality
+	}
+	if s.MinDuration != 0 {
+		cfg.MinDuration = s.MinDuration
+	}
+	if s.MaxDuration != 0 {
+		cfg.MaxDuration = s.MaxDuration
+	}
+	if s.MatchTitle != "" {
+		cfg.MatchTitle = s.MatchTitle
+	}
+	if s.RejectTitle != "" {
+		cfg.RejectTitle = s.RejectTitle
+	}
+	return &cfg
+}
+
+// dirName returns the configured directory or one derived from the name,
+// with characters that are unsafe in file names replaced.
+func (s Subscription) dirName() string {
+	if s.Dir != "" {
+		return s.Dir
+	}
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s.Name)
+	if strings.Trim(name, ".") == "" {
+		return "_"
+	}
+	return name
+}
+
+// ShareFunc runs the download of a subscription at a share of the
+// bandwidth, such as daemon.Daemon.RunShared: download is called with the
+// rate to download at, 0 for unlimited, and called again with the new rate
+// whenever the share changes. own is the subscription's own rate limit.
+type ShareFunc func(ctx context.Context, name string, own int64, download func(ctx context.Context, rate int64) error) error
+
+// Options controls how subscriptions are synced.
+type Options struct {
+	// AfterDownload is run for every downloaded video if set.
+	AfterDownload downloader.Hook
+	// OnSynced receives the outcome of every subscription if set. summary
+	// is nil if the subscription failed before downloading.
+	OnSynced func(sub Subscription, summary *mirror.Summary, err error)
+	// Context stops the sync when it is cancelled if set. The subscriptions
+	// that were not synced yet are skipped.
+	Context context.Context
+	// Share runs every subscription's sync at a share of the bandwidth if
+	// set. The sync is restarted at its new rate when the share changes.
+	Share ShareFunc
+}
+
+// synced reports the outcome of a subscription to OnSynced.
+func (o Options) synced(sub Subscription, summary *mirror.Summary, err error) {
+	if o.OnSynced != nil {
+		o.OnSynced(sub, summary, err)
+	}
+}
+
+// Sync mirrors every subscription into its directory below baseDir, with
+// base as the configuration for settings the subscription does not set.
+// A failing channel does not stop the others; the errors of all channels
+// are returned together.
+func Sync(subs []Subscription, base *config.Config, baseDir string, opts Options, w io.Writer) error {
+	var errs []error
+	for _, sub := range subs {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			errs = append(errs, fmt.Errorf("sync stopped: %w", opts.Context.Err()))
+			break
+		}
+		fmt.Fprintf(w, "== %s (%s)\n", sub.Name, sub.URL)
+
+		cfg := sub.Config(base, baseDir)
+		if err := cfg.Validate(); err != nil {
+			err = fmt.Errorf("invalid configuration: %w", err)
+			opts.synced(sub, nil, err)
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Name, err))
+			continue
+		}
+
+		summary, err := opts.mirror(sub, cfg)
+		opts.synced(sub, summary, err)
+		if summary != nil {
+			summary.Print(w)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mirror syncs the subscription's channel with cfg, at a share of the
+// bandwidth if Share is set.
+func (o Options) mirror(sub Subscription, cfg *config.Config) (*mirror.Summary, error) {
+	mirrorOpts := mirror.Options{Prune: sub.Prune, AfterDownload: o.AfterDownload, Context: o.Context}
+	if o.Share == nil {
+		return mirror.New(cfg, mirrorOpts).Sync()
+	}
+
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	own, err := cfg.Rate()
+	if err != nil {
+		return nil, err
+	}
+	var summary *mirror.Summary
+	err = o.Share(ctx, "subscription "+sub.Name, own, func(ctx context.Context, rate int64) error {
+		shareCfg := *cfg
+		shareCfg.LimitRate = ""
+		if rate > 0 {
+			shareCfg.LimitRate = strconv.FormatInt(rate, 10)
+		}
+		mirrorOpts.Context = ctx
+		next, err := mirror.New(&shareCfg, mirrorOpts).Sync()
+		summary = summary.Continue(next)
+		return err
+	})
+	return summary, err
+}
@@ -0,0 +1,94 @@
+package subscriptions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/mirror"
+)
+
+const fakeChannelScript = `#!/bin/sh
+case "$*" in
+*--version*)
+	echo 2025.01.01
+	;;
+*--dump-single-json*)
+	echo '{"_type": "playlist", "id": "UC123", "entries": [{"id": "newvideo001", "title": "New", "url": "https://www.youtube.com/watch?v=newvideo001"}]}'
+	;;
+*)
+	echo "$*" >> "$FAKE_DOWNLOADS"
+	for arg in "$@"; do
+		case "$arg" in
+		*watch?v=*)
+			echo "[youtube] Extracting URL: $arg"
+			echo "[download] 100% of 1.00MiB"
+			: > "$FAKE_DIR/New [newvideo001].mp4"
+			;;
+		esac
+	done
+	;;
+esac
+`
+
+func TestSync_Share(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake yt-dlp requires a POSIX shell")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(fakeChannelScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	downloads := filepath.Join(t.TempDir(), "downloads")
+	t.Setenv("FAKE_DOWNLOADS", downloads)
+
+	baseDir := t.TempDir()
+	t.Setenv("FAKE_DIR", filepath.Join(baseDir, "Example"))
+	if err := os.MkdirAll(filepath.Join(baseDir, "Example"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sub := Subscription{Name: "Example", URL: "https://www.youtube.com/channel/UC123/videos"}
+	base := config.NewConfig()
+	base.LimitRate = "2000"
+
+	var shared []string
+	var summary *mirror.Summary
+	opts := Options{
+		// The sync is restarted once, as on a change of its share.
+		Share: func(ctx context.Context, name string, own int64, download func(ctx context.Context, rate int64) error) error {
+			shared = append(shared, name)
+			if own != 2000 {
+				t.Errorf("Share() own rate = %d, want the configured limit", own)
+			}
+			if err := download(ctx, 1000); err != nil {
+				return err
+			}
+			return download(ctx, 500)
+		},
+		OnSynced: func(_ Subscription, s *mirror.Summary, _ error) { summary = s },
+	}
+
+	var out strings.Builder
+	if err := Sync([]Subscription{sub}, base, baseDir, opts, &out); err != nil {
+		t.Fatalf("Sync() error = %v\n%s", err, out.String())
+	}
+
+	if len(shared) != 1 || shared[0] != "subscription Example" {
+		t.Errorf("shared syncs = %v, want the subscription", shared)
+	}
+	data, err := os.ReadFile(downloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "--limit-rate 1000") || strings.Contains(string(data), "--limit-rate 2000") {
+		t.Errorf("downloads ran with %q, want the shared rate", data)
+	}
+	if summary == nil || len(summary.Added) != 1 || summary.Existing != 0 {
+		t.Errorf("summary = %+v, want the video of the first run added", summary)
+	}
+}
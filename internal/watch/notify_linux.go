@@ -0,0 +1,66 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// notify reports the names of files closed after writing in dir or moved
+// into it, using inotify, until ctx is cancelled. An empty name means that
+// notifications were lost.
+func notify(ctx context.Context, dir string) (<-chan string, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify unavailable: %w", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	// A non-blocking descriptor is read through the runtime's poller, so
+	// closing the file ends a pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	names := make(chan string)
+	go func() {
+		defer close(names)
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				// struct inotify_event: wd, mask, cookie, len, name.
+				mask := binary.NativeEndian.Uint32(buf[offset+4:])
+				size := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+				start := offset + syscall.SizeofInotifyEvent
+				name := string(bytes.TrimRight(buf[start:min(start+size, n)], "\x00"))
+				offset = start + size
+
+				switch {
+				case mask&syscall.IN_Q_OVERFLOW != 0:
+					name = ""
+				case mask&syscall.IN_ISDIR != 0 || name == "":
+					continue
+				}
+				select {
+				case names <- name:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return names, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"errors"
+)
+
+// notify is not supported on this system; the directory is polled instead.
+func notify(ctx context.Context, dir string) (<-chan string, error) {
+	return nil, errors.New("file notifications are not supported on this system")
+}
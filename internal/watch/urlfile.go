@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// urlFileExts are the extensions of the files a Watcher reads URLs from.
+var urlFileExts = map[string]bool{
+	".txt":    true,
+	".url":    true,
+	".webloc": true,
+}
+
+// IsURLFile reports whether name has the extension of a URL file.
+func IsURLFile(name string) bool {
+	return urlFileExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// ParseURLFile returns the URLs in the content of a URL file, chosen by the
+// extension of name: a .txt file has one URL per line, with blank lines and
+// lines starting with # ignored; a .url file is a Windows Internet Shortcut
+// and a .webloc file a macOS XML property list.
+func ParseURLFile(name string, data []byte) ([]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	var urls []string
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".txt":
+		urls = parseTextFile(data)
+	case ".url":
+		urls = parseInternetShortcut(data)
+	case ".webloc":
+		urls, err = parseWebloc(data)
+	default:
+		return nil, fmt.Errorf("unsupported URL file type %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs found")
+	}
+	for _, u := range urls {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("%q is not an http or https URL", u)
+		}
+	}
+	return urls, nil
+}
+
+// parseTextFile returns the non-empty, non-comment lines.
+func parseTextFile(data []byte) []string {
+	var urls []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls
+}
+
+// parseInternetShortcut returns the URL key of the [InternetShortcut]
+// section.
+func parseInternetShortcut(data []byte) []string {
+	inSection := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inSection = strings.EqualFold(line, "[InternetShortcut]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if inSection && ok && strings.EqualFold(strings.TrimSpace(key), "URL") {
+			return []string{strings.TrimSpace(value)}
+		}
+	}
+	return nil
+}
+
+// parseWebloc returns the string following the URL key of an XML property
+// list.
+func parseWebloc(data []byte) ([]string, error) {
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return nil, fmt.Errorf("binary .webloc files are not supported, convert them with: plutil -convert xml1")
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var element, key string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid .webloc file: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			element = t.Name.Local
+		case xml.EndElement:
+			element = ""
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			switch {
+			case element == "key":
+				key = text
+			case element == "string" && key == "URL":
+				return []string{text}, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package watch
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseURLFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "text file",
+			file:    "list.txt",
+			content: "\ufeff# weekend\nhttps://youtu.be/a\n\n  https://www.youtube.com/watch?v=b  \r\n",
+			want:    []string{"https://youtu.be/a", "https://www.youtube.com/watch?v=b"},
+		},
+		{
+			name:    "internet shortcut",
+			file:    "Video.URL",
+			content: "[{000214A0-0000-0000-C000-000000000046}]\r\nProp3=19,11\r\n[InternetShortcut]\r\nIDList=\r\nURL=https://youtu.be/a\r\n",
+			want:    []string{"https://youtu.be/a"},
+		},
+		{
+			name: "webloc",
+			file: "video.webloc",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>URL</key>
+	<string>https://youtu.be/a</string>
+</dict>
+</plist>`,
+			want: []string{"https://youtu.be/a"},
+		},
+		{name: "binary webloc", file: "video.webloc", content: "bplist00\xd1\x01\x02", wantErr: true},
+		{name: "empty text file", file: "list.txt", content: "# nothing yet\n", wantErr: true},
+		{name: "shortcut without URL", file: "video.url", content: "[InternetShortcut]\nIconIndex=0\n", wantErr: true},
+		{name: "not a URL", file: "list.txt", content: "https://youtu.be/a\nrm -rf /\n", wantErr: true},
+		{name: "unsupported scheme", file: "list.txt", content: "file:///etc/passwd\n", wantErr: true},
+		{name: "unsupported type", file: "list.csv", content: "https://youtu.be/a\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseURLFile(tt.file, []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURLFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseURLFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Package watch queues the URLs of files dropped into a directory, for tools
+// that can only write files. Every URL file is queued with the options of
+// the watcher, or of a JSON sidecar next to it, and then moved into the
+// done or failed subdirectory.
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+const (
+	DONE_DIR   = "done"
+	FAILED_DIR = "failed"
+
+	// SIDECAR_EXT replaces the extension of a URL file to name its sidecar.
+	SIDECAR_EXT = ".json"
+	// ERROR_EXT is appended to the name of a failed file to name the file
+	// describing why it failed.
+	ERROR_EXT = ".error"
+
+	DEFAULT_POLL_INTERVAL = 5 * time.Second
+)
+
+const (
+	// settleTime is how long a file found by a directory scan must be
+	// unchanged before it is read, so that files being written are not read
+	// half-way. Files reported by the system as closed are read at once.
+	settleTime = 2 * time.Second
+	// rescanInterval is how often the directory is scanned when the system
+	// reports new files, to pick up files whose notification was missed.
+	rescanInterval = time.Minute
+)
+
+// AddFunc queues a job, such as Queue.AddWith.
+type AddFunc func(cfg config.Config, opts queue.AddOptions) (queue.Job, error)
+
+// Options controls how URL files are queued.
+type Options struct {
+	// Config is the download configuration of URL files without a sidecar.
+	// Output directories of sidecars are resolved against its output
+	// directory and must stay inside it.
+	Config config.Config
+	// Priority is the priority of jobs of URL files without a sidecar.
+	Priority queue.Priority
+	// PollInterval is how often the directory is scanned on systems that do
+	// not report new files.
+	PollInterval time.Duration
+}
+
+// Sidecar holds the options of the URL file it is named after: download
+// options as in a job submitted to the HTTP API and a job priority. Omitted
+// fields keep the watcher's options.
+type Sidecar struct {
+	config.DownloadOptions
+	Priority queue.Priority `json:"priority,omitempty"`
+}
+
+// Watcher queues the URL files of a directory.
+type Watcher struct {
+	dir     string
+	add     AddFunc
+	options Options
+}
+
+// New creates a Watcher for dir that queues jobs with add. Zero options use
+// the defaults.
+func New(dir string, add AddFunc, opts Options) *Watcher {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	return &Watcher{dir: dir, add: add, options: opts}
+}
+
+// Owner returns the owner recorded on the jobs of the named URL file.
+func Owner(name string) string {
+	return "watch:" + name
+}
+
+// Run queues the URL files in the directory and the ones added later until
+// ctx is cancelled. New files are reported by inotify on Linux; elsewhere
+// the directory is polled.
+func (w *Watcher) Run(ctx context.Context) error {
+	for _, sub := range []string{DONE_DIR, FAILED_DIR} {
+		if err := os.MkdirAll(filepath.Join(w.dir, sub), 0755); err != nil {
+			return fmt.Errorf("failed to create %s directory: %w", sub, err)
+		}
+	}
+
+	interval := rescanInterval
+	events, err := notify(ctx, w.dir)
+	if err != nil {
+		interval = w.options.PollInterval
+		log.Printf("polling %s every %s: %v", w.dir, interval, err)
+	} else {
+		log.Printf("watching %s", w.dir)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case name, ok := <-events:
+			switch {
+			case !ok:
+				events = nil
+			case name == "":
+				// Notifications were lost.
+				timer.Reset(0)
+			case IsURLFile(name):
+				w.Process(name)
+			}
+		case <-timer.C:
+			// Files that are still changing are looked at again soon.
+			if w.scan(time.Now()) {
+				timer.Reset(settleTime)
+			} else {
+				timer.Reset(interval)
+			}
+		}
+	}
+}
+
+// scan processes the URL files that were not changed for settleTime. It
+// reports whether it skipped files that changed more recently.
+func (w *Watcher) scan(now time.Time) bool {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		log.Printf("failed to read %s: %v", w.dir, err)
+		return false
+	}
+	pending := false
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !IsURLFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) < settleTime {
+			pending = true
+			continue
+		}
+		w.Process(e.Name())
+	}
+	return pending
+}
+
+// Process queues the URLs of the named file in the directory and moves it
+// and its sidecar into DONE_DIR, or into FAILED_DIR with a file describing
+// the error. Jobs are only queued if all URLs and the sidecar are valid.
+func (w *Watcher) Process(name string) {
+	path := filepath.Join(w.dir, name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Already processed, e.g. by a scan.
+		return
+	}
+
+	var queued []string
+	if err == nil {
+		queued, err = w.queue(name, data)
+	}
+	if err != nil {
+		log.Printf("%s: %v", name, err)
+		if len(queued) > 0 {
+			err = fmt.Errorf("%w\nqueued before the error: %s", err, strings.Join(queued, ", "))
+		}
+		w.move(name, FAILED_DIR, err)
+		return
+	}
+	w.move(name, DONE_DIR, nil)
+}
+
+// queue queues a job for every URL of the file's content and returns the
+// IDs of the queued jobs.
+func (w *Watcher) queue(name string, data []byte) ([]string, error) {
+	urls, err := ParseURLFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := w.sidecar(name)
+	if err != nil {
+		return nil, err
+	}
+	jobCfg := w.options.Config
+	sidecar.Apply(&jobCfg)
+
+	configs := make([]config.Config, len(urls))
+	for i, u := range urls {
+		cfg := jobCfg
+		cfg.URL = u
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", u, err)
+		}
+		configs[i] = cfg
+	}
+
+	var queued []string
+	for _, cfg := range configs {
+		job, err := w.add(cfg, queue.AddOptions{Owner: Owner(name), Priority: sidecar.Priority})
+		if err != nil {
+			return queued, fmt.Errorf("failed to queue %s: %w", cfg.URL, err)
+		}
+		log.Printf("%s: queued job %s for %s", name, job.ID, cfg.URL)
+		queued = append(queued, job.ID)
+	}
+	return queued, nil
+}
+
+// sidecarName returns the name of the sidecar of a URL file.
+func sidecarName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + SIDECAR_EXT
+}
+
+// sidecar returns the options of the URL file: its sidecar applied over the
+// watcher's options.
+func (w *Watcher) sidecar(name string) (Sidecar, error) {
+	sidecar := Sidecar{DownloadOptions: config.NewDownloadOptions(&w.options.Config), Priority: w.options.Priority}
+	path := filepath.Join(w.dir, sidecarName(name))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return sidecar, nil
+	}
+	if err != nil {
+		return sidecar, fmt.Errorf("failed to read sidecar %s: %w", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sidecar); err != nil {
+		return sidecar, fmt.Errorf("invalid sidecar %s: %w", path, err)
+	}
+	if sidecar.OutputDir, err = config.ResolveOutputDir(w.options.Config.OutputDir, sidecar.OutputDir); err != nil {
+		return sidecar, fmt.Errorf("invalid sidecar %s: %w", path, err)
+	}
+	return sidecar, nil
+}
+
+// move moves the URL file and its sidecar into the subdirectory sub,
+// renaming them if the names are taken. The error of a failed file is
+// written next to it.
+func (w *Watcher) move(name, sub string, fileErr error) {
+	target := w.freeName(sub, name)
+	if err := os.Rename(filepath.Join(w.dir, name), filepath.Join(w.dir, sub, target)); err != nil {
+		log.Printf("%s: failed to move to %s: %v", name, sub, err)
+		return
+	}
+	sidecar := filepath.Join(w.dir, sidecarName(name))
+	if err := os.Rename(sidecar, filepath.Join(w.dir, sub, sidecarName(target))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s: failed to move sidecar to %s: %v", name, sub, err)
+	}
+	if fileErr != nil {
+		path := filepath.Join(w.dir, sub, target+ERROR_EXT)
+		if err := os.WriteFile(path, []byte(fileErr.Error()+"\n"), 0644); err != nil {
+			log.Printf("%s: failed to write %s: %v", name, path, err)
+		}
+	}
+}
+
+// freeName returns name, or name with a number added, such that neither it
+// nor its sidecar exist in the subdirectory sub.
+func (w *Watcher) freeName(sub, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		if !exists(filepath.Join(w.dir, sub, candidate)) && !exists(filepath.Join(w.dir, sub, sidecarName(candidate))) {
+			return candidate
+		}
+		candidate = stem + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// exists reports whether a file exists at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
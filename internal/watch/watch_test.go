@@ -0,0 +1,186 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hidekingerz/drop-tube/internal/config"
+	"github.com/hidekingerz/drop-tube/internal/queue"
+)
+
+// recorder is an AddFunc that records the queued jobs.
+type recorder struct {
+	mu   sync.Mutex
+	jobs []queue.Job
+	err  error
+}
+
+func (r *recorder) add(cfg config.Config, opts queue.AddOptions) (queue.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return queue.Job{}, r.err
+	}
+	job := queue.Job{ID: cfg.URL, Config: cfg, Owner: opts.Owner, Priority: opts.Priority}
+	r.jobs = append(r.jobs, job)
+	return job, nil
+}
+
+func (r *recorder) queued() []queue.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]queue.Job(nil), r.jobs...)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestWatcher(t *testing.T, add AddFunc) (*Watcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.OutputDir = t.TempDir()
+	w := New(dir, add, Options{Config: *cfg, Priority: queue.PRIORITY_LOW, PollInterval: 50 * time.Millisecond})
+	for _, sub := range []string{DONE_DIR, FAILED_DIR} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, dir
+}
+
+func TestWatcher_Process(t *testing.T) {
+	t.Run("default options", func(t *testing.T) {
+		rec := &recorder{}
+		w, dir := newTestWatcher(t, rec.add)
+		writeFile(t, filepath.Join(dir, "list.txt"), "https://youtu.be/a\nhttps://youtu.be/b\n")
+
+		w.Process("list.txt")
+		jobs := rec.queued()
+		if len(jobs) != 2 || jobs[0].Config.URL != "https://youtu.be/a" || jobs[1].Owner != "watch:list.txt" || jobs[1].Priority != queue.PRIORITY_LOW {
+			t.Errorf("queued jobs = %+v", jobs)
+		}
+		if jobs[0].Config.OutputDir != w.options.Config.OutputDir {
+			t.Errorf("output dir = %s, want the default %s", jobs[0].Config.OutputDir, w.options.Config.OutputDir)
+		}
+		if !exists(filepath.Join(dir, DONE_DIR, "list.txt")) || exists(filepath.Join(dir, "list.txt")) {
+			t.Error("processed file was not moved into done")
+		}
+	})
+
+	t.Run("sidecar", func(t *testing.T) {
+		rec := &recorder{}
+		w, dir := newTestWatcher(t, rec.add)
+		writeFile(t, filepath.Join(dir, "music.json"), `{"audio_only": true, "output_dir": "music", "priority": 2}`)
+		writeFile(t, filepath.Join(dir, "music.url"), "[InternetShortcut]\nURL=https://youtu.be/a\n")
+		// A file of the same name was processed before.
+		writeFile(t, filepath.Join(dir, DONE_DIR, "music.url"), "")
+
+		w.Process("music.url")
+		jobs := rec.queued()
+		if len(jobs) != 1 || !jobs[0].Config.AudioOnly || jobs[0].Priority != queue.PRIORITY_URGENT {
+			t.Fatalf("queued jobs = %+v, want one urgent audio job", jobs)
+		}
+		if want := filepath.Join(w.options.Config.OutputDir, "music"); jobs[0].Config.OutputDir != want {
+			t.Errorf("output dir = %s, want %s", jobs[0].Config.OutputDir, want)
+		}
+		for _, name := range []string{"music-1.url", "music-1.json"} {
+			if !exists(filepath.Join(dir, DONE_DIR, name)) {
+				t.Errorf("%s missing from done", name)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			files   map[string]string
+			addErr  error
+			wantErr string
+		}{
+			{"no URLs", map[string]string{"a.txt": "\n"}, nil, "no URLs"},
+			{"bad URL", map[string]string{"a.txt": "https://youtu.be/a\nnot a url\n"}, nil, "not an http"},
+			{"bad sidecar", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"speed": 1}`}, nil, "unknown field"},
+			{"bad options", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"limit_rate": "fast"}`}, nil, "invalid rate"},
+			{"report file", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"report_file": "/etc/cron.d/x"}`}, nil, "unknown field"},
+			{"archive file", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"archive_file": "/tmp/archive"}`}, nil, "unknown field"},
+			{"output template", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"output_template": "../%(title)s.%(ext)s"}`}, nil, "unknown field"},
+			{"absolute output dir", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"output_dir": "/etc"}`}, nil, "outside of"},
+			{"relative output dir", map[string]string{"a.txt": "https://youtu.be/a\n", "a.json": `{"output_dir": "../escape"}`}, nil, "outside of"},
+			{"queue error", map[string]string{"a.txt": "https://youtu.be/a\n"}, errors.New("disk full"), "disk full"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rec := &recorder{err: tt.addErr}
+				w, dir := newTestWatcher(t, rec.add)
+				for name, content := range tt.files {
+					writeFile(t, filepath.Join(dir, name), content)
+				}
+
+				w.Process("a.txt")
+				if jobs := rec.queued(); len(jobs) != 0 {
+					t.Errorf("queued jobs = %+v, want none", jobs)
+				}
+				for name := range tt.files {
+					if !exists(filepath.Join(dir, FAILED_DIR, name)) {
+						t.Errorf("%s was not moved into failed", name)
+					}
+				}
+				data, err := os.ReadFile(filepath.Join(dir, FAILED_DIR, "a.txt"+ERROR_EXT))
+				if err != nil || !strings.Contains(string(data), tt.wantErr) {
+					t.Errorf("error file = %q, %v, want it to mention %q", data, err, tt.wantErr)
+				}
+			})
+		}
+	})
+}
+
+func TestWatcher_Run(t *testing.T) {
+	rec := &recorder{}
+	w, dir := newTestWatcher(t, rec.add)
+	// Files present at the start are queued once they have settled.
+	writeFile(t, filepath.Join(dir, "old.txt"), "https://youtu.be/old\n")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.txt"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "notes.md"), "https://youtu.be/ignored\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Files are written elsewhere and moved in, like tools writing
+	// atomically do.
+	tmp := filepath.Join(t.TempDir(), "new.txt")
+	writeFile(t, tmp, "https://youtu.be/new\n")
+	if err := os.Rename(tmp, filepath.Join(dir, "new.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) && len(rec.queued()) < 2 {
+		time.Sleep(20 * time.Millisecond)
+	}
+	jobs := rec.queued()
+	if len(jobs) != 2 {
+		t.Fatalf("queued jobs = %+v, want old and new", jobs)
+	}
+	if !exists(filepath.Join(dir, "notes.md")) {
+		t.Error("file without a URL file extension was processed")
+	}
+}
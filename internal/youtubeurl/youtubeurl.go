@@ -0,0 +1,166 @@
+// Package youtubeurl provides YouTube URL classification and rewriting.
+package youtubeurl
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	TAB_VIDEOS   = "videos"
+	TAB_SHORTS   = "shorts"
+	TAB_STREAMS  = "streams"
+	TAB_PODCASTS = "podcasts"
+	TAB_ALL      = "all"
+
+	// FEED_URL is the Atom feed of a channel's latest uploads, selected with
+	// the channel_id query parameter.
+	FEED_URL = "https://www.youtube.com/feeds/videos.xml"
+)
+
+// channelTabs are the channel tabs that list uploads, in the order used for TAB_ALL.
+var channelTabs = []string{TAB_VIDEOS, TAB_SHORTS, TAB_STREAMS, TAB_PODCASTS}
+
+// knownTabs are path suffixes that select a channel tab.
+var knownTabs = append(slices.Clone(channelTabs), "featured", "playlists", "live", "community", "releases")
+
+// ValidTab reports whether tab is a supported tab name.
+func ValidTab(tab string) bool {
+	return tab == TAB_ALL || slices.Contains(channelTabs, tab)
+}
+
+// IsChannel reports whether rawURL points to a YouTube channel, with or
+// without a tab.
+func IsChannel(rawURL string) bool {
+	_, _, ok := channelBase(rawURL)
+	return ok
+}
+
+// IsChannelHome reports whether rawURL points to a channel's home page, the
+// channel without a tab or its featured tab. yt-dlp lists the channel's tabs
+// rather than its videos for it.
+func IsChannelHome(rawURL string) bool {
+	u, base, ok := channelBase(rawURL)
+	if !ok {
+		return false
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	return path == base || path == base+"/featured"
+}
+
+// ChannelTabURLs returns the URLs of the given tab of a channel, or of every
+// upload tab if tab is TAB_ALL. Any tab already present in the URL is replaced.
+func ChannelTabURLs(rawURL, tab string) ([]string, error) {
+	if !ValidTab(tab) {
+		return nil, fmt.Errorf("unknown channel tab %q, expected one of %s or %s",
+			tab, strings.Join(channelTabs, ", "), TAB_ALL)
+	}
+
+	u, base, ok := channelBase(rawURL)
+	if !ok {
+		return nil, fmt.Errorf("not a YouTube channel URL: %s", rawURL)
+	}
+
+	tabs := []string{tab}
+	if tab == TAB_ALL {
+		tabs = channelTabs
+	}
+
+	urls := make([]string, 0, len(tabs))
+	for _, t := range tabs {
+		tabURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: base + "/" + t}
+		urls = append(urls, tabURL.String())
+	}
+	return urls, nil
+}
+
+// ChannelID returns the channel ID (UC...) of a /channel/ URL or of a
+// channel's upload feed URL. Handles and custom URLs do not carry the ID.
+func ChannelID(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !isYouTubeHost(u.Hostname()) {
+		return "", false
+	}
+
+	if strings.TrimSuffix(u.Path, "/") == "/feeds/videos.xml" {
+		id := u.Query().Get("channel_id")
+		return id, id != ""
+	}
+
+	_, base, ok := channelBase(rawURL)
+	if !ok {
+		return "", false
+	}
+	id, found := strings.CutPrefix(base, "/channel/")
+	if !found {
+		return "", false
+	}
+	return id, true
+}
+
+// ChannelURL returns the canonical URL of the channel with the given ID.
+func ChannelURL(channelID string) string {
+	return "https://www.youtube.com/channel/" + url.PathEscape(channelID)
+}
+
+// FeedURL returns the upload feed URL of the channel with the given ID.
+func FeedURL(channelID string) string {
+	return FEED_URL + "?channel_id=" + url.QueryEscape(channelID)
+}
+
+// IsShort reports whether rawURL is a YouTube Shorts URL.
+func IsShort(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && isYouTubeHost(u.Hostname()) && strings.HasPrefix(u.Path, "/shorts/")
+}
+
+// Site returns the site a URL downloads from, such as "youtube.com" for
+// every YouTube host including youtu.be and music.youtube.com. Other hosts
+// are returned without a leading "www.". Downloads from the same site share
+// a yt-dlp extractor and the site's rate limits.
+func Site(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if isYouTubeHost(host) || host == "youtu.be" || host == "youtube-nocookie.com" || host == "www.youtube-nocookie.com" {
+		return "youtube.com"
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// channelBase parses a channel URL and returns it with the path of the
+// channel itself, without any tab.
+func channelBase(rawURL string) (*url.URL, string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !isYouTubeHost(u.Hostname()) {
+		return nil, "", false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var n int
+	switch {
+	case strings.HasPrefix(segments[0], "@") && len(segments[0]) > 1:
+		n = 1
+	case slices.Contains([]string{"channel", "c", "user"}, segments[0]) && len(segments) > 1:
+		n = 2
+	default:
+		return nil, "", false
+	}
+
+	if len(segments) > n+1 || (len(segments) == n+1 && !slices.Contains(knownTabs, segments[n])) {
+		return nil, "", false
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	return u, "/" + strings.Join(segments[:n], "/"), true
+}
+
+// isYouTubeHost reports whether host is youtube.com or one of its subdomains.
+func isYouTubeHost(host string) bool {
+	return host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
@@ -0,0 +1,168 @@
+package youtubeurl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsChannel(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.youtube.com/@example", true},
+		{"https://www.youtube.com/@example/videos", true},
+		{"https://m.youtube.com/channel/UC123/streams", true},
+		{"https://www.youtube.com/c/Example", true},
+		{"https://www.youtube.com/user/example/", true},
+		{"https://www.youtube.com/watch?v=abc", false},
+		{"https://www.youtube.com/playlist?list=PL1", false},
+		{"https://www.youtube.com/@example/videos/extra", false},
+		{"https://example.com/@example", false},
+		{"https://www.youtube.com/channel", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsChannel(tt.url); got != tt.want {
+				t.Errorf("IsChannel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsChannelHome(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.youtube.com/@example", true},
+		{"https://www.youtube.com/channel/UC123/", true},
+		{"https://www.youtube.com/@example/featured", true},
+		{"https://www.youtube.com/@example/videos", false},
+		{"https://www.youtube.com/watch?v=abc", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsChannelHome(tt.url); got != tt.want {
+				t.Errorf("IsChannelHome() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelTabURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		tab     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "handle",
+			url:  "https://www.youtube.com/@example",
+			tab:  TAB_STREAMS,
+			want: []string{"https://www.youtube.com/@example/streams"},
+		},
+		{
+			name: "replace tab and drop query",
+			url:  "https://www.youtube.com/channel/UC123/videos?view=0",
+			tab:  TAB_SHORTS,
+			want: []string{"https://www.youtube.com/channel/UC123/shorts"},
+		},
+		{
+			name: "all tabs",
+			url:  "https://www.youtube.com/@example/featured",
+			tab:  TAB_ALL,
+			want: []string{
+				"https://www.youtube.com/@example/videos",
+				"https://www.youtube.com/@example/shorts",
+				"https://www.youtube.com/@example/streams",
+				"https://www.youtube.com/@example/podcasts",
+			},
+		},
+		{
+			name:    "unknown tab",
+			url:     "https://www.youtube.com/@example",
+			tab:     "community",
+			wantErr: true,
+		},
+		{
+			name:    "not a channel",
+			url:     "https://www.youtube.com/watch?v=abc",
+			tab:     TAB_VIDEOS,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChannelTabURLs(tt.url, tt.tab)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ChannelTabURLs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChannelTabURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelID(t *testing.T) {
+	tests := []struct {
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{"https://www.youtube.com/channel/UC123", "UC123", true},
+		{"https://www.youtube.com/channel/UC123/videos", "UC123", true},
+		{"https://www.youtube.com/feeds/videos.xml?channel_id=UC123", "UC123", true},
+		{"https://www.youtube.com/feeds/videos.xml", "", false},
+		{"https://www.youtube.com/@example", "", false},
+		{"https://example.com/channel/UC123", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, ok := ChannelID(tt.url)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ChannelID() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFeedURL(t *testing.T) {
+	want := "https://www.youtube.com/feeds/videos.xml?channel_id=UC123"
+	if got := FeedURL("UC123"); got != want {
+		t.Errorf("FeedURL() = %q, want %q", got, want)
+	}
+	if id, ok := ChannelID(want); !ok || id != "UC123" {
+		t.Errorf("ChannelID(FeedURL()) = %q, %v, want UC123", id, ok)
+	}
+}
+
+func TestSite(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/watch?v=a", "youtube.com"},
+		{"https://music.youtube.com/playlist?list=PL1", "youtube.com"},
+		{"https://youtu.be/a", "youtube.com"},
+		{"https://WWW.Vimeo.com/1", "vimeo.com"},
+		{"https://player.vimeo.com/video/1", "player.vimeo.com"},
+		{"not a url\x7f", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := Site(tt.url); got != tt.want {
+				t.Errorf("Site() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}